@@ -0,0 +1,217 @@
+// Package accounting computes cost basis and realized PnL from the trade,
+// deposit and withdrawal history of an account. Disposals are matched to
+// acquired lots first in first out, last in first out or at the weighted
+// average cost, and every match is kept as an audit trail. Amounts are
+// valued in THB, fees paid in any currency included.
+package accounting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// Default Constants
+const (
+	DefaultHome = "thb"
+)
+
+// historyPageSize is the page size history is fetched in.
+const historyPageSize = 100
+
+var (
+	ErrUnknownMethod = errors.New("error: unknown cost basis method")
+	ErrInvalidEntry  = errors.New("error: invalid history entry")
+)
+
+// unsettled are the transfer statuses that moved no funds. Transfers of
+// any other status are accounted.
+var unsettled = map[string]bool{
+	"pending":    true,
+	"processing": true,
+	"rejected":   true,
+	"canceled":   true,
+	"cancelled":  true,
+	"failed":     true,
+	"expired":    true,
+}
+
+type Config struct {
+	// Home is the currency amounts are valued in. Defaults to DefaultHome.
+	Home string
+	// Rate, when set, returns the Home price of one unit of asset at a
+	// time, e.g. from klines. Without it, or when it has no price, the last
+	// price of asset in the trade history is used.
+	Rate func(asset string, at time.Time) (float64, bool)
+}
+
+type entryKind int
+
+const (
+	entryDeposit entryKind = iota
+	entryTrade
+	entryWithdrawal
+)
+
+// entry is one event of the history.
+type entry struct {
+	time     time.Time
+	kind     entryKind
+	trade    api.Trade
+	transfer api.Transfer
+}
+
+// entryKey identifies an entry. Fiat and crypto transfers are numbered
+// apart, so a transfer is keyed by its currency as well as its ID.
+type entryKey struct {
+	kind     entryKind
+	currency string
+	id       int
+}
+
+// Ledger collects the history of an account. Entries may be added in any
+// order and more than once; they are replayed by time, each once.
+type Ledger struct {
+	cfg     Config
+	entries []entry
+	seen    map[entryKey]bool
+}
+
+func New(cfg Config) *Ledger {
+	if cfg.Home == "" {
+		cfg.Home = DefaultHome
+	}
+	cfg.Home = strings.ToLower(cfg.Home)
+	return &Ledger{cfg: cfg, seen: make(map[entryKey]bool)}
+}
+
+// AddTrades adds fills from the TradeHistoryService.
+func (l *Ledger) AddTrades(trades ...api.Trade) error {
+	for _, t := range trades {
+		at, err := t.CreatedTime()
+		if err != nil {
+			return fmt.Errorf("%w: trade %d: %v", ErrInvalidEntry, t.ID, err)
+		}
+		if _, _, ok := strings.Cut(t.Pair, "_"); !ok {
+			return fmt.Errorf("%w: trade %d has pair %q", ErrInvalidEntry, t.ID, t.Pair)
+		}
+		l.add(entry{time: at, kind: entryTrade, trade: t}, entryKey{kind: entryTrade, id: t.ID})
+	}
+	return nil
+}
+
+// AddDeposits adds fiat or crypto deposits. Fiat deposits without a
+// currency are in Home.
+func (l *Ledger) AddDeposits(transfers ...api.Transfer) error {
+	return l.addTransfers(entryDeposit, transfers)
+}
+
+// AddWithdrawals adds fiat or crypto withdrawals. The fee is taken on top
+// of the amount.
+func (l *Ledger) AddWithdrawals(transfers ...api.Transfer) error {
+	return l.addTransfers(entryWithdrawal, transfers)
+}
+
+func (l *Ledger) addTransfers(kind entryKind, transfers []api.Transfer) error {
+	for _, t := range transfers {
+		if unsettled[strings.ToLower(t.Status)] {
+			continue
+		}
+		at, err := t.CreatedTime()
+		if err != nil {
+			return fmt.Errorf("%w: transfer %d: %v", ErrInvalidEntry, t.ID, err)
+		}
+		if t.Currency == "" {
+			t.Currency = l.cfg.Home
+		}
+		l.add(entry{time: at, kind: kind, transfer: t}, entryKey{kind: kind, currency: strings.ToLower(t.Currency), id: t.ID})
+	}
+	return nil
+}
+
+func (l *Ledger) add(e entry, key entryKey) {
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+	l.entries = append(l.entries, e)
+}
+
+// Fetch pages through the trade, deposit and withdrawal history of the
+// account and adds it.
+func (l *Ledger) Fetch(ctx context.Context, c *api.Client) error {
+	for offset := 0; ; offset += historyPageSize {
+		trades, err := c.NewTradeHistoryService().Limit(historyPageSize).Offset(offset).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch trade history: %w", err)
+		}
+		if err := l.AddTrades(trades...); err != nil {
+			return err
+		}
+		if len(trades) < historyPageSize {
+			break
+		}
+	}
+
+	histories := []struct {
+		name string
+		add  func(...api.Transfer) error
+		page func(offset int) ([]api.Transfer, error)
+	}{
+		{"fiat deposits", l.AddDeposits, func(offset int) ([]api.Transfer, error) {
+			return c.NewFiatDepositHistoryService().Limit(historyPageSize).Offset(offset).Do(ctx)
+		}},
+		{"crypto deposits", l.AddDeposits, func(offset int) ([]api.Transfer, error) {
+			return c.NewCryptoDepositHistoryService().Limit(historyPageSize).Offset(offset).Do(ctx)
+		}},
+		{"fiat withdrawals", l.AddWithdrawals, func(offset int) ([]api.Transfer, error) {
+			return c.NewFiatWithdrawalHistoryService().Limit(historyPageSize).Offset(offset).Do(ctx)
+		}},
+		{"crypto withdrawals", l.AddWithdrawals, func(offset int) ([]api.Transfer, error) {
+			return c.NewCryptoWithdrawalHistoryService().Limit(historyPageSize).Offset(offset).Do(ctx)
+		}},
+	}
+	for _, h := range histories {
+		for offset := 0; ; offset += historyPageSize {
+			transfers, err := h.page(offset)
+			if err != nil {
+				return fmt.Errorf("failed to fetch %s: %w", h.name, err)
+			}
+			if err := h.add(transfers...); err != nil {
+				return err
+			}
+			if len(transfers) < historyPageSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// sorted returns the entries by time. Entries at the same time are
+// replayed deposits first and withdrawals last, then by ID.
+func (l *Ledger) sorted() []entry {
+	entries := append([]entry(nil), l.entries...)
+	id := func(e entry) int {
+		if e.kind == entryTrade {
+			return e.trade.ID
+		}
+		return e.transfer.ID
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.time.Equal(b.time) {
+			return a.time.Before(b.time)
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return id(a) < id(b)
+	})
+	return entries
+}
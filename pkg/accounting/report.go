@@ -0,0 +1,406 @@
+package accounting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// dust is the amount below which a lot counts as used up.
+const dust = 1e-12
+
+// Method is how disposals are matched to acquired lots.
+type Method string
+
+const (
+	FIFO Method = "fifo"
+	LIFO Method = "lifo"
+	// Average values every unit held at the weighted average cost of the
+	// lots; lots are still used up oldest first for the audit trail.
+	Average Method = "average"
+)
+
+type SourceKind string
+
+const (
+	SourceTrade      SourceKind = "trade"
+	SourceDeposit    SourceKind = "deposit"
+	SourceWithdrawal SourceKind = "withdrawal"
+)
+
+// Source is the history entry behind a lot or disposal.
+type Source struct {
+	Kind SourceKind `json:"kind"`
+	ID   int        `json:"id"`
+	Pair string     `json:"pair,omitempty"`
+	// Fee is set on the disposal of an asset paid as a fee.
+	Fee bool `json:"fee,omitempty"`
+}
+
+// Lot is an acquired amount of an asset.
+type Lot struct {
+	ID     int       `json:"id"`
+	Asset  string    `json:"asset"`
+	Time   time.Time `json:"time"`
+	Amount float64   `json:"amount"`
+	// Cost is what Amount cost in the home currency, fees included.
+	Cost float64 `json:"cost"`
+	// UnitCost is the current cost basis of one unit. Under Average it
+	// follows the average of the lots held.
+	UnitCost  float64 `json:"unit_cost"`
+	Remaining float64 `json:"remaining"`
+	Source    Source  `json:"source"`
+}
+
+// Match is the part of a lot a disposal used up.
+type Match struct {
+	LotID    int       `json:"lot_id"`
+	Acquired time.Time `json:"acquired"`
+	Amount   float64   `json:"amount"`
+	Cost     float64   `json:"cost"`
+}
+
+// Disposal is an amount of an asset sold, spent or paid as a fee, with the
+// lots it was matched to.
+type Disposal struct {
+	Asset    string    `json:"asset"`
+	Time     time.Time `json:"time"`
+	Amount   float64   `json:"amount"`
+	Proceeds float64   `json:"proceeds"`
+	Cost     float64   `json:"cost"`
+	Realized float64   `json:"realized"`
+	// Fee is the fee deducted from Proceeds, so the gross proceeds are
+	// Proceeds plus Fee. Fees paid when buying are part of the lot cost,
+	// and fees paid in the asset sold are part of Cost.
+	Fee     float64 `json:"fee"`
+	Source  Source  `json:"source"`
+	Matches []Match `json:"matches"`
+	// Unmatched is the amount no lot was left for, e.g. because the
+	// history starts later. It is counted at zero cost.
+	Unmatched float64 `json:"unmatched,omitempty"`
+}
+
+type Report struct {
+	Method Method `json:"method"`
+	Home   string `json:"home"`
+	// Disposals are the sales and fee payments realizing PnL, in order.
+	Disposals []Disposal `json:"disposals"`
+	// Withdrawals are the lots moved out of the account. They realize
+	// nothing: proceeds equal cost.
+	Withdrawals []Disposal `json:"withdrawals"`
+	// Lots are the lots still held.
+	Lots            []Lot              `json:"lots"`
+	Realized        float64            `json:"realized"`
+	RealizedByAsset map[string]float64 `json:"realized_by_asset"`
+	RealizedByPair  map[string]float64 `json:"realized_by_pair"`
+	// Fees are in the home currency; FeesByAsset is keyed by the currency
+	// the fee was paid in.
+	Fees        float64            `json:"fees"`
+	FeesByAsset map[string]float64 `json:"fees_by_asset"`
+	// Warnings note missing prices and unmatched disposals.
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// Warning notes an entry the report could not value or match.
+type Warning struct {
+	// Time is the time of the entry.
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Holdings returns the amount held of every asset with open lots.
+func (r *Report) Holdings() map[string]float64 {
+	holdings := make(map[string]float64)
+	for _, lot := range r.Lots {
+		holdings[lot.Asset] += lot.Remaining
+	}
+	return holdings
+}
+
+// run is the state of one replay of the history.
+type run struct {
+	cfg    Config
+	method Method
+	report *Report
+	lots   map[string][]*Lot
+	all    []*Lot
+	prices map[string]float64
+}
+
+// Report replays the history under method.
+func (l *Ledger) Report(method Method) (*Report, error) {
+	switch method {
+	case FIFO, LIFO, Average:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMethod, method)
+	}
+	r := &run{
+		cfg:    l.cfg,
+		method: method,
+		report: &Report{
+			Method:          method,
+			Home:            l.cfg.Home,
+			Disposals:       []Disposal{},
+			Withdrawals:     []Disposal{},
+			Lots:            []Lot{},
+			RealizedByAsset: make(map[string]float64),
+			RealizedByPair:  make(map[string]float64),
+			FeesByAsset:     make(map[string]float64),
+		},
+		lots:   make(map[string][]*Lot),
+		prices: make(map[string]float64),
+	}
+	for _, e := range l.sorted() {
+		var err error
+		switch e.kind {
+		case entryTrade:
+			err = r.trade(e)
+		case entryDeposit:
+			err = r.deposit(e)
+		case entryWithdrawal:
+			err = r.withdrawal(e)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, lot := range r.all {
+		if lot.Remaining > dust {
+			r.report.Lots = append(r.report.Lots, *lot)
+		}
+	}
+	return r.report, nil
+}
+
+// rate returns the home price of asset at t.
+func (r *run) rate(asset string, t time.Time) (float64, bool) {
+	if asset == r.cfg.Home {
+		return 1, true
+	}
+	if r.cfg.Rate != nil {
+		if p, ok := r.cfg.Rate(asset, t); ok {
+			return p, true
+		}
+	}
+	p, ok := r.prices[asset]
+	return p, ok
+}
+
+func (r *run) warn(at time.Time, format string, args ...any) {
+	r.report.Warnings = append(r.report.Warnings, Warning{Time: at, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *run) trade(e entry) error {
+	t := e.trade
+	base, quote, _ := strings.Cut(strings.ToLower(t.Pair), "_")
+	feeAsset := strings.ToLower(t.FeeCurrency)
+	if feeAsset == "" {
+		feeAsset = quote
+	}
+	price, err1 := api.ParseFloat(t.Price)
+	amount, err2 := api.ParseFloat(t.Amount)
+	fee, err3 := api.ParseFloat(t.Fee)
+	for _, err := range []error{err1, err2, err3} {
+		if err != nil {
+			return fmt.Errorf("%w: trade %d: %v", ErrInvalidEntry, t.ID, err)
+		}
+	}
+
+	quoteRate, ok := r.rate(quote, e.time)
+	if !ok {
+		r.warn(e.time, "trade %d: no %s price for %s, valued at 0", t.ID, r.cfg.Home, quote)
+	} else {
+		r.prices[base] = price * quoteRate
+	}
+	value := amount * price * quoteRate
+
+	var feeRate float64
+	switch feeAsset {
+	case base:
+		feeRate = price * quoteRate
+	case quote:
+		feeRate = quoteRate
+	default:
+		if feeRate, ok = r.rate(feeAsset, e.time); !ok && fee > 0 {
+			r.warn(e.time, "trade %d: no %s price for fee in %s, valued at 0", t.ID, r.cfg.Home, feeAsset)
+		}
+	}
+	feeValue := fee * feeRate
+	r.report.Fees += feeValue
+	r.report.FeesByAsset[feeAsset] += feeValue
+
+	src := Source{Kind: SourceTrade, ID: t.ID, Pair: strings.ToLower(t.Pair)}
+	feeSrc := src
+	feeSrc.Fee = true
+	// A fee in an asset outside the pair spends that asset.
+	if feeAsset != base && feeAsset != quote && feeAsset != r.cfg.Home && fee > 0 {
+		r.dispose(feeAsset, fee, feeValue, 0, e.time, feeSrc)
+	}
+
+	if t.Side == api.SideTypeBuy {
+		received, cost, spent := amount, value, amount*price
+		switch feeAsset {
+		case base:
+			// The fee is taken from what was bought, so its value is
+			// already part of the cost.
+			received -= fee
+		case quote:
+			cost += feeValue
+			spent += fee
+		default:
+			cost += feeValue
+		}
+		r.acquire(base, received, cost, e.time, src)
+		if quote != r.cfg.Home {
+			r.dispose(quote, spent, spent*quoteRate, 0, e.time, src)
+		}
+		return nil
+	}
+
+	sold, proceeds, received, deducted := amount, value, amount*price, feeValue
+	switch feeAsset {
+	case base:
+		// The fee is paid in more of what was sold: its cost is part of
+		// the disposal and nothing is deducted from the proceeds.
+		sold += fee
+		deducted = 0
+	case quote:
+		proceeds -= feeValue
+		received -= fee
+	default:
+		proceeds -= feeValue
+	}
+	r.dispose(base, sold, proceeds, deducted, e.time, src)
+	if quote != r.cfg.Home {
+		r.acquire(quote, received, received*quoteRate, e.time, src)
+	}
+	return nil
+}
+
+func (r *run) deposit(e entry) error {
+	t := e.transfer
+	asset := strings.ToLower(t.Currency)
+	if asset == r.cfg.Home {
+		return nil
+	}
+	amount, err := api.ParseFloat(t.Amount)
+	if err != nil {
+		return fmt.Errorf("%w: deposit %d: %v", ErrInvalidEntry, t.ID, err)
+	}
+	rate, ok := r.rate(asset, e.time)
+	if !ok {
+		r.warn(e.time, "deposit %d: no %s price for %s, cost basis 0", t.ID, r.cfg.Home, asset)
+	}
+	r.acquire(asset, amount, amount*rate, e.time, Source{Kind: SourceDeposit, ID: t.ID})
+	return nil
+}
+
+func (r *run) withdrawal(e entry) error {
+	t := e.transfer
+	asset := strings.ToLower(t.Currency)
+	amount, err1 := api.ParseFloat(t.Amount)
+	fee, err2 := api.ParseFloat(t.Fee)
+	for _, err := range []error{err1, err2} {
+		if err != nil {
+			return fmt.Errorf("%w: withdrawal %d: %v", ErrInvalidEntry, t.ID, err)
+		}
+	}
+	rate, ok := r.rate(asset, e.time)
+	if !ok && fee > 0 {
+		r.warn(e.time, "withdrawal %d: no %s price for fee in %s, valued at 0", t.ID, r.cfg.Home, asset)
+	}
+	r.report.Fees += fee * rate
+	r.report.FeesByAsset[asset] += fee * rate
+	if asset == r.cfg.Home {
+		return nil
+	}
+
+	src := Source{Kind: SourceWithdrawal, ID: t.ID}
+	d := r.match(asset, amount, e.time, src)
+	d.Proceeds = d.Cost
+	r.report.Withdrawals = append(r.report.Withdrawals, d)
+	if fee > 0 {
+		src.Fee = true
+		r.dispose(asset, fee, fee*rate, 0, e.time, src)
+	}
+	return nil
+}
+
+// acquire adds a lot of asset.
+func (r *run) acquire(asset string, amount float64, cost float64, at time.Time, src Source) {
+	if amount <= dust {
+		return
+	}
+	lot := &Lot{
+		ID:        len(r.all) + 1,
+		Asset:     asset,
+		Time:      at,
+		Amount:    amount,
+		Cost:      cost,
+		UnitCost:  cost / amount,
+		Remaining: amount,
+		Source:    src,
+	}
+	r.all = append(r.all, lot)
+	r.lots[asset] = append(r.lots[asset], lot)
+
+	if r.method == Average {
+		var held, basis float64
+		for _, l := range r.lots[asset] {
+			held += l.Remaining
+			basis += l.Remaining * l.UnitCost
+		}
+		for _, l := range r.lots[asset] {
+			l.UnitCost = basis / held
+		}
+	}
+}
+
+// dispose realizes the PnL of selling or spending amount of asset for
+// proceeds, net of fee.
+func (r *run) dispose(asset string, amount float64, proceeds float64, fee float64, at time.Time, src Source) {
+	if amount <= dust {
+		return
+	}
+	d := r.match(asset, amount, at, src)
+	d.Proceeds, d.Fee = proceeds, fee
+	d.Realized = proceeds - d.Cost
+	r.report.Disposals = append(r.report.Disposals, d)
+	r.report.Realized += d.Realized
+	r.report.RealizedByAsset[asset] += d.Realized
+	if src.Pair != "" {
+		r.report.RealizedByPair[src.Pair] += d.Realized
+	}
+}
+
+// match uses up amount of asset from its lots in the order of the method.
+func (r *run) match(asset string, amount float64, at time.Time, src Source) Disposal {
+	d := Disposal{Asset: asset, Time: at, Amount: amount, Source: src, Matches: []Match{}}
+	lots := r.lots[asset]
+	left := amount
+	for left > dust && len(lots) > 0 {
+		i := 0
+		if r.method == LIFO {
+			i = len(lots) - 1
+		}
+		lot := lots[i]
+		used := min(left, lot.Remaining)
+		m := Match{LotID: lot.ID, Acquired: lot.Time, Amount: used, Cost: used * lot.UnitCost}
+		d.Matches = append(d.Matches, m)
+		d.Cost += m.Cost
+		lot.Remaining -= used
+		left -= used
+		if lot.Remaining <= dust {
+			lot.Remaining = 0
+			lots = append(lots[:i], lots[i+1:]...)
+		}
+	}
+	r.lots[asset] = lots
+	if left > dust {
+		d.Unmatched = left
+		r.warn(at, "%s %d: %g %s disposed without lots, cost basis 0", src.Kind, src.ID, left, asset)
+	}
+	return d
+}
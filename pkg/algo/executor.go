@@ -0,0 +1,577 @@
+// Package algo implements execution algorithms that work a parent order
+// through many child orders on the Orbix exchange.
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// State is the state of an execution.
+type State string
+
+const (
+	StateRunning   State = "running"
+	StatePaused    State = "paused"
+	StateCompleted State = "completed"
+	// StateExpired means the execution window ended before the parent
+	// quantity was filled.
+	StateExpired   State = "expired"
+	StateCancelled State = "cancelled"
+)
+
+// Done reports whether the execution has stopped for good.
+func (s State) Done() bool {
+	return s == StateCompleted || s == StateExpired || s == StateCancelled
+}
+
+// Default Constants
+const (
+	DefaultPollInterval    = 2 * time.Second
+	DefaultPricePrecision  = 2
+	DefaultAmountPrecision = 4
+	DefaultEventBuffer     = 256
+)
+
+var (
+	ErrCancelled     = errors.New("error: execution cancelled")
+	ErrInvalidConfig = errors.New("error: invalid execution config")
+	ErrEmptyBook     = errors.New("error: order book side is empty")
+	// ErrChildNotSettled means a child order could not be confirmed closed,
+	// so it may still be on the book. The execution stops rather than
+	// placing more children next to it.
+	ErrChildNotSettled = errors.New("error: child order not settled")
+)
+
+// Progress is a snapshot of an execution.
+type Progress struct {
+	State    State
+	Quantity float64
+	Filled   float64
+	// AveragePrice is the volume-weighted price of all fills.
+	AveragePrice float64
+	// ChildOrders is the number of child orders placed.
+	ChildOrders int
+	// Errors counts child orders that could not be placed or settled;
+	// LastErr is the most recent one.
+	Errors    int
+	LastErr   error
+	StartedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Remaining returns the unfilled parent quantity.
+func (p Progress) Remaining() float64 {
+	return math.Max(p.Quantity-p.Filled, 0)
+}
+
+// ExecutionConfig holds the settings shared by every algorithm.
+type ExecutionConfig struct {
+	Pair     string
+	Side     api.SideType
+	Quantity float64
+	// PegOffset improves passive child prices by this much from the same
+	// side of the book: buys at best bid + PegOffset, sells at best ask -
+	// PegOffset, never crossing the spread.
+	PegOffset float64
+	// LimitPrice, when set, is the worst price any child may use.
+	LimitPrice float64
+	// MinChildAmount skips child orders smaller than this.
+	MinChildAmount float64
+	// PricePrecision and AmountPrecision are the decimals of child prices
+	// and amounts. Default to DefaultPricePrecision and
+	// DefaultAmountPrecision.
+	PricePrecision  int
+	AmountPrecision int
+	// PollInterval is how often live child orders are checked. Defaults to
+	// DefaultPollInterval.
+	PollInterval time.Duration
+}
+
+func (cfg *ExecutionConfig) setDefaults() {
+	if cfg.PricePrecision == 0 {
+		cfg.PricePrecision = DefaultPricePrecision
+	}
+	if cfg.AmountPrecision == 0 {
+		cfg.AmountPrecision = DefaultAmountPrecision
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+}
+
+func (cfg *ExecutionConfig) validate() error {
+	if cfg.Pair == "" {
+		return fmt.Errorf("%w: missing pair", ErrInvalidConfig)
+	}
+	if cfg.Side != api.SideTypeBuy && cfg.Side != api.SideTypeSell {
+		return fmt.Errorf("%w: unknown side %q", ErrInvalidConfig, cfg.Side)
+	}
+	if cfg.Quantity <= 0 {
+		return fmt.Errorf("%w: quantity must be positive", ErrInvalidConfig)
+	}
+	if cfg.PegOffset < 0 || cfg.LimitPrice < 0 || cfg.MinChildAmount < 0 {
+		return fmt.Errorf("%w: negative peg offset, limit price or minimum child amount", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// executor places, watches and settles child orders for one parent order
+// and keeps the fill accounting and pause, resume and cancel controls
+// shared by every algorithm.
+type executor struct {
+	c   *api.Client
+	cfg ExecutionConfig
+
+	mu          sync.Mutex
+	progress    Progress
+	notional    float64
+	pausedSince time.Time
+	pausedTotal time.Duration
+	// interrupt is closed and replaced whenever the state changes, waking
+	// up anything waiting on the previous one.
+	interrupt chan struct{}
+	updates   chan Progress
+	// childPolled, when set, is called with every poll of a working child.
+	childPolled func(order *api.Order)
+}
+
+func newExecutor(c *api.Client, cfg ExecutionConfig) (*executor, error) {
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &executor{
+		c:   c,
+		cfg: cfg,
+		progress: Progress{
+			State:    StateRunning,
+			Quantity: cfg.Quantity,
+		},
+		interrupt: make(chan struct{}),
+		updates:   make(chan Progress, DefaultEventBuffer),
+	}, nil
+}
+
+// Progress returns the current progress.
+func (e *executor) Progress() Progress {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.progress
+}
+
+// Updates returns the channel receiving progress after every change.
+// Updates are dropped when the channel is full; Progress always returns
+// the latest.
+func (e *executor) Updates() <-chan Progress {
+	return e.updates
+}
+
+// Pause cancels the live child order and holds the schedule until Resume.
+// Paused time does not count towards the execution window.
+func (e *executor) Pause() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.progress.State != StateRunning {
+		return
+	}
+	e.pausedSince = time.Now()
+	e.setStateLocked(StatePaused)
+}
+
+// Resume continues a paused execution.
+func (e *executor) Resume() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.progress.State != StatePaused {
+		return
+	}
+	e.pausedTotal += time.Since(e.pausedSince)
+	e.setStateLocked(StateRunning)
+}
+
+// Cancel stops the execution. The live child order is cancelled by the
+// running algorithm, which then returns ErrCancelled.
+func (e *executor) Cancel() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.progress.State.Done() {
+		return
+	}
+	e.setStateLocked(StateCancelled)
+}
+
+// setStateLocked changes the state and wakes up waiters. The caller holds
+// e.mu.
+func (e *executor) setStateLocked(state State) {
+	e.progress.State = state
+	e.progress.UpdatedAt = time.Now()
+	close(e.interrupt)
+	e.interrupt = make(chan struct{})
+	e.emitLocked()
+}
+
+func (e *executor) emitLocked() {
+	select {
+	case e.updates <- e.progress:
+	default:
+	}
+}
+
+func (e *executor) start() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.progress.StartedAt = time.Now()
+	e.progress.UpdatedAt = e.progress.StartedAt
+	e.emitLocked()
+}
+
+// finish moves a running execution to its final state.
+func (e *executor) finish() State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.progress.State.Done() {
+		return e.progress.State
+	}
+	if e.remainingLocked() <= e.dust() {
+		e.setStateLocked(StateCompleted)
+	} else {
+		e.setStateLocked(StateExpired)
+	}
+	return e.progress.State
+}
+
+func (e *executor) remaining() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.remainingLocked()
+}
+
+func (e *executor) remainingLocked() float64 {
+	return math.Max(e.cfg.Quantity-e.progress.Filled, 0)
+}
+
+// dust is the smallest amount that can be expressed with the amount
+// precision; anything left below it cannot be traded.
+func (e *executor) dust() float64 {
+	return math.Pow10(-e.cfg.AmountPrecision) / 2
+}
+
+// paused returns the total paused time so far, including a pause in
+// progress.
+func (e *executor) paused() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.progress.State == StatePaused {
+		return e.pausedTotal + time.Since(e.pausedSince)
+	}
+	return e.pausedTotal
+}
+
+// waitRunning blocks while the execution is paused. It returns
+// ErrCancelled once cancelled.
+func (e *executor) waitRunning(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		state, interrupt := e.progress.State, e.interrupt
+		e.mu.Unlock()
+
+		switch state {
+		case StateRunning:
+			return nil
+		case StatePaused:
+		default:
+			return ErrCancelled
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-interrupt:
+		}
+	}
+}
+
+// sleepUntil waits until the schedule time at, shifted by the time spent
+// paused. It returns early with ErrCancelled once cancelled.
+func (e *executor) sleepUntil(ctx context.Context, at time.Time) error {
+	for {
+		if err := e.waitRunning(ctx); err != nil {
+			return err
+		}
+		delay := time.Until(at.Add(e.paused()))
+		if delay <= 0 {
+			return nil
+		}
+
+		e.mu.Lock()
+		interrupt := e.interrupt
+		e.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-interrupt:
+			timer.Stop()
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// sleep waits for d, or less if the state changes. It returns ErrCancelled
+// once cancelled.
+func (e *executor) sleep(ctx context.Context, d time.Duration) error {
+	e.mu.Lock()
+	interrupt := e.interrupt
+	e.mu.Unlock()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-interrupt:
+	case <-timer.C:
+	}
+	return e.waitRunning(ctx)
+}
+
+func (e *executor) recordError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.progress.Errors++
+	e.progress.LastErr = err
+	e.progress.UpdatedAt = time.Now()
+	e.emitLocked()
+	e.c.Logger.Warn("Orbix execution child order failed", "pair", e.cfg.Pair, "error", err)
+}
+
+// recordFill adds a fill of amount at price.
+func (e *executor) recordFill(amount float64, price float64) {
+	if amount <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.progress.Filled += amount
+	e.notional += amount * price
+	e.progress.AveragePrice = e.notional / e.progress.Filled
+	e.progress.UpdatedAt = time.Now()
+	e.emitLocked()
+}
+
+// bookTop returns the best bid and ask.
+func (e *executor) bookTop(ctx context.Context) (bid float64, ask float64, err error) {
+	book, err := e.c.NewOrderbookService(e.cfg.Pair).Do(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read order book: %w", err)
+	}
+	if len(book.Bids) > 0 {
+		if bid, err = api.ParseFloat(book.Bids[0].Price); err != nil {
+			return 0, 0, fmt.Errorf("invalid best bid: %w", err)
+		}
+	}
+	if len(book.Asks) > 0 {
+		if ask, err = api.ParseFloat(book.Asks[0].Price); err != nil {
+			return 0, 0, fmt.Errorf("invalid best ask: %w", err)
+		}
+	}
+	return bid, ask, nil
+}
+
+// childPrice returns the price of the next child order: pegged to the same
+// side of the book, or crossing the spread when aggressive, and never worse
+// than the configured limit price.
+func (e *executor) childPrice(ctx context.Context, aggressive bool) (float64, error) {
+	bid, ask, err := e.bookTop(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var price float64
+	if e.cfg.Side == api.SideTypeBuy {
+		if aggressive {
+			price = ask
+		} else if price = bid + e.cfg.PegOffset; ask > 0 && price >= ask {
+			price = bid
+		}
+	} else {
+		if aggressive {
+			price = bid
+		} else if price = ask - e.cfg.PegOffset; bid > 0 && price <= bid {
+			price = ask
+		}
+	}
+	if price <= 0 {
+		return 0, ErrEmptyBook
+	}
+	return e.boundPrice(price), nil
+}
+
+// boundPrice caps price at the configured limit price.
+func (e *executor) boundPrice(price float64) float64 {
+	if e.cfg.LimitPrice <= 0 {
+		return price
+	}
+	if e.cfg.Side == api.SideTypeBuy {
+		return math.Min(price, e.cfg.LimitPrice)
+	}
+	return math.Max(price, e.cfg.LimitPrice)
+}
+
+// runChild places a child order of amount and works it until it fills,
+// until is reached, or the execution is paused or cancelled. The child is
+// then cancelled and its fills recorded. It returns the filled amount.
+func (e *executor) runChild(ctx context.Context, amount float64, aggressive bool, until time.Time) (float64, error) {
+	amount = e.childAmount(amount)
+	if amount == 0 {
+		return 0, nil
+	}
+	price, err := e.childPrice(ctx, aggressive)
+	if err != nil {
+		return 0, err
+	}
+	return e.workChild(ctx, amount, price, until)
+}
+
+// childAmount rounds amount down to the amount precision and the remaining
+// quantity. It returns zero for amounts too small to place.
+func (e *executor) childAmount(amount float64) float64 {
+	amount = floorTo(math.Min(amount, e.remaining()), e.cfg.AmountPrecision)
+	if amount <= 0 || amount < e.cfg.MinChildAmount {
+		return 0
+	}
+	return amount
+}
+
+// workChild places a child order at price and works it as runChild does.
+// A zero until waits for the child to fill or the state to change.
+func (e *executor) workChild(ctx context.Context, amount float64, price float64, until time.Time) (float64, error) {
+	priceStr := strconv.FormatFloat(price, 'f', e.cfg.PricePrecision, 64)
+	amountStr := strconv.FormatFloat(amount, 'f', e.cfg.AmountPrecision, 64)
+
+	res, err := e.c.NewPlaceOrderService(api.NewClientOrderId(), e.cfg.Pair, e.cfg.Side, api.OrderTypeLimit, priceStr, amountStr).
+		Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to place child order: %w", err)
+	}
+	e.mu.Lock()
+	e.progress.ChildOrders++
+	interrupt := e.interrupt
+	e.mu.Unlock()
+
+	orderId := strconv.Itoa(res.Order.ID)
+	e.watchChild(ctx, orderId, until, interrupt)
+	return e.settleChild(ctx, orderId, price)
+}
+
+// watchChild polls a child order until it is no longer open, until is
+// reached, or the state changes.
+func (e *executor) watchChild(ctx context.Context, orderId string, until time.Time, interrupt <-chan struct{}) {
+	ticker := time.NewTicker(e.cfg.PollInterval)
+	defer ticker.Stop()
+	var deadline <-chan time.Time
+	if !until.IsZero() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-interrupt:
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+			order, err := e.c.NewGetOrderByIdService(orderId, e.cfg.Pair).Do(ctx)
+			if err != nil {
+				continue
+			}
+			if e.childPolled != nil {
+				e.childPolled(order)
+			}
+			if order.Status != string(api.OrderStatusOpen) {
+				return
+			}
+		}
+	}
+}
+
+// settleChild cancels a child order, if still open, and records its fills.
+// It runs even when ctx is done so a cancelled execution leaves nothing on
+// the book, retrying the cancel every PollInterval for up to
+// DefaultTimeOut. It returns ErrChildNotSettled if the child is not
+// confirmed closed by then or its fills cannot be read.
+func (e *executor) settleChild(ctx context.Context, orderId string, price float64) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), api.DefaultTimeOut)
+	defer cancel()
+
+	var order *api.Order
+	var err error
+	for {
+		order, err = e.c.NewGetOrderByIdService(orderId, e.cfg.Pair).Do(ctx)
+		if err == nil && order.Status == string(api.OrderStatusOpen) {
+			if err = e.c.NewCancelOrderService(orderId, e.cfg.Pair).Do(ctx); err == nil {
+				order, err = e.c.NewGetOrderByIdService(orderId, e.cfg.Pair).Do(ctx)
+			}
+			if err == nil && order.Status == string(api.OrderStatusOpen) {
+				err = errors.New("still open after cancel")
+			}
+		}
+		// An empty amount would read as zero and book the whole child as
+		// filled, so it is polled again like an open child.
+		if err == nil && (strings.TrimSpace(order.Amount) == "" || strings.TrimSpace(order.RemainingAmount) == "") {
+			err = errors.New("no amount or remaining amount")
+		}
+		if err == nil {
+			break
+		}
+		e.c.Logger.Warn("Orbix child order not settled, retrying", "orderId", orderId, "error", err)
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("%w: order %s: %w", ErrChildNotSettled, orderId, err)
+		case <-time.After(e.cfg.PollInterval):
+		}
+	}
+
+	// Unreadable fills would let the execution overfill, so they stop it
+	// like an open child does.
+	amount, err := api.ParseFloat(order.Amount)
+	if err != nil {
+		return 0, fmt.Errorf("%w: order %s: %w", ErrChildNotSettled, orderId, err)
+	}
+	remaining, err := api.ParseFloat(order.RemainingAmount)
+	if err != nil {
+		return 0, fmt.Errorf("%w: order %s: %w", ErrChildNotSettled, orderId, err)
+	}
+	avg, err := api.ParseFloat(order.AveragePrice)
+	if err != nil {
+		return 0, fmt.Errorf("%w: order %s: %w", ErrChildNotSettled, orderId, err)
+	}
+	if avg > 0 {
+		price = avg
+	}
+	filled := amount - remaining
+	e.recordFill(filled, price)
+	return filled, nil
+}
+
+// floorTo rounds x down to prec decimals.
+func floorTo(x float64, prec int) float64 {
+	p := math.Pow10(prec)
+	// Nudge up before flooring so 0.3 stays 0.3 despite binary rounding.
+	return math.Floor(x*p+1e-9) / p
+}
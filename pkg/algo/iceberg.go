@@ -0,0 +1,174 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// IcebergConfig describes an iceberg order.
+type IcebergConfig struct {
+	ExecutionConfig
+	// Price is the limit price of every slice. When zero, slices are pegged
+	// to the book as ExecutionConfig.PegOffset describes.
+	Price float64
+	// VisibleAmount is the size of the slice shown on the book.
+	VisibleAmount float64
+	// SizeJitter randomizes each slice size by up to this fraction of
+	// VisibleAmount, 0.2 = ±20%.
+	SizeJitter float64
+	// PriceJitter moves each slice up to this far away from the price,
+	// never towards the other side of the book.
+	PriceJitter float64
+}
+
+func (cfg *IcebergConfig) validate() error {
+	if cfg.VisibleAmount <= 0 {
+		return fmt.Errorf("%w: visible amount must be positive", ErrInvalidConfig)
+	}
+	if cfg.Price < 0 || cfg.PriceJitter < 0 || cfg.SizeJitter < 0 || cfg.SizeJitter >= 1 {
+		return fmt.Errorf("%w: invalid price, price jitter or size jitter", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Iceberg emulates an iceberg order: only one slice of the quantity rests
+// on the book at a time and a new slice replaces it once it has filled.
+type Iceberg struct {
+	*executor
+	cfg IcebergConfig
+	// visible is the unfilled size of the slice on the book and
+	// sliceFilled what the slice has filled but not yet recorded, both
+	// guarded by mu.
+	visible     float64
+	sliceFilled float64
+}
+
+func NewIceberg(c *api.Client, cfg IcebergConfig) (*Iceberg, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	e, err := newExecutor(c, cfg.ExecutionConfig)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ExecutionConfig = e.cfg
+	i := &Iceberg{executor: e, cfg: cfg}
+	e.childPolled = i.childPolled
+	return i, nil
+}
+
+// Visible returns the unfilled size of the slice currently on the book, as
+// of the last poll.
+func (i *Iceberg) Visible() float64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.visible
+}
+
+// Hidden returns the unfilled quantity not shown on the book.
+func (i *Iceberg) Hidden() float64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return math.Max(i.remainingLocked()-i.sliceFilled-i.visible, 0)
+}
+
+// Run shows slices until the quantity is filled or the execution is
+// cancelled, in which case it returns ErrCancelled. A pause takes the
+// visible slice off the book.
+func (i *Iceberg) Run(ctx context.Context) error {
+	i.start()
+	for i.remaining() > i.dust() {
+		if err := i.waitRunning(ctx); err != nil {
+			return err
+		}
+
+		amount := i.childAmount(i.cfg.VisibleAmount * (1 + i.cfg.SizeJitter*(2*rand.Float64()-1)))
+		if amount == 0 {
+			// The remainder is below the minimum slice: show it all.
+			if amount = i.childAmount(i.remaining()); amount == 0 {
+				break
+			}
+		}
+		price, err := i.slicePrice(ctx)
+		if err == nil {
+			i.setVisible(amount)
+			_, err = i.workChild(ctx, amount, price, time.Time{})
+			i.setVisible(0)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			i.recordError(err)
+			if errors.Is(err, ErrChildNotSettled) {
+				return err
+			}
+			if err := i.sleep(ctx, i.cfg.PollInterval); err != nil {
+				return err
+			}
+		}
+	}
+
+	if i.finish() == StateCancelled {
+		return ErrCancelled
+	}
+	return nil
+}
+
+// slicePrice returns the price of the next slice, moved away from the
+// other side of the book by a random part of PriceJitter.
+func (i *Iceberg) slicePrice(ctx context.Context) (float64, error) {
+	price := i.cfg.Price
+	if price == 0 {
+		var err error
+		if price, err = i.childPrice(ctx, false); err != nil {
+			return 0, err
+		}
+	}
+	offset := i.cfg.PriceJitter * rand.Float64()
+	if i.cfg.Side == api.SideTypeBuy {
+		price -= offset
+	} else {
+		price += offset
+	}
+	if price <= 0 {
+		return 0, fmt.Errorf("%w: slice price %v is not positive", ErrInvalidConfig, price)
+	}
+	return i.boundPrice(price), nil
+}
+
+func (i *Iceberg) setVisible(amount float64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.visible = amount
+	i.sliceFilled = 0
+}
+
+// childPolled updates the visible slice from a poll of its order, so
+// partial fills show up before the slice is settled. A poll without an
+// amount or remaining amount is skipped: read as zero it would show the
+// slice as filled.
+func (i *Iceberg) childPolled(order *api.Order) {
+	if strings.TrimSpace(order.Amount) == "" || strings.TrimSpace(order.RemainingAmount) == "" {
+		return
+	}
+	amount, err := api.ParseFloat(order.Amount)
+	if err != nil {
+		return
+	}
+	remaining, err := api.ParseFloat(order.RemainingAmount)
+	if err != nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.visible = remaining
+	i.sliceFilled = amount - remaining
+}
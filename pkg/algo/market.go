@@ -0,0 +1,253 @@
+package algo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// Default Constants
+const (
+	DefaultProfileDays = 5
+	// aggTradesPage is the largest page of aggregate trades one request
+	// returns.
+	aggTradesPage = 1000
+	klinesPage    = 1000
+)
+
+// klineIntervals are the supported kline intervals, shortest first.
+var klineIntervals = []struct {
+	name string
+	d    time.Duration
+}{
+	{"1m", time.Minute},
+	{"3m", 3 * time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"2h", 2 * time.Hour},
+	{"4h", 4 * time.Hour},
+	{"6h", 6 * time.Hour},
+	{"12h", 12 * time.Hour},
+	{"1d", 24 * time.Hour},
+}
+
+// klineInterval returns the longest kline interval that fits in bucket.
+func klineInterval(bucket time.Duration) (string, time.Duration) {
+	name, d := klineIntervals[0].name, klineIntervals[0].d
+	for _, iv := range klineIntervals {
+		if iv.d > bucket {
+			break
+		}
+		name, d = iv.name, iv.d
+	}
+	return name, d
+}
+
+// VolumeProfile is the average market volume of consecutive time buckets
+// at the same time of day over past days.
+type VolumeProfile struct {
+	Bucket  time.Duration
+	Volumes []float64
+}
+
+// Weights returns each bucket's share of the total volume. With no volume
+// at all the buckets are weighted evenly.
+func (p VolumeProfile) Weights() []float64 {
+	weights := make([]float64, len(p.Volumes))
+	var total float64
+	for _, v := range p.Volumes {
+		total += v
+	}
+	for i, v := range p.Volumes {
+		if total > 0 {
+			weights[i] = v / total
+		} else {
+			weights[i] = 1 / float64(len(weights))
+		}
+	}
+	return weights
+}
+
+// LoadVolumeProfile builds the volume profile of buckets intervals of
+// bucket length starting at the time of day of start, averaged over the
+// previous days from klines.
+func LoadVolumeProfile(ctx context.Context, c *api.Client, symbol string, start time.Time, bucket time.Duration, buckets int, days int) (VolumeProfile, error) {
+	profile := VolumeProfile{Bucket: bucket, Volumes: make([]float64, buckets)}
+	interval, step := klineInterval(bucket)
+	window := bucket * time.Duration(buckets)
+
+	for d := 1; d <= days; d++ {
+		dayStart := start.AddDate(0, 0, -d)
+		from, to := dayStart, dayStart.Add(window)
+		for from.Before(to) {
+			klines, err := c.NewKlineService().Symbol(symbol).Interval(interval).
+				StartTime(from.UnixMilli()).EndTime(to.UnixMilli() - 1).Limit(klinesPage).
+				Do(ctx)
+			if err != nil {
+				return VolumeProfile{}, fmt.Errorf("failed to load klines of %s: %w", symbol, err)
+			}
+			if len(klines) == 0 {
+				break
+			}
+			for _, k := range klines {
+				i := int(time.UnixMilli(k.OpenTime).Sub(dayStart) / bucket)
+				if i < 0 || i >= buckets {
+					continue
+				}
+				volume, err := api.ParseFloat(k.Volume)
+				if err != nil {
+					return VolumeProfile{}, fmt.Errorf("invalid kline volume of %s: %w", symbol, err)
+				}
+				profile.Volumes[i] += volume
+			}
+			from = time.UnixMilli(klines[len(klines)-1].OpenTime).Add(step)
+		}
+	}
+	if days > 0 {
+		for i := range profile.Volumes {
+			profile.Volumes[i] /= float64(days)
+		}
+	}
+	return profile, nil
+}
+
+// tradeTape follows the aggregate trades of a symbol, accumulating volume
+// and notional.
+type tradeTape struct {
+	c      *api.Client
+	symbol string
+	lastId int64
+
+	volume   float64
+	notional float64
+}
+
+// newTradeTape starts following trades after those already printed.
+func newTradeTape(ctx context.Context, c *api.Client, symbol string) (*tradeTape, error) {
+	t := &tradeTape{c: c, symbol: symbol, lastId: -1}
+	trades, err := c.NewAggregateTradeService().Symbol(symbol).Limit(1).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trades of %s: %w", symbol, err)
+	}
+	if len(trades) > 0 {
+		t.lastId = trades[len(trades)-1].AggregateTradeID
+	}
+	return t, nil
+}
+
+// poll reads the trades printed since the last poll and returns their
+// volume.
+func (t *tradeTape) poll(ctx context.Context) (float64, error) {
+	var volume float64
+	for {
+		trades, err := t.c.NewAggregateTradeService().Symbol(t.symbol).FromId(t.lastId + 1).Limit(aggTradesPage).Do(ctx)
+		if err != nil {
+			return volume, fmt.Errorf("failed to read trades of %s: %w", t.symbol, err)
+		}
+		for _, trade := range trades {
+			qty, price, err := tradeAmounts(trade)
+			if err != nil {
+				return volume, fmt.Errorf("invalid trade of %s: %w", t.symbol, err)
+			}
+			volume += qty
+			t.volume += qty
+			t.notional += qty * price
+			t.lastId = trade.AggregateTradeID
+		}
+		if len(trades) < aggTradesPage {
+			return volume, nil
+		}
+	}
+}
+
+// vwap returns the volume-weighted price of all trades seen.
+func (t *tradeTape) vwap() float64 {
+	if t.volume == 0 {
+		return 0
+	}
+	return t.notional / t.volume
+}
+
+// MarketVWAP returns the volume-weighted average price and volume of all
+// trades of symbol between from and to.
+func MarketVWAP(ctx context.Context, c *api.Client, symbol string, from time.Time, to time.Time) (vwap float64, volume float64, err error) {
+	var notional float64
+	next := c.NewAggregateTradeService().Symbol(symbol).StartTime(from.UnixMilli()).EndTime(to.UnixMilli())
+	for {
+		trades, err := next.Limit(aggTradesPage).Do(ctx)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read trades of %s: %w", symbol, err)
+		}
+		var done bool
+		for _, trade := range trades {
+			if trade.Timestamp > to.UnixMilli() {
+				done = true
+				break
+			}
+			qty, price, err := tradeAmounts(trade)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid trade of %s: %w", symbol, err)
+			}
+			volume += qty
+			notional += qty * price
+		}
+		if done || len(trades) < aggTradesPage {
+			break
+		}
+		next = c.NewAggregateTradeService().Symbol(symbol).FromId(trades[len(trades)-1].AggregateTradeID + 1)
+	}
+	if volume == 0 {
+		return 0, 0, nil
+	}
+	return notional / volume, volume, nil
+}
+
+// Report is the completion report of an execution.
+type Report struct {
+	Progress
+	EndedAt time.Time
+	// BenchmarkVWAP is the market VWAP over the execution, zero if no trade
+	// printed or it could not be read.
+	BenchmarkVWAP float64
+	MarketVolume  float64
+	// SlippageBps is how much worse than the benchmark the fills were, in
+	// basis points. Negative means better.
+	SlippageBps float64
+	// Participation is the filled share of the market volume.
+	Participation float64
+}
+
+func (e *executor) report(benchmark float64, marketVolume float64) *Report {
+	p := e.Progress()
+	r := &Report{
+		Progress:      p,
+		EndedAt:       p.UpdatedAt,
+		BenchmarkVWAP: benchmark,
+		MarketVolume:  marketVolume,
+	}
+	if benchmark > 0 && p.Filled > 0 {
+		r.SlippageBps = (p.AveragePrice - benchmark) / benchmark * 1e4
+		if e.cfg.Side == api.SideTypeSell {
+			r.SlippageBps = -r.SlippageBps
+		}
+	}
+	if marketVolume > 0 {
+		r.Participation = p.Filled / marketVolume
+	}
+	return r
+}
+
+// tradeAmounts parses the quantity and price of an aggregate trade.
+func tradeAmounts(trade api.AggregateTrade) (qty float64, price float64, err error) {
+	if qty, err = api.ParseFloat(trade.Quantity); err != nil {
+		return 0, 0, err
+	}
+	if price, err = api.ParseFloat(trade.Price); err != nil {
+		return 0, 0, err
+	}
+	return qty, price, nil
+}
@@ -0,0 +1,157 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// DefaultPOVInterval is how often a POV execution measures market volume.
+const DefaultPOVInterval = 10 * time.Second
+
+// POVConfig describes a percent-of-volume execution.
+type POVConfig struct {
+	ExecutionConfig
+	// Symbol is the market data symbol of the pair. Defaults to Pair.
+	Symbol string
+	// Participation is the target share of the market volume, fills
+	// included, 0.1 = 10%.
+	Participation float64
+	// Interval is how often market volume is measured and a child order
+	// sized. Defaults to DefaultPOVInterval.
+	Interval time.Duration
+	// MaxChildAmount caps each child order. Zero means no cap.
+	MaxChildAmount float64
+	// MaxDuration ends the execution after this long, paused time excluded.
+	// Zero runs until the quantity is filled or the execution is cancelled.
+	MaxDuration time.Duration
+}
+
+func (cfg *POVConfig) validate() error {
+	if cfg.Participation <= 0 || cfg.Participation >= 1 {
+		return fmt.Errorf("%w: participation must be in (0, 1)", ErrInvalidConfig)
+	}
+	if cfg.MaxChildAmount < 0 || cfg.MaxDuration < 0 {
+		return fmt.Errorf("%w: negative maximum child amount or duration", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// POV follows the aggregate trades of the market and keeps the filled
+// quantity at a fixed share of the volume traded since the start. Volume
+// traded while paused does not count.
+type POV struct {
+	*executor
+	cfg    POVConfig
+	report *Report
+}
+
+func NewPOV(c *api.Client, cfg POVConfig) (*POV, error) {
+	if cfg.Symbol == "" {
+		cfg.Symbol = cfg.Pair
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultPOVInterval
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	e, err := newExecutor(c, cfg.ExecutionConfig)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ExecutionConfig = e.cfg
+	return &POV{executor: e, cfg: cfg}, nil
+}
+
+// Run works the quantity until it is filled, MaxDuration has passed, or
+// the execution is cancelled, in which case it returns ErrCancelled. The
+// completion report is built from the trades observed meanwhile.
+func (p *POV) Run(ctx context.Context) error {
+	tape, err := newTradeTape(ctx, p.c, p.cfg.Symbol)
+	if err != nil {
+		return err
+	}
+
+	err = p.run(ctx, tape)
+
+	report := p.executor.report(tape.vwap(), tape.volume)
+	p.mu.Lock()
+	p.report = report
+	p.mu.Unlock()
+	return err
+}
+
+func (p *POV) run(ctx context.Context, tape *tradeTape) error {
+	p.start()
+	start := time.Now()
+
+	// Our own fills print on the tape too, so the volume owed is sized
+	// against the rest of the market: filled = rate * (other + filled).
+	rate := p.cfg.Participation / (1 - p.cfg.Participation)
+	var excluded float64
+
+	for p.remaining() > p.dust() {
+		paused := p.paused()
+		if err := p.waitRunning(ctx); err != nil {
+			return err
+		}
+		if p.paused() != paused {
+			// Drop what traded while paused.
+			vol, err := tape.poll(ctx)
+			if err != nil {
+				p.recordError(err)
+			}
+			excluded += vol
+		}
+		if p.cfg.MaxDuration > 0 && time.Since(start)-p.paused() >= p.cfg.MaxDuration {
+			break
+		}
+
+		until := time.Now().Add(p.cfg.Interval)
+		if _, err := tape.poll(ctx); err != nil {
+			p.recordError(err)
+			if err := p.sleep(ctx, time.Until(until)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		filled := p.cfg.Quantity - p.remaining()
+		other := math.Max(tape.volume-excluded-filled, 0)
+		owed := rate*other - filled
+		if p.cfg.MaxChildAmount > 0 {
+			owed = math.Min(owed, p.cfg.MaxChildAmount)
+		}
+		if owed > p.dust() {
+			if _, err := p.runChild(ctx, owed, false, until); err != nil {
+				p.recordError(err)
+				if errors.Is(err, ErrChildNotSettled) {
+					return err
+				}
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+		if err := p.sleep(ctx, time.Until(until)); err != nil {
+			return err
+		}
+	}
+
+	if p.finish() == StateCancelled {
+		return ErrCancelled
+	}
+	return nil
+}
+
+// Report returns the completion report, nil until Run has returned.
+func (p *POV) Report() *Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.report
+}
@@ -0,0 +1,86 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// slice is one scheduled child order.
+type slice struct {
+	// at is the offset of the slice from the start of the execution.
+	at     time.Duration
+	amount float64
+	// limit caps the child order of the slice, catch-up included. Zero
+	// means no cap.
+	limit float64
+}
+
+// runSchedule works slices over a window of duration. Each child lives
+// until the next slice starts; whatever it did not fill is carried over to
+// the next slice. With finishAggressively the last child crosses the
+// spread. It stops with ErrChildNotSettled when a child may still be on
+// the book.
+func (e *executor) runSchedule(ctx context.Context, slices []slice, duration time.Duration, finishAggressively bool) error {
+	e.start()
+	start := time.Now()
+	end := start.Add(duration)
+
+	var planned float64
+	for i, s := range slices {
+		planned += s.amount
+		if err := e.sleepUntil(ctx, start.Add(s.at)); err != nil {
+			return err
+		}
+
+		until := end
+		if i+1 < len(slices) {
+			until = start.Add(slices[i+1].at)
+		}
+		last := i == len(slices)-1
+
+		// Work the slice until its time is up, re-placing the child after a
+		// pause, so the catch-up amount reflects everything filled so far.
+		for {
+			if err := e.waitRunning(ctx); err != nil {
+				return err
+			}
+			deadline := until.Add(e.paused())
+			if !time.Now().Before(deadline) {
+				break
+			}
+			target := planned - (e.cfg.Quantity - e.remaining())
+			if s.limit > 0 {
+				target = math.Min(target, s.limit)
+			}
+			if target <= e.dust() {
+				break
+			}
+			if _, err := e.runChild(ctx, target, last && finishAggressively, deadline); err != nil {
+				e.recordError(err)
+				if errors.Is(err, ErrChildNotSettled) {
+					return err
+				}
+				if err := e.sleep(ctx, e.cfg.PollInterval); err != nil {
+					return err
+				}
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if e.Progress().State != StatePaused {
+				break
+			}
+		}
+		if e.remaining() <= e.dust() {
+			break
+		}
+	}
+
+	if e.finish() == StateCancelled {
+		return ErrCancelled
+	}
+	return nil
+}
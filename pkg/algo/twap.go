@@ -0,0 +1,96 @@
+package algo
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// TWAPConfig describes a time-weighted average price execution.
+type TWAPConfig struct {
+	ExecutionConfig
+	// Duration is the execution window.
+	Duration time.Duration
+	// Slices is the number of child orders the quantity is split into.
+	Slices int
+	// SizeJitter randomizes each slice size by up to this fraction of the
+	// even size, 0.2 = ±20%. The sizes still add up to the quantity.
+	SizeJitter float64
+	// TimeJitter randomizes each slice start by up to this fraction of the
+	// slice interval, 0.5 = ±25% of the interval.
+	TimeJitter float64
+	// FinishAggressively crosses the spread with the last slice so the
+	// quantity is done by the end of the window.
+	FinishAggressively bool
+}
+
+func (cfg *TWAPConfig) validate() error {
+	if cfg.Duration <= 0 || cfg.Slices <= 0 {
+		return fmt.Errorf("%w: duration and slices must be positive", ErrInvalidConfig)
+	}
+	if cfg.SizeJitter < 0 || cfg.SizeJitter >= 1 || cfg.TimeJitter < 0 || cfg.TimeJitter > 1 {
+		return fmt.Errorf("%w: size jitter must be in [0, 1) and time jitter in [0, 1]", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// TWAP splits a parent quantity into child orders spread evenly over a
+// time window. Each child is a limit order pegged to the book that lives
+// until the next slice starts; whatever it did not fill is carried over to
+// the next slice.
+type TWAP struct {
+	*executor
+	cfg    TWAPConfig
+	slices []slice
+}
+
+func NewTWAP(c *api.Client, cfg TWAPConfig) (*TWAP, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	e, err := newExecutor(c, cfg.ExecutionConfig)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ExecutionConfig = e.cfg
+	return &TWAP{
+		executor: e,
+		cfg:      cfg,
+		slices:   planTWAP(cfg),
+	}, nil
+}
+
+// planTWAP returns the jittered slice schedule. Offsets are relative to the
+// start and non-decreasing; amounts add up to the quantity.
+func planTWAP(cfg TWAPConfig) []slice {
+	n := cfg.Slices
+	interval := cfg.Duration / time.Duration(n)
+	slices := make([]slice, n)
+
+	var total float64
+	for i := range slices {
+		slices[i].amount = 1 + cfg.SizeJitter*(2*rand.Float64()-1)
+		total += slices[i].amount
+	}
+	for i := range slices {
+		slices[i].amount *= cfg.Quantity / total
+
+		at := time.Duration(i) * interval
+		if i > 0 {
+			at += time.Duration(cfg.TimeJitter * (rand.Float64() - 0.5) * float64(interval))
+			at = max(at, slices[i-1].at)
+		}
+		slices[i].at = at
+	}
+	return slices
+}
+
+// Run executes the schedule and returns when the window has ended, the
+// quantity is filled, or the execution is cancelled, in which case it
+// returns ErrCancelled. Check Progress for the outcome.
+func (t *TWAP) Run(ctx context.Context) error {
+	return t.runSchedule(ctx, t.slices, t.cfg.Duration, t.cfg.FinishAggressively)
+}
@@ -0,0 +1,126 @@
+package algo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// VWAPConfig describes a volume-weighted average price execution.
+type VWAPConfig struct {
+	ExecutionConfig
+	// Symbol is the market data symbol of the pair. Defaults to Pair.
+	Symbol string
+	// Duration is the execution window, starting when the VWAP is created.
+	Duration time.Duration
+	// Slices is the number of equal time buckets of the window.
+	Slices int
+	// ProfileDays is the number of past days the volume profile averages.
+	// Defaults to DefaultProfileDays.
+	ProfileDays int
+	// MaxParticipation caps each child at this fraction of the volume the
+	// profile expects in its slice, 0.2 = 20%. Zero means no cap.
+	MaxParticipation float64
+	// FinishAggressively crosses the spread with the last slice.
+	FinishAggressively bool
+}
+
+func (cfg *VWAPConfig) validate() error {
+	if cfg.Duration <= 0 || cfg.Slices <= 0 {
+		return fmt.Errorf("%w: duration and slices must be positive", ErrInvalidConfig)
+	}
+	if cfg.ProfileDays < 0 || cfg.MaxParticipation < 0 || cfg.MaxParticipation > 1 {
+		return fmt.Errorf("%w: invalid profile days or participation cap", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// VWAP splits a parent quantity over a time window in proportion to the
+// market volume historically traded at those times of day, so the fills
+// track the day's volume-weighted average price.
+type VWAP struct {
+	*executor
+	cfg     VWAPConfig
+	profile VolumeProfile
+	slices  []slice
+	report  *Report
+}
+
+// NewVWAP loads the volume profile of the window starting now and plans
+// the slices.
+func NewVWAP(ctx context.Context, c *api.Client, cfg VWAPConfig) (*VWAP, error) {
+	if cfg.Symbol == "" {
+		cfg.Symbol = cfg.Pair
+	}
+	if cfg.ProfileDays == 0 {
+		cfg.ProfileDays = DefaultProfileDays
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	e, err := newExecutor(c, cfg.ExecutionConfig)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ExecutionConfig = e.cfg
+
+	bucket := cfg.Duration / time.Duration(cfg.Slices)
+	profile, err := LoadVolumeProfile(ctx, c, cfg.Symbol, time.Now(), bucket, cfg.Slices, cfg.ProfileDays)
+	if err != nil {
+		return nil, err
+	}
+
+	slices := make([]slice, cfg.Slices)
+	for i, w := range profile.Weights() {
+		slices[i] = slice{
+			at:     time.Duration(i) * bucket,
+			amount: w * cfg.Quantity,
+			limit:  cfg.MaxParticipation * profile.Volumes[i],
+		}
+		if cfg.MaxParticipation > 0 && slices[i].limit == 0 {
+			// No volume expected: stay out rather than trade uncapped.
+			slices[i].limit = e.dust()
+		}
+	}
+
+	return &VWAP{
+		executor: e,
+		cfg:      cfg,
+		profile:  profile,
+		slices:   slices,
+	}, nil
+}
+
+// Profile returns the volume profile the schedule follows.
+func (v *VWAP) Profile() VolumeProfile {
+	return v.profile
+}
+
+// Run executes the schedule like TWAP.Run and then builds the completion
+// report against the market VWAP over the execution.
+func (v *VWAP) Run(ctx context.Context) error {
+	err := v.runSchedule(ctx, v.slices, v.cfg.Duration, v.cfg.FinishAggressively)
+
+	p := v.Progress()
+	reportCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), api.DefaultTimeOut)
+	defer cancel()
+	benchmark, volume, vwapErr := MarketVWAP(reportCtx, v.c, v.cfg.Symbol, p.StartedAt, p.UpdatedAt)
+	if vwapErr != nil {
+		v.c.Logger.Warn("Orbix VWAP benchmark unavailable", "symbol", v.cfg.Symbol, "error", vwapErr)
+	}
+
+	report := v.executor.report(benchmark, volume)
+	v.mu.Lock()
+	v.report = report
+	v.mu.Unlock()
+	return err
+}
+
+// Report returns the completion report, nil until Run has returned.
+func (v *VWAP) Report() *Report {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.report
+}
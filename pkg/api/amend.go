@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrOrderFilledBeforeCancel = errors.New("error: order filled before it could be cancelled")
+
+// DEL + POST Amend order: cancel it and place a replacement
+type AmendOrderService struct {
+	c       *Client
+	orderId string
+	pair    string
+	price   *string
+	amount  *string
+}
+
+type AmendOrderResult struct {
+	// Original is the original order as read after the cancel.
+	Original *Order
+	// Filled is the amount of the original order executed before the cancel.
+	Filled string
+	// Replacement is nil when nothing was left to place.
+	Replacement *Order
+	// FilledBeforeCancel is set when the original order fully filled before
+	// the cancel took effect.
+	FilledBeforeCancel bool
+}
+
+// Price sets the price of the replacement. Defaults to the original price.
+func (s *AmendOrderService) Price(price string) *AmendOrderService {
+	s.price = &price
+	return s
+}
+
+// Amount sets the new total size of the order. The replacement is placed
+// for this amount minus what the original order already filled. Defaults
+// to the original amount, i.e. the replacement carries the unfilled
+// remainder.
+func (s *AmendOrderService) Amount(amount string) *AmendOrderService {
+	s.amount = &amount
+	return s
+}
+
+// Do cancels the order, re-reads it to learn how much is still unfilled
+// and places a replacement for only that quantity, so fills that race with
+// the cancel are never placed twice. It returns ErrOrderFilledBeforeCancel,
+// together with a result describing the original order, when there is
+// nothing left to replace because the order fully filled.
+func (s *AmendOrderService) Do(ctx context.Context, opts ...RequestOption) (res *AmendOrderResult, err error) {
+	cancelErr := s.c.NewCancelOrderService(s.orderId, s.pair).Do(ctx, opts...)
+
+	original, err := s.c.NewGetOrderByIdService(s.orderId, s.pair).Do(ctx, opts...)
+	if err != nil {
+		if cancelErr != nil {
+			return nil, fmt.Errorf("failed to cancel order %s: %w", s.orderId, cancelErr)
+		}
+		return nil, fmt.Errorf("order %s cancelled but could not be re-read: %w", s.orderId, err)
+	}
+
+	// An empty remaining amount is unknown, not zero: reading it as zero
+	// would take the order for filled.
+	if strings.TrimSpace(original.Amount) == "" || strings.TrimSpace(original.RemainingAmount) == "" {
+		return nil, fmt.Errorf("order %s has no amount or remaining amount", s.orderId)
+	}
+	filled, err := SubDecimal(original.Amount, original.RemainingAmount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amounts on order %s: %w", s.orderId, err)
+	}
+	res = &AmendOrderResult{Original: original, Filled: filled}
+
+	if !isPositiveDecimal(original.RemainingAmount) {
+		res.FilledBeforeCancel = true
+		return res, ErrOrderFilledBeforeCancel
+	}
+	if cancelErr != nil {
+		return nil, fmt.Errorf("failed to cancel order %s: %w", s.orderId, cancelErr)
+	}
+	if original.Status == string(OrderStatusOpen) {
+		return nil, fmt.Errorf("order %s still open after cancel", s.orderId)
+	}
+
+	amount := original.RemainingAmount
+	if s.amount != nil {
+		amount, err = SubDecimal(*s.amount, filled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q: %w", *s.amount, err)
+		}
+		if !isPositiveDecimal(amount) {
+			// The fills already reach the requested size.
+			return res, nil
+		}
+	}
+	price := original.Price
+	if s.price != nil {
+		price = *s.price
+	}
+
+	placed, err := s.c.NewPlaceOrderService(NewClientOrderId(), s.pair, original.Side, original.Type, price, amount).
+		Do(ctx, opts...)
+	if err != nil {
+		return res, fmt.Errorf("order %s cancelled but replacement failed: %w", s.orderId, err)
+	}
+	res.Replacement = placed.Order
+	return res, nil
+}
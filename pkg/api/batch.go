@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Batch defaults
+const (
+	DefaultBatchWorkers   = 4
+	DefaultBatchRateLimit = 10 // requests per second
+)
+
+var (
+	ErrBatchSkipped    = errors.New("error: skipped after an earlier failure in the batch")
+	ErrBatchRolledBack = errors.New("error: batch failed and was rolled back")
+)
+
+// OrderSpec describes one order of a batch.
+type OrderSpec struct {
+	Pair   string
+	Side   SideType
+	Type   OrderType
+	Price  string
+	Amount string
+	// ClientOrderId is generated when empty, see NewPlaceOrderService.
+	ClientOrderId string
+}
+
+// OrderRef identifies an existing order.
+type OrderRef struct {
+	OrderId string
+	Pair    string
+}
+
+// BatchResult is the outcome of one batch item. Results are returned in the
+// order of the batch input.
+type BatchResult struct {
+	Index int
+	// Order is the created order; nil for cancellations.
+	Order *Order
+	// Err is nil on success and wraps ErrBatchSkipped when the item was not
+	// attempted.
+	Err error
+	// RolledBack is set when a created order was cancelled again because a
+	// later item failed.
+	RolledBack  bool
+	RollbackErr error
+}
+
+// runBatch calls fn for each of n items on a pool of workers paced by
+// limiter. When stopOnError is set, items not started before the first
+// failure are skipped. It returns the error of each item.
+func runBatch(ctx context.Context, n int, workers int, limiter *rateLimiter, stopOnError bool, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+
+	var failed atomic.Bool
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if stopOnError && failed.Load() {
+					errs[i] = ErrBatchSkipped
+					continue
+				}
+				if err := limiter.wait(ctx); err != nil {
+					errs[i] = err
+					failed.Store(true)
+					continue
+				}
+				if stopOnError && failed.Load() {
+					errs[i] = ErrBatchSkipped
+					continue
+				}
+				if err := fn(ctx, i); err != nil {
+					errs[i] = err
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
+
+// POST Create many orders
+type CreateOrdersBatchService struct {
+	c         *Client
+	specs     []OrderSpec
+	workers   int
+	rateLimit float64
+	atomic    bool
+}
+
+// Workers sets the number of concurrent requests.
+func (s *CreateOrdersBatchService) Workers(n int) *CreateOrdersBatchService {
+	s.workers = n
+	return s
+}
+
+// RateLimit sets the maximum number of requests per second; zero or less
+// disables pacing.
+func (s *CreateOrdersBatchService) RateLimit(perSecond float64) *CreateOrdersBatchService {
+	s.rateLimit = perSecond
+	return s
+}
+
+// Atomic stops the batch at the first failure and cancels the orders that
+// were already created. Orders that partially filled before the rollback
+// keep their fills.
+func (s *CreateOrdersBatchService) Atomic(atomic bool) *CreateOrdersBatchService {
+	s.atomic = atomic
+	return s
+}
+
+// Do places every order and returns one result per spec. The error is nil
+// unless the batch is atomic and failed, in which case it wraps
+// ErrBatchRolledBack and the first failure.
+func (s *CreateOrdersBatchService) Do(ctx context.Context, opts ...RequestOption) (results []BatchResult, err error) {
+	limiter := newRateLimiter(s.rateLimit)
+	results = make([]BatchResult, len(s.specs))
+
+	errs := runBatch(ctx, len(s.specs), s.workers, limiter, s.atomic, func(ctx context.Context, i int) error {
+		spec := s.specs[i]
+		clientOrderId := spec.ClientOrderId
+		if clientOrderId == "" {
+			clientOrderId = NewClientOrderId()
+		}
+		res, err := s.c.NewPlaceOrderService(clientOrderId, spec.Pair, spec.Side, spec.Type, spec.Price, spec.Amount).
+			Do(ctx, opts...)
+		if err != nil {
+			return err
+		}
+		results[i].Order = res.Order
+		return nil
+	})
+
+	var firstErr error
+	for i, err := range errs {
+		results[i].Index = i
+		results[i].Err = err
+		if err != nil && firstErr == nil && !errors.Is(err, ErrBatchSkipped) {
+			firstErr = err
+		}
+	}
+
+	if !s.atomic || firstErr == nil {
+		return results, nil
+	}
+
+	s.rollback(ctx, limiter, results, opts...)
+	return results, fmt.Errorf("%w: %w", ErrBatchRolledBack, firstErr)
+}
+
+// rollback cancels every order created by the batch.
+func (s *CreateOrdersBatchService) rollback(ctx context.Context, limiter *rateLimiter, results []BatchResult, opts ...RequestOption) {
+	var created []int
+	for i := range results {
+		if results[i].Order != nil {
+			created = append(created, i)
+		}
+	}
+
+	// Roll back even if the batch was stopped by a cancelled context.
+	ctx = context.WithoutCancel(ctx)
+	errs := runBatch(ctx, len(created), s.workers, limiter, false, func(ctx context.Context, j int) error {
+		i := created[j]
+		orderId := strconv.Itoa(results[i].Order.ID)
+		return s.c.NewCancelOrderService(orderId, s.specs[i].Pair).Do(ctx, opts...)
+	})
+
+	for j, i := range created {
+		results[i].RolledBack = errs[j] == nil
+		results[i].RollbackErr = errs[j]
+		if errs[j] != nil {
+			s.c.Logger.Error("Orbix batch rollback failed",
+				"orderId", results[i].Order.ID,
+				"error", errs[j],
+			)
+		}
+	}
+}
+
+// DEL Cancel many orders
+type CancelOrdersBatchService struct {
+	c           *Client
+	refs        []OrderRef
+	workers     int
+	rateLimit   float64
+	stopOnError bool
+}
+
+// Workers sets the number of concurrent requests.
+func (s *CancelOrdersBatchService) Workers(n int) *CancelOrdersBatchService {
+	s.workers = n
+	return s
+}
+
+// RateLimit sets the maximum number of requests per second; zero or less
+// disables pacing.
+func (s *CancelOrdersBatchService) RateLimit(perSecond float64) *CancelOrdersBatchService {
+	s.rateLimit = perSecond
+	return s
+}
+
+// StopOnError skips the remaining cancellations after the first failure.
+// Cancellations cannot be rolled back.
+func (s *CancelOrdersBatchService) StopOnError(stop bool) *CancelOrdersBatchService {
+	s.stopOnError = stop
+	return s
+}
+
+// Do cancels every order and returns one result per order reference. The
+// error is nil unless StopOnError is set and a cancellation failed.
+func (s *CancelOrdersBatchService) Do(ctx context.Context, opts ...RequestOption) (results []BatchResult, err error) {
+	limiter := newRateLimiter(s.rateLimit)
+
+	errs := runBatch(ctx, len(s.refs), s.workers, limiter, s.stopOnError, func(ctx context.Context, i int) error {
+		return s.c.NewCancelOrderService(s.refs[i].OrderId, s.refs[i].Pair).Do(ctx, opts...)
+	})
+
+	results = make([]BatchResult, len(s.refs))
+	for i, e := range errs {
+		results[i] = BatchResult{Index: i, Err: e}
+		if e != nil && err == nil && !errors.Is(e, ErrBatchSkipped) {
+			err = e
+		}
+	}
+	if !s.stopOnError {
+		return results, nil
+	}
+	return results, err
+}
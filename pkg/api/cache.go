@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures the response cache for public (unsigned) GET endpoints.
+// Signed endpoints and order lookups are never cached.
+type CacheOptions struct {
+	// DefaultTTL is used for endpoints without an entry in TTLs.
+	// Zero means responses are not stored, but identical in-flight
+	// requests are still coalesced into a single call.
+	DefaultTTL time.Duration
+
+	// TTLs maps an endpoint path, e.g. "/api/v3/exchangeInfo", to its TTL.
+	TTLs map[string]time.Duration
+}
+
+type cacheEntry struct {
+	endpoint string
+	data     []byte
+	expires  time.Time
+}
+
+type inflightCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// responseCache stores responses by method, endpoint and query string and
+// deduplicates concurrent requests for the same key.
+type responseCache struct {
+	mu         sync.Mutex
+	opts       CacheOptions
+	generation uint64
+	entries    map[string]cacheEntry
+	inflight   map[string]*inflightCall
+}
+
+func newResponseCache(opts CacheOptions) *responseCache {
+	return &responseCache{
+		opts:     opts,
+		entries:  make(map[string]cacheEntry),
+		inflight: make(map[string]*inflightCall),
+	}
+}
+
+// cacheable reports whether the request may be served from the cache.
+// Order lookups, e.g. /api/orders/123, are unsigned but read order state,
+// so they are never cached.
+func cacheable(r *request) bool {
+	if r.secType != secTypeNone || r.method != http.MethodGet {
+		return false
+	}
+	id, isOrder := strings.CutPrefix(r.endpoint, "/api/orders/")
+	return !isOrder || id == ""
+}
+
+func cacheKey(r *request) string {
+	return r.method + " " + r.endpoint + "?" + r.query.Encode()
+}
+
+func (rc *responseCache) ttl(endpoint string) time.Duration {
+	if ttl, ok := rc.opts.TTLs[endpoint]; ok {
+		return ttl
+	}
+	return rc.opts.DefaultTTL
+}
+
+// do returns a cached response for r if one is fresh, joins an identical
+// in-flight call if there is one, or starts fetch otherwise. The fetch is
+// shared, so it runs without the cancellation of the caller that started
+// it, bounded by DefaultTimeOut; every caller stops waiting when its own
+// ctx is done.
+func (rc *responseCache) do(ctx context.Context, r *request, fetch func(context.Context) ([]byte, error)) ([]byte, error) {
+	key := cacheKey(r)
+	now := time.Now()
+
+	rc.mu.Lock()
+	if e, ok := rc.entries[key]; ok {
+		if now.Before(e.expires) {
+			rc.mu.Unlock()
+			return e.data, nil
+		}
+		delete(rc.entries, key)
+	}
+	call, ok := rc.inflight[key]
+	if !ok {
+		call = &inflightCall{done: make(chan struct{})}
+		rc.inflight[key] = call
+		go rc.fetch(context.WithoutCancel(ctx), key, r.endpoint, rc.generation, call, fetch)
+	}
+	rc.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch runs a shared call and stores its response.
+func (rc *responseCache) fetch(ctx context.Context, key string, endpoint string, generation uint64, call *inflightCall, fetch func(context.Context) ([]byte, error)) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeOut)
+	defer cancel()
+	call.data, call.err = fetch(ctx)
+
+	rc.mu.Lock()
+	delete(rc.inflight, key)
+	// Skip storing if the cache was invalidated while the call was running.
+	if ttl := rc.ttl(endpoint); call.err == nil && ttl > 0 && generation == rc.generation {
+		rc.entries[key] = cacheEntry{
+			endpoint: endpoint,
+			data:     call.data,
+			expires:  time.Now().Add(ttl),
+		}
+	}
+	rc.mu.Unlock()
+	close(call.done)
+}
+
+// invalidate drops cached entries for the given endpoints, or all entries
+// when no endpoint is given.
+func (rc *responseCache) invalidate(endpoints ...string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.generation++
+	if len(endpoints) == 0 {
+		clear(rc.entries)
+		return
+	}
+	for key, e := range rc.entries {
+		for _, endpoint := range endpoints {
+			if e.endpoint == endpoint {
+				delete(rc.entries, key)
+				break
+			}
+		}
+	}
+}
@@ -57,16 +57,40 @@ func NewClientAuth(apikey string, apiSecret string) ClientAuth {
 type Client struct {
 	ClientAuth
 	HttpClient *http.Client
-	BaseURL    string
 	UserAgent  string
 	Logger     *slog.Logger
+	// BaseURL is the first configured base URL. Assigning it replaces the
+	// configured base URLs from the next request on. It is not updated by
+	// SetBaseURL or SetBaseURLs, and unlike them assigning it is not safe
+	// while requests are in flight.
+	BaseURL    string
+	baseURLs   *baseURLPool
+	hedgeDelay time.Duration
+	cache      *responseCache
+	nonce      *NonceManager
+	placed     *placedOrders
 }
 
 type ClientOptions struct {
 	ClientAuth
-	BaseURL   string
-	UserAgent string
-	Logger    *slog.Logger
+	BaseURL string
+	// BaseURLs lists base URLs in order of preference. Requests fail over
+	// to the next one on connection errors. Takes precedence over BaseURL.
+	BaseURLs []string
+	// HedgeDelay, when positive, sends read-only requests to the next base
+	// URL if no response arrived within the delay.
+	HedgeDelay time.Duration
+	UserAgent  string
+	Logger     *slog.Logger
+	// HttpClient sends the requests. Nil uses http.DefaultClient. Set it to
+	// route requests through another transport, e.g. a paper account.
+	HttpClient *http.Client
+	// Cache enables response caching and request coalescing for public
+	// endpoints. Nil disables it.
+	Cache *CacheOptions
+	// Nonce issues the nonces of signed POST and DELETE requests. Nil uses
+	// an in-memory manager shared by every client with the same API key.
+	Nonce *NonceManager
 }
 
 func newDefaultLogger() *slog.Logger {
@@ -82,6 +106,10 @@ func NewClient(opts ClientOptions) *Client {
 		opts.BaseURL = DefaultBaseURL
 	}
 
+	if len(opts.BaseURLs) == 0 {
+		opts.BaseURLs = []string{opts.BaseURL}
+	}
+
 	if opts.UserAgent == "" {
 		opts.UserAgent = DefaultUserAgent
 	}
@@ -90,16 +118,32 @@ func NewClient(opts ClientOptions) *Client {
 		opts.Logger = newDefaultLogger()
 	}
 
-	return &Client{
+	if opts.Nonce == nil {
+		opts.Nonce = sharedNonceManager(opts.ClientAuth.apiKey)
+	}
+
+	if opts.HttpClient == nil {
+		opts.HttpClient = http.DefaultClient
+	}
+
+	c := &Client{
 		ClientAuth: opts.ClientAuth,
-		HttpClient: http.DefaultClient,
-		BaseURL:    opts.BaseURL,
+		HttpClient: opts.HttpClient,
 		UserAgent:  opts.UserAgent,
 		Logger:     opts.Logger,
+		BaseURL:    opts.BaseURLs[0],
+		baseURLs:   newBaseURLPool(opts.BaseURLs...),
+		hedgeDelay: opts.HedgeDelay,
+		nonce:      opts.Nonce,
+		placed:     newPlacedOrders(),
 	}
+	if opts.Cache != nil {
+		c.cache = newResponseCache(*opts.Cache)
+	}
+	return c
 }
 
-// parseRequest prepares the request and constructs the full URL.
+// parseRequest prepares the request headers and query.
 func (c *Client) parseRequest(r *request, opts ...RequestOption) (err error) {
 	// Set request options from user
 	for _, opt := range opts {
@@ -115,8 +159,6 @@ func (c *Client) parseRequest(r *request, opts ...RequestOption) (err error) {
 		return err
 	}
 
-	c.buildFullURL(r)
-
 	return nil
 }
 
@@ -140,8 +182,21 @@ func (c *Client) buildHeader(r *request) error {
 		if err != nil {
 			return fmt.Errorf("err building header: %w", err)
 		}
+		if p == nil {
+			p = make(params)
+		}
+
+		// Every signed write carries a fresh nonce
+		nonce, err := c.nonce.Next()
+		if err != nil {
+			return fmt.Errorf("err issuing nonce: %w", err)
+		}
+		p["nonce"] = nonce
+		r.bodyBuffer, err = json.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("err marshalling JSON: %w", err)
+		}
 
-		r.body = bytes.NewBuffer(r.bodyBuffer)
 		signature, err := Sign(c.ClientAuth.apiSecret, p)
 		if err != nil {
 			return fmt.Errorf("error signing payload: %w", err)
@@ -153,10 +208,10 @@ func (c *Client) buildHeader(r *request) error {
 	return nil
 }
 
-// Constructs the full URL for the request.
-func (c *Client) buildFullURL(r *request) {
+// Constructs the full URL for the request against baseURL.
+func buildFullURL(baseURL string, r *request) string {
 	var sb strings.Builder
-	sb.WriteString(c.BaseURL)
+	sb.WriteString(baseURL)
 	sb.WriteString(r.endpoint)
 
 	// Encode the query parameters
@@ -165,7 +220,7 @@ func (c *Client) buildFullURL(r *request) {
 		sb.WriteString("?")
 		sb.WriteString(queryString)
 	}
-	r.fullURL = sb.String()
+	return sb.String()
 }
 
 func (c *Client) callAPI(ctx context.Context, r *request, opts ...RequestOption) (data []byte, err error) {
@@ -173,19 +228,37 @@ func (c *Client) callAPI(ctx context.Context, r *request, opts ...RequestOption)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse request: %w", err)
 	}
-	req, err := http.NewRequestWithContext(ctx, r.method, r.fullURL, r.body)
-	req.Header = r.header
 
-	fmt.Printf("\n\n<request>\n%+v\n</request>\n\n", req)
+	if c.cache != nil && cacheable(r) {
+		return c.cache.do(ctx, r, func(ctx context.Context) ([]byte, error) {
+			return c.doWithFailover(ctx, r)
+		})
+	}
+	return c.doWithFailover(ctx, r)
+}
+
+// doRequest sends a parsed request to baseURL and returns the response body.
+func (c *Client) doRequest(ctx context.Context, r *request, baseURL string) (data []byte, err error) {
+	fullURL := buildFullURL(baseURL, r)
 
+	var body io.Reader
+	if r.bodyBuffer != nil {
+		body = bytes.NewReader(r.bodyBuffer)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, fullURL, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header = r.header.Clone()
 
 	res, err := c.HttpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		if ctx.Err() == nil {
+			c.baseURLs.mark(baseURL, err)
+		}
+		return nil, &transportError{baseURL: baseURL, err: err}
 	}
+	c.baseURLs.mark(baseURL, nil)
 	defer func() {
 		if cerr := res.Body.Close(); cerr != nil {
 			err = fmt.Errorf("failed to close response body: %w", cerr)
@@ -201,7 +274,7 @@ func (c *Client) callAPI(ctx context.Context, r *request, opts ...RequestOption)
 		"Orbix API Call",
 		slog.String("method", r.method),
 		slog.String("header", fmt.Sprintf("%+v", r.header)),
-		slog.String("url", r.fullURL),
+		slog.String("url", fullURL),
 	)
 
 	c.Logger.Debug(
@@ -212,16 +285,47 @@ func (c *Client) callAPI(ctx context.Context, r *request, opts ...RequestOption)
 	)
 
 	if res.StatusCode >= http.StatusBadRequest {
-		return nil, fmt.Errorf("API request failed with status %d: %s", res.StatusCode, string(data))
+		return nil, &APIError{StatusCode: res.StatusCode, Body: string(data)}
 	}
 	return data, nil
 }
 
+// InvalidateCache drops cached responses for the given endpoints,
+// e.g. "/api/v3/exchangeInfo", or every cached response when called
+// without arguments. It is a no-op when caching is disabled.
+func (c *Client) InvalidateCache(endpoints ...string) {
+	if c.cache == nil {
+		return
+	}
+	c.cache.invalidate(endpoints...)
+}
+
+// SetBaseURL replaces the configured base URLs with url. It is safe to
+// call while requests are in flight.
 func (c *Client) SetBaseURL(url string) *Client {
-	c.BaseURL = url
+	c.baseURLs.set(url)
 	return c
 }
 
+// SetBaseURLs replaces the configured base URLs, in order of preference.
+// It is safe to call while requests are in flight.
+func (c *Client) SetBaseURLs(urls ...string) *Client {
+	c.baseURLs.set(urls...)
+	return c
+}
+
+// ActiveBaseURL returns the base URL requests are currently sent to.
+func (c *Client) ActiveBaseURL() string {
+	return c.urls().active()
+}
+
+// urls returns the base URL pool, after taking over a base URL assigned
+// to the BaseURL field since the last request.
+func (c *Client) urls() *baseURLPool {
+	c.baseURLs.adopt(c.BaseURL)
+	return c.baseURLs
+}
+
 //
 //
 //
@@ -280,6 +384,22 @@ func (c *Client) NewCreateOrderService(pair string, side SideType, orderType Ord
 	return &CreateOrderService{c: c, pair: pair, side: side, orderType: orderType, price: price, amount: amount}
 }
 
+// POST /api/orders/ at most once per client order id, see NewClientOrderId
+func (c *Client) NewPlaceOrderService(clientOrderId string, pair string, side SideType, orderType OrderType, price string, amount string) *PlaceOrderService {
+	return &PlaceOrderService{
+		c:                c,
+		clientOrderId:    clientOrderId,
+		pair:             pair,
+		side:             side,
+		orderType:        orderType,
+		price:            price,
+		amount:           amount,
+		maxAttempts:      DefaultPlaceOrderAttempts,
+		settleDelay:      DefaultPlaceOrderSettle,
+		reconcileTimeout: DefaultReconcileTimeout,
+	}
+}
+
 // *
 // /api/orders/user
 
@@ -292,11 +412,26 @@ func (c *Client) NewCancelOrderService(orderId string, pair string) *CancelOrder
 	return &CancelOrderService{c: c, orderId: orderId, pair: pair}
 }
 
+// DEL + POST /api/orders/<Order Id>, cancel and replace a resting order
+func (c *Client) NewAmendOrderService(orderId string, pair string) *AmendOrderService {
+	return &AmendOrderService{c: c, orderId: orderId, pair: pair}
+}
+
 // /api/orders/all
 func (c *Client) NewCancelAllOrdersService(pair string) *CancelAllOrdersService {
 	return &CancelAllOrdersService{c: c, pair: pair}
 }
 
+// POST /api/orders/ for each spec on a bounded worker pool
+func (c *Client) NewCreateOrdersBatchService(specs []OrderSpec) *CreateOrdersBatchService {
+	return &CreateOrdersBatchService{c: c, specs: specs, workers: DefaultBatchWorkers, rateLimit: DefaultBatchRateLimit}
+}
+
+// DEL /api/orders/<Order Id> for each order on a bounded worker pool
+func (c *Client) NewCancelOrdersBatchService(refs []OrderRef) *CancelOrdersBatchService {
+	return &CancelOrdersBatchService{c: c, refs: refs, workers: DefaultBatchWorkers, rateLimit: DefaultBatchRateLimit}
+}
+
 // Get 24 hrs. ticker
 // /api/v3/ticker/24hr
 func (c *Client) NewList24HrPriceChangeStatsService() *List24HrPriceChangeStatsService {
@@ -337,25 +472,25 @@ func (c *Client) NewKeepAliveListenKeySerice() *KeepAliveListenKeySerice {
 // GET Fiat deposit histories
 // /api/bank-account-deposits
 func (c *Client) NewFiatDepositHistoryService() *FiatDepositHistoryService {
-	return &FiatDepositHistoryService{c: c}
+	return &FiatDepositHistoryService{transferHistory{c: c}}
 }
 
 // GET fiat histories
 // /api/fiat-withdrawals
 func (c *Client) NewFiatWithdrawalHistoryService() *FiatWithdrawalHistoryService {
-	return &FiatWithdrawalHistoryService{c: c}
+	return &FiatWithdrawalHistoryService{transferHistory{c: c}}
 }
 
 // GET crypto deposit history
 // /api/crypto-deposits
 func (c *Client) NewCryptoDepositHistoryService() *CryptoDepositHistoryService {
-	return &CryptoDepositHistoryService{c: c}
+	return &CryptoDepositHistoryService{transferHistory{c: c}}
 }
 
 // GET histories Required permission: withdrawal_list
 // /api/crypto-withdrawals
 func (c *Client) NewCryptoWithdrawalHistoryService() *CryptoWithdrawalHistoryService {
-	return &CryptoWithdrawalHistoryService{c: c}
+	return &CryptoWithdrawalHistoryService{transferHistory{c: c}}
 }
 
 // GET trade history
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// parseDecimal parses a decimal string such as "33.95" exactly. An empty
+// string is zero, as for ParseFloat.
+func parseDecimal(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return new(big.Rat), nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	return r, nil
+}
+
+// equalDecimal reports whether a and b are the same number, so "10" and
+// "10.00" compare equal. Unparseable values never compare equal.
+func equalDecimal(a, b string) bool {
+	x, err := parseDecimal(a)
+	if err != nil {
+		return false
+	}
+	y, err := parseDecimal(b)
+	if err != nil {
+		return false
+	}
+	return x.Cmp(y) == 0
+}
+
+// SubDecimal returns a - b, formatted with as many decimals as the more
+// precise operand.
+func SubDecimal(a, b string) (string, error) {
+	x, err := parseDecimal(a)
+	if err != nil {
+		return "", err
+	}
+	y, err := parseDecimal(b)
+	if err != nil {
+		return "", err
+	}
+	prec := max(DecimalPlaces(a), DecimalPlaces(b))
+	return new(big.Rat).Sub(x, y).FloatString(prec), nil
+}
+
+// CmpDecimal compares a and b like big.Rat.Cmp.
+func CmpDecimal(a, b string) (int, error) {
+	x, err := parseDecimal(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := parseDecimal(b)
+	if err != nil {
+		return 0, err
+	}
+	return x.Cmp(y), nil
+}
+
+// isPositiveDecimal reports whether s is a number greater than zero.
+func isPositiveDecimal(s string) bool {
+	r, err := parseDecimal(s)
+	return err == nil && r.Sign() > 0
+}
+
+// DecimalPlaces returns the number of digits after the decimal point in s.
+func DecimalPlaces(s string) int {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// ParseFloat parses a decimal string such as "33.95" as a float64. An
+// empty string, which the API returns for unset amounts, is zero, as for
+// the other decimal helpers. Callers that book fills from a remaining
+// amount must reject an empty one themselves: there it means unknown.
+func ParseFloat(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	return f, nil
+}
+
+// FormatFloat formats f rounded to 10 decimals, hiding float noise such
+// as 0.30000000000000004.
+func FormatFloat(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1e10)/1e10, 'f', -1, 64)
+}
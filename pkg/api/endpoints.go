@@ -1,10 +1,12 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 type ExchangeInfoService struct {
@@ -37,9 +39,73 @@ type ExchangeInfoSymbol struct {
 	Filters                    []ExchangeInfoFilter `json:"filters"`
 }
 
+// Filter types of ExchangeInfoFilter
+const (
+	FilterTypePrice       = "PRICE_FILTER"
+	FilterTypeLotSize     = "LOT_SIZE"
+	FilterTypeMinNotional = "MIN_NOTIONAL"
+	FilterTypeNotional    = "NOTIONAL"
+)
+
 type ExchangeInfoFilter struct {
-	FilterType string `json:"filterType"`
-	TickSize   string `json:"tickSize"` // Assuming TickSize as a string
+	FilterType  string `json:"filterType"`
+	MinPrice    string `json:"minPrice,omitempty"`
+	MaxPrice    string `json:"maxPrice,omitempty"`
+	TickSize    string `json:"tickSize,omitempty"` // Assuming TickSize as a string
+	MinQty      string `json:"minQty,omitempty"`
+	MaxQty      string `json:"maxQty,omitempty"`
+	StepSize    string `json:"stepSize,omitempty"`
+	MinNotional string `json:"minNotional,omitempty"`
+}
+
+// Symbol returns the symbol info of symbol, matched case-insensitively.
+func (e *ExchangeInfo) Symbol(symbol string) (*ExchangeInfoSymbol, bool) {
+	for i := range e.Symbols {
+		if strings.EqualFold(e.Symbols[i].Symbol, symbol) {
+			return &e.Symbols[i], true
+		}
+	}
+	return nil, false
+}
+
+// Filter returns the filter of filterType, or nil if the symbol has none.
+func (s *ExchangeInfoSymbol) Filter(filterType string) *ExchangeInfoFilter {
+	for i := range s.Filters {
+		if s.Filters[i].FilterType == filterType {
+			return &s.Filters[i]
+		}
+	}
+	return nil
+}
+
+// TradingRules are the price and quantity constraints of a symbol. Empty
+// fields are unconstrained.
+type TradingRules struct {
+	TickSize    string
+	MinPrice    string
+	MaxPrice    string
+	StepSize    string
+	MinQty      string
+	MaxQty      string
+	MinNotional string
+}
+
+// TradingRules collects the constraints of the price, lot size and notional
+// filters.
+func (s *ExchangeInfoSymbol) TradingRules() TradingRules {
+	var rules TradingRules
+	if f := s.Filter(FilterTypePrice); f != nil {
+		rules.TickSize, rules.MinPrice, rules.MaxPrice = f.TickSize, f.MinPrice, f.MaxPrice
+	}
+	if f := s.Filter(FilterTypeLotSize); f != nil {
+		rules.StepSize, rules.MinQty, rules.MaxQty = f.StepSize, f.MinQty, f.MaxQty
+	}
+	if f := s.Filter(FilterTypeMinNotional); f != nil {
+		rules.MinNotional = f.MinNotional
+	} else if f := s.Filter(FilterTypeNotional); f != nil {
+		rules.MinNotional = f.MinNotional
+	}
+	return rules
 }
 
 func (s *ExchangeInfoService) Do(ctx context.Context, opt ...RequestOption) (exchangeInfo *ExchangeInfo, err error) {
@@ -103,13 +169,167 @@ func (s *OrderbookDepthService) Do(ctx context.Context, opt ...RequestOption) (o
 }
 
 type KlineService struct {
-	c *Client
+	c         *Client
+	symbol    string
+	interval  string
+	startTime *int64
+	endTime   *int64
+	limit     *int
+}
+
+// Kline is one candlestick. Times are Unix milliseconds.
+type Kline struct {
+	OpenTime         int64
+	Open             string
+	High             string
+	Low              string
+	Close            string
+	Volume           string
+	CloseTime        int64
+	QuoteAssetVolume string
+	TradeNum         int64
+}
+
+// UnmarshalJSON decodes a kline from its array form
+// [openTime, open, high, low, close, volume, closeTime, quoteVolume, trades, ...].
+func (k *Kline) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) < 9 {
+		return fmt.Errorf("error: invalid kline with %d fields", len(raw))
+	}
+	fields := []any{&k.OpenTime, &k.Open, &k.High, &k.Low, &k.Close, &k.Volume, &k.CloseTime, &k.QuoteAssetVolume, &k.TradeNum}
+	for i, field := range fields {
+		if err := json.Unmarshal(raw[i], field); err != nil {
+			return fmt.Errorf("error: invalid kline field %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (s *KlineService) Symbol(symbol string) *KlineService {
+	s.symbol = symbol
+	return s
+}
+
+// Interval is the kline interval, e.g. "1m", "1h" or "1d".
+func (s *KlineService) Interval(interval string) *KlineService {
+	s.interval = interval
+	return s
+}
+
+func (s *KlineService) StartTime(startTime int64) *KlineService {
+	s.startTime = &startTime
+	return s
+}
+
+func (s *KlineService) EndTime(endTime int64) *KlineService {
+	s.endTime = &endTime
+	return s
+}
+
+func (s *KlineService) Limit(limit int) *KlineService {
+	s.limit = &limit
+	return s
+}
+
+func (s *KlineService) Do(ctx context.Context, opt ...RequestOption) (klines []Kline, err error) {
+	r := &request{
+		method:   http.MethodGet,
+		endpoint: "/api/v3/klines",
+		secType:  secTypeNone,
+	}
+	r.setQueryParams(params{
+		"symbol":   s.symbol,
+		"interval": s.interval,
+	})
+	if s.startTime != nil {
+		r.setQueryParam("startTime", *s.startTime)
+	}
+	if s.endTime != nil {
+		r.setQueryParam("endTime", *s.endTime)
+	}
+	if s.limit != nil {
+		if *s.limit < 1 || *s.limit > 1000 {
+			return nil, fmt.Errorf("error: invalid limit [%v], must be between 1 and 1000", *s.limit)
+		}
+		r.setQueryParam("limit", *s.limit)
+	}
+
+	data, err := s.c.callAPI(ctx, r, opt...)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &klines); err != nil {
+		return nil, err
+	}
+	return klines, nil
 }
 
 // Get 24 hrs. ticker
 // /api/v3/ticker/24hr
 type List24HrPriceChangeStatsService struct {
-	c *Client
+	c      *Client
+	symbol *string
+}
+
+type PriceChangeStats struct {
+	Symbol             string `json:"symbol"`
+	PriceChange        string `json:"priceChange"`
+	PriceChangePercent string `json:"priceChangePercent"`
+	WeightedAvgPrice   string `json:"weightedAvgPrice"`
+	PrevClosePrice     string `json:"prevClosePrice"`
+	LastPrice          string `json:"lastPrice"`
+	LastQty            string `json:"lastQty"`
+	BidPrice           string `json:"bidPrice"`
+	AskPrice           string `json:"askPrice"`
+	OpenPrice          string `json:"openPrice"`
+	HighPrice          string `json:"highPrice"`
+	LowPrice           string `json:"lowPrice"`
+	Volume             string `json:"volume"`
+	QuoteVolume        string `json:"quoteVolume"`
+	OpenTime           int64  `json:"openTime"`
+	CloseTime          int64  `json:"closeTime"`
+	FirstId            int64  `json:"firstId"`
+	LastId             int64  `json:"lastId"`
+	Count              int64  `json:"count"`
+}
+
+func (s *List24HrPriceChangeStatsService) Symbol(symbol string) *List24HrPriceChangeStatsService {
+	s.symbol = &symbol
+	return s
+}
+
+func (s *List24HrPriceChangeStatsService) Do(ctx context.Context, opt ...RequestOption) (stats []PriceChangeStats, err error) {
+	r := &request{
+		method:   http.MethodGet,
+		endpoint: "/api/v3/ticker/24hr",
+		secType:  secTypeNone,
+	}
+	if s.symbol != nil {
+		r.setQueryParam("symbol", *s.symbol)
+	}
+
+	data, err := s.c.callAPI(ctx, r, opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single object is returned when a symbol is given
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var single PriceChangeStats
+		if err := json.Unmarshal(data, &single); err != nil {
+			return nil, err
+		}
+		return []PriceChangeStats{single}, nil
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
 }
 
 // GET Get balances and addresses
@@ -174,7 +394,81 @@ func (s *ListBalanceAddressService) Do(ctx context.Context, opt ...RequestOption
 // Get aggregate trade
 // /api/v3/aggTrades
 type AggregateTradeService struct {
-	c *Client
+	c         *Client
+	symbol    string
+	fromId    *int64
+	startTime *int64
+	endTime   *int64
+	limit     *int
+}
+
+type AggregateTrade struct {
+	AggregateTradeID int64  `json:"a"`
+	Price            string `json:"p"`
+	Quantity         string `json:"q"`
+	FirstTradeID     int64  `json:"f"`
+	LastTradeID      int64  `json:"l"`
+	Timestamp        int64  `json:"T"`
+	IsBuyerMaker     bool   `json:"m"`
+}
+
+func (s *AggregateTradeService) Symbol(symbol string) *AggregateTradeService {
+	s.symbol = symbol
+	return s
+}
+
+// FromId returns trades from this aggregate trade ID onwards.
+func (s *AggregateTradeService) FromId(fromId int64) *AggregateTradeService {
+	s.fromId = &fromId
+	return s
+}
+
+func (s *AggregateTradeService) StartTime(startTime int64) *AggregateTradeService {
+	s.startTime = &startTime
+	return s
+}
+
+func (s *AggregateTradeService) EndTime(endTime int64) *AggregateTradeService {
+	s.endTime = &endTime
+	return s
+}
+
+func (s *AggregateTradeService) Limit(limit int) *AggregateTradeService {
+	s.limit = &limit
+	return s
+}
+
+func (s *AggregateTradeService) Do(ctx context.Context, opt ...RequestOption) (trades []AggregateTrade, err error) {
+	r := &request{
+		method:   http.MethodGet,
+		endpoint: "/api/v3/aggTrades",
+		secType:  secTypeNone,
+	}
+	r.setQueryParam("symbol", s.symbol)
+	if s.fromId != nil {
+		r.setQueryParam("fromId", *s.fromId)
+	}
+	if s.startTime != nil {
+		r.setQueryParam("startTime", *s.startTime)
+	}
+	if s.endTime != nil {
+		r.setQueryParam("endTime", *s.endTime)
+	}
+	if s.limit != nil {
+		if *s.limit < 1 || *s.limit > 1000 {
+			return nil, fmt.Errorf("error: invalid limit [%v], must be between 1 and 1000", *s.limit)
+		}
+		r.setQueryParam("limit", *s.limit)
+	}
+
+	data, err := s.c.callAPI(ctx, r, opt...)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &trades); err != nil {
+		return nil, err
+	}
+	return trades, nil
 }
 
 // GET Ping -- Get all configs
@@ -183,6 +477,17 @@ type PingService struct {
 	c *Client
 }
 
+func (s *PingService) Do(ctx context.Context, opt ...RequestOption) (err error) {
+	r := &request{
+		method:   http.MethodGet,
+		endpoint: "/api/v3/ping",
+		secType:  secTypeNone,
+	}
+
+	_, err = s.c.callAPI(ctx, r, opt...)
+	return err
+}
+
 // POST Generate a listen key (UserStream) Create a new listen key. The listen key will be expired after 60 minutes
 // /api/v3/userDataStream
 type ListenKeyService struct {
@@ -195,34 +500,190 @@ type KeepAliveListenKeySerice struct {
 	c *Client
 }
 
+// Transfer is a fiat or crypto deposit or withdrawal. Fiat transfers are in
+// THB unless Currency says otherwise.
+type Transfer struct {
+	ID        int    `json:"id"`
+	Currency  string `json:"currency"`
+	Amount    string `json:"amount"`
+	Fee       string `json:"fee"`
+	Address   string `json:"address,omitempty"`
+	TxID      string `json:"txid,omitempty"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+// transferHistory is the paging shared by the deposit and withdrawal
+// history services.
+type transferHistory struct {
+	c      *Client
+	limit  *int
+	offset *int
+}
+
+func (s *transferHistory) do(ctx context.Context, endpoint string, opt ...RequestOption) (transfers []Transfer, err error) {
+	r := &request{
+		method:   http.MethodGet,
+		endpoint: endpoint,
+		secType:  secTypeSigned,
+	}
+	if s.limit != nil {
+		r.setQueryParam("limit", *s.limit)
+	}
+	if s.offset != nil {
+		r.setQueryParam("offset", *s.offset)
+	}
+
+	data, err := s.c.callAPI(ctx, r, opt...)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &transfers); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
 // GET Fiat deposit histories
 // /api/bank-account-deposits
 type FiatDepositHistoryService struct {
-	c *Client
+	transferHistory
+}
+
+func (s *FiatDepositHistoryService) Limit(limit int) *FiatDepositHistoryService {
+	s.limit = &limit
+	return s
+}
+
+func (s *FiatDepositHistoryService) Offset(offset int) *FiatDepositHistoryService {
+	s.offset = &offset
+	return s
+}
+
+func (s *FiatDepositHistoryService) Do(ctx context.Context, opt ...RequestOption) ([]Transfer, error) {
+	return s.do(ctx, "/api/bank-account-deposits", opt...)
 }
 
 // GET fiat histories
 // /api/fiat-withdrawals
 type FiatWithdrawalHistoryService struct {
-	c *Client
+	transferHistory
+}
+
+func (s *FiatWithdrawalHistoryService) Limit(limit int) *FiatWithdrawalHistoryService {
+	s.limit = &limit
+	return s
+}
+
+func (s *FiatWithdrawalHistoryService) Offset(offset int) *FiatWithdrawalHistoryService {
+	s.offset = &offset
+	return s
+}
+
+func (s *FiatWithdrawalHistoryService) Do(ctx context.Context, opt ...RequestOption) ([]Transfer, error) {
+	return s.do(ctx, "/api/fiat-withdrawals", opt...)
 }
 
 // GET crypto deposit history
 // /api/crypto-deposits
 type CryptoDepositHistoryService struct {
-	c *Client
+	transferHistory
+}
+
+func (s *CryptoDepositHistoryService) Limit(limit int) *CryptoDepositHistoryService {
+	s.limit = &limit
+	return s
+}
+
+func (s *CryptoDepositHistoryService) Offset(offset int) *CryptoDepositHistoryService {
+	s.offset = &offset
+	return s
+}
+
+func (s *CryptoDepositHistoryService) Do(ctx context.Context, opt ...RequestOption) ([]Transfer, error) {
+	return s.do(ctx, "/api/crypto-deposits", opt...)
 }
 
 // GET histories Required permission: withdrawal_list
 // /api/crypto-withdrawals
 type CryptoWithdrawalHistoryService struct {
-	c *Client
+	transferHistory
+}
+
+func (s *CryptoWithdrawalHistoryService) Limit(limit int) *CryptoWithdrawalHistoryService {
+	s.limit = &limit
+	return s
+}
+
+func (s *CryptoWithdrawalHistoryService) Offset(offset int) *CryptoWithdrawalHistoryService {
+	s.offset = &offset
+	return s
+}
+
+func (s *CryptoWithdrawalHistoryService) Do(ctx context.Context, opt ...RequestOption) ([]Transfer, error) {
+	return s.do(ctx, "/api/crypto-withdrawals", opt...)
 }
 
 // GET trade history
 // /api/trade-history
 type TradeHistoryService struct {
-	c *Client
+	c      *Client
+	pair   *string
+	limit  *int
+	offset *int
+}
+
+type Trade struct {
+	ID          int      `json:"id"`
+	OrderID     int      `json:"order_id"`
+	Pair        string   `json:"pair"`
+	Side        SideType `json:"side"`
+	Price       string   `json:"price"`
+	Amount      string   `json:"amount"`
+	Fee         string   `json:"fee"`
+	FeeCurrency string   `json:"fee_currency"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+func (s *TradeHistoryService) Pair(pair string) *TradeHistoryService {
+	s.pair = &pair
+	return s
+}
+
+func (s *TradeHistoryService) Limit(limit int) *TradeHistoryService {
+	s.limit = &limit
+	return s
+}
+
+func (s *TradeHistoryService) Offset(offset int) *TradeHistoryService {
+	s.offset = &offset
+	return s
+}
+
+func (s *TradeHistoryService) Do(ctx context.Context, opt ...RequestOption) (trades []Trade, err error) {
+	r := &request{
+		method:   http.MethodGet,
+		endpoint: "/api/trade-history",
+		secType:  secTypeSigned,
+	}
+	if s.pair != nil {
+		r.setQueryParam("pair", *s.pair)
+	}
+	if s.limit != nil {
+		r.setQueryParam("limit", *s.limit)
+	}
+	if s.offset != nil {
+		r.setQueryParam("offset", *s.offset)
+	}
+
+	data, err := s.c.callAPI(ctx, r, opt...)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &trades); err != nil {
+		return nil, err
+	}
+	return trades, nil
 }
 
 // GET configs Get all configs
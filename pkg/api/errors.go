@@ -1,7 +1,27 @@
 package api
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrInvalidLimitValue = errors.New("error: Invid parameter limit")
+	ErrNoBaseURL         = errors.New("error: no base URL configured")
+
+	// ErrOrderNotPlaced means the exchange definitely does not hold the order.
+	ErrOrderNotPlaced = errors.New("error: order not placed")
+	// ErrOrderStatusUnknown means the order may or may not exist because
+	// reconciliation could not reach the exchange.
+	ErrOrderStatusUnknown = errors.New("error: order status unknown")
 )
+
+// APIError is returned when the API responds with an error status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
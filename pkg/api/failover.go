@@ -0,0 +1,337 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BaseURLStatus describes the health of one configured base URL.
+type BaseURLStatus struct {
+	URL         string
+	Healthy     bool
+	Active      bool
+	Failures    int
+	LastError   error
+	LastChecked time.Time
+}
+
+type baseURLState struct {
+	url         string
+	healthy     bool
+	failures    int
+	lastErr     error
+	lastChecked time.Time
+}
+
+// baseURLPool holds the base URLs in order of preference. The active base
+// URL is the first healthy one; unhealthy ones are only tried as a last
+// resort until a health check or a successful request restores them.
+type baseURLPool struct {
+	mu   sync.RWMutex
+	urls []*baseURLState
+	// adopted is the value of the client's BaseURL field the pool last
+	// took over.
+	adopted string
+}
+
+func newBaseURLPool(urls ...string) *baseURLPool {
+	p := &baseURLPool{}
+	p.set(urls...)
+	if len(urls) > 0 {
+		p.adopted = urls[0]
+	}
+	return p
+}
+
+func newBaseURLStates(urls []string) []*baseURLState {
+	states := make([]*baseURLState, 0, len(urls))
+	for _, u := range urls {
+		states = append(states, &baseURLState{url: u, healthy: true})
+	}
+	return states
+}
+
+func (p *baseURLPool) set(urls ...string) {
+	states := newBaseURLStates(urls)
+
+	p.mu.Lock()
+	p.urls = states
+	p.mu.Unlock()
+}
+
+// adopt replaces the base URLs with url when it differs from the value
+// adopted last, so writing the client's BaseURL field keeps working.
+func (p *baseURLPool) adopt(url string) {
+	p.mu.RLock()
+	same := url == p.adopted
+	p.mu.RUnlock()
+	if same {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if url == p.adopted {
+		return
+	}
+	p.adopted = url
+	if url != "" {
+		p.urls = newBaseURLStates([]string{url})
+	}
+}
+
+// active returns the base URL requests are currently sent to.
+func (p *baseURLPool) active() string {
+	candidates := p.candidates()
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0]
+}
+
+// candidates returns healthy base URLs in order of preference followed by
+// the unhealthy ones.
+func (p *baseURLPool) candidates() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	healthy := make([]string, 0, len(p.urls))
+	var unhealthy []string
+	for _, s := range p.urls {
+		if s.healthy {
+			healthy = append(healthy, s.url)
+		} else {
+			unhealthy = append(unhealthy, s.url)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (p *baseURLPool) all() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	urls := make([]string, 0, len(p.urls))
+	for _, s := range p.urls {
+		urls = append(urls, s.url)
+	}
+	return urls
+}
+
+// mark records the outcome of a request or health check against url.
+func (p *baseURLPool) mark(url string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.urls {
+		if s.url != url {
+			continue
+		}
+		s.lastChecked = time.Now()
+		s.lastErr = err
+		if err != nil {
+			s.healthy = false
+			s.failures++
+		} else {
+			s.healthy = true
+			s.failures = 0
+		}
+	}
+}
+
+func (p *baseURLPool) status() []BaseURLStatus {
+	active := p.active()
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	status := make([]BaseURLStatus, 0, len(p.urls))
+	for _, s := range p.urls {
+		status = append(status, BaseURLStatus{
+			URL:         s.url,
+			Healthy:     s.healthy,
+			Active:      s.url == active,
+			Failures:    s.failures,
+			LastError:   s.lastErr,
+			LastChecked: s.lastChecked,
+		})
+	}
+	return status
+}
+
+// transportError marks a failure to get any HTTP response from a base URL.
+type transportError struct {
+	baseURL string
+	err     error
+}
+
+func (e *transportError) Error() string {
+	return fmt.Sprintf("failed to execute request against %s: %v", e.baseURL, e.err)
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// isDialError reports whether err happened before the request was sent,
+// which makes it safe to retry non-idempotent requests elsewhere.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// shouldFailover reports whether a failed attempt may be retried against
+// the next base URL.
+func shouldFailover(r *request, err error) bool {
+	var tErr *transportError
+	if !errors.As(err, &tErr) {
+		return false
+	}
+	return r.method == http.MethodGet || isDialError(err)
+}
+
+// doWithFailover sends r to each candidate base URL in turn until one
+// returns a response. Read-only requests are hedged when a hedge delay is
+// configured.
+func (c *Client) doWithFailover(ctx context.Context, r *request) ([]byte, error) {
+	candidates := c.urls().candidates()
+	if len(candidates) == 0 {
+		return nil, ErrNoBaseURL
+	}
+
+	if c.hedgeDelay > 0 && r.method == http.MethodGet && len(candidates) > 1 {
+		return c.doHedged(ctx, r, candidates)
+	}
+
+	var err error
+	for _, baseURL := range candidates {
+		var data []byte
+		data, err = c.doRequest(ctx, r, baseURL)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil || !shouldFailover(r, err) {
+			return nil, err
+		}
+		c.Logger.Warn("Orbix base URL failed, trying next",
+			"baseURL", baseURL,
+			"error", err,
+		)
+	}
+	return nil, err
+}
+
+// doHedged starts r against the first candidate and, each time the hedge
+// delay passes without a response or an attempt fails with a transport
+// error, against the next one. The first response wins and the remaining
+// attempts are cancelled.
+func (c *Client) doHedged(ctx context.Context, r *request, candidates []string) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	results := make(chan result, len(candidates))
+	launched, pending := 0, 0
+	launch := func() {
+		baseURL := candidates[launched]
+		launched++
+		pending++
+		go func() {
+			data, err := c.doRequest(ctx, r, baseURL)
+			results <- result{data: data, err: err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(c.hedgeDelay)
+	defer timer.Stop()
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if launched < len(candidates) {
+				launch()
+				timer.Reset(c.hedgeDelay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.data, nil
+			}
+			lastErr = res.err
+			if ctx.Err() != nil || !shouldFailover(r, res.err) {
+				return nil, res.err
+			}
+			if launched < len(candidates) {
+				launch()
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// CheckHealth pings every configured base URL once and updates its health.
+func (c *Client) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, baseURL := range c.urls().all() {
+		wg.Add(1)
+		go func(baseURL string) {
+			defer wg.Done()
+			c.baseURLs.mark(baseURL, c.ping(ctx, baseURL))
+		}(baseURL)
+	}
+	wg.Wait()
+}
+
+// RunHealthChecks calls CheckHealth every interval until ctx is done.
+func (c *Client) RunHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ping checks a single base URL without going through the failover logic.
+func (c *Client) ping(ctx context.Context, baseURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeOut)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/v3/ping", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	res, err := c.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("health check failed with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// BaseURLStatus reports the health of every configured base URL.
+func (c *Client) BaseURLStatus() []BaseURLStatus {
+	return c.urls().status()
+}
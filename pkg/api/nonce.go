@@ -0,0 +1,122 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NonceManager hands out strictly increasing nonces for one API key.
+// Nonces follow the wall clock in milliseconds, but never repeat or go
+// backwards when several orders are signed in the same millisecond or the
+// clock is stepped back.
+type NonceManager struct {
+	mu   sync.Mutex
+	last int64
+	path string
+}
+
+// NewNonceManager creates a nonce manager. When path is not empty the
+// high-water mark is persisted to that file and the file is locked while a
+// nonce is issued, so restarts and processes sharing the file never reuse
+// a nonce.
+func NewNonceManager(path string) *NonceManager {
+	return &NonceManager{path: path}
+}
+
+var (
+	nonceManagersMu sync.Mutex
+	nonceManagers   = make(map[string]*NonceManager)
+)
+
+// sharedNonceManager returns the in-memory nonce manager shared by every
+// client of this process that signs with apiKey.
+func sharedNonceManager(apiKey string) *NonceManager {
+	nonceManagersMu.Lock()
+	defer nonceManagersMu.Unlock()
+
+	m, ok := nonceManagers[apiKey]
+	if !ok {
+		m = NewNonceManager("")
+		nonceManagers[apiKey] = m
+	}
+	return m
+}
+
+// Next returns a nonce greater than every nonce returned before.
+func (m *NonceManager) Next() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.path == "" {
+		m.last = nextNonce(m.last)
+		return m.last, nil
+	}
+
+	f, err := os.OpenFile(m.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open nonce file: %w", err)
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return 0, fmt.Errorf("failed to lock nonce file: %w", err)
+	}
+	defer unlockFile(f)
+
+	stored, err := readNonce(f)
+	if err != nil {
+		return 0, err
+	}
+
+	nonce := nextNonce(max(m.last, stored))
+	if err := writeNonce(f, nonce); err != nil {
+		return 0, err
+	}
+	m.last = nonce
+	return nonce, nil
+}
+
+func nextNonce(last int64) int64 {
+	nonce := time.Now().UnixMilli()
+	if nonce <= last {
+		nonce = last + 1
+	}
+	return nonce
+}
+
+func readNonce(f *os.File) (int64, error) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read nonce file: %w", err)
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "" {
+		return 0, nil
+	}
+	nonce, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid nonce file content %q: %w", s, err)
+	}
+	return nonce, nil
+}
+
+// nonceWidth is the width the nonce file is written at, enough for any
+// int64.
+const nonceWidth = 20
+
+// writeNonce overwrites the nonce in place, zero-padded to nonceWidth, so
+// the file is never truncated and a crash mid-write cannot leave it empty.
+func writeNonce(f *os.File, nonce int64) error {
+	if _, err := f.WriteAt([]byte(fmt.Sprintf("%0*d", nonceWidth, nonce)), 0); err != nil {
+		return fmt.Errorf("failed to write nonce file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync nonce file: %w", err)
+	}
+	return nil
+}
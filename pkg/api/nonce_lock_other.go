@@ -0,0 +1,15 @@
+//go:build !unix
+
+package api
+
+import "os"
+
+// File locking is not available; the nonce file only protects against
+// restarts, not against other processes sharing it.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
 )
 
 // GET Get order book
@@ -114,6 +113,31 @@ type OrderbookTickerService struct {
 	c *Client
 }
 
+// OrderbookTicker is the best bid and ask of a pair.
+type OrderbookTicker struct {
+	Bid OrderbookItem `json:"bid"`
+	Ask OrderbookItem `json:"ask"`
+}
+
+// Do returns the best bid and ask of every pair, keyed by pair.
+func (s *OrderbookTickerService) Do(ctx context.Context, opts ...RequestOption) (tickers map[string]OrderbookTicker, err error) {
+	r := &request{
+		method:   http.MethodGet,
+		endpoint: "/api/orderbook-tickers/",
+		secType:  secTypeNone,
+	}
+
+	data, err := s.c.callAPI(ctx, r, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &tickers); err != nil {
+		return nil, err
+	}
+	return tickers, nil
+}
+
 // POST Create order
 type CreateOrderService struct {
 	c         *Client
@@ -125,25 +149,26 @@ type CreateOrderService struct {
 }
 
 type CreateOrderRequestBody struct {
-	Amount string    `json:"amount"`
-	Nonce  int64     `json:"nonce"`
-	Pair   string    `json:"pair"`
-	Price  string    `json:"price"`
-	Side   SideType  `json:"side"`
-	Type   OrderType `json:"type"`
+	Amount string `json:"amount"`
+	// Nonce is ignored.
+	//
+	// Deprecated: the client's NonceManager sets the nonce of every signed
+	// write, replacing any value given here.
+	Nonce int64     `json:"nonce,omitempty"`
+	Pair  string    `json:"pair"`
+	Price string    `json:"price"`
+	Side  SideType  `json:"side"`
+	Type  OrderType `json:"type"`
 }
 
 func (s *CreateOrderService) Do(ctx context.Context, opts ...RequestOption) (order *Order, err error) {
 
 	body, err := json.Marshal(CreateOrderRequestBody{
 		Amount: s.amount,
-		// Nonce:  fmt.Sprintf("%v", time.Now().UnixMilli()),
-		Nonce: time.Now().UnixMilli(),
-		// Nonce: 2731832,
-		Pair:  s.pair,
-		Price: s.price,
-		Side:  s.side,
-		Type:  s.orderType,
+		Pair:   s.pair,
+		Price:  s.price,
+		Side:   s.side,
+		Type:   s.orderType,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("err marshalling JSON: %w", err)
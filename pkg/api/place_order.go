@@ -0,0 +1,334 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Placement defaults
+const (
+	DefaultPlaceOrderAttempts = 3
+	DefaultPlaceOrderSettle   = 2 * time.Second
+	DefaultReconcileTimeout   = 30 * time.Second
+	DefaultReconcileLookback  = 50
+	DefaultReconcileClockSkew = 5 * time.Second
+	// DefaultPlacedOrderRetention is how long a client order id is
+	// remembered, and so guarded against being placed twice.
+	DefaultPlacedOrderRetention = 24 * time.Hour
+)
+
+const clientOrderIdByteLen = 8
+
+// NewClientOrderId returns a random client-side order identifier.
+func NewClientOrderId() string {
+	b := make([]byte, clientOrderIdByteLen)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// placedOrders maps client order ids to exchange order ids, so an order is
+// never placed twice for the same client order id and an exchange order is
+// never claimed by two client order ids. Entries are kept for
+// DefaultPlacedOrderRetention.
+type placedOrders struct {
+	mu         sync.Mutex
+	retention  time.Duration
+	byClientId map[string]*Order
+	claimed    map[int]string
+	// order holds the client order ids by claim time, oldest first.
+	order []placedEntry
+	locks map[string]*placementLock
+}
+
+type placedEntry struct {
+	clientOrderId string
+	at            time.Time
+}
+
+// placementLock is dropped once nobody holds or waits for it.
+type placementLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newPlacedOrders() *placedOrders {
+	return &placedOrders{
+		retention:  DefaultPlacedOrderRetention,
+		byClientId: make(map[string]*Order),
+		claimed:    make(map[int]string),
+		locks:      make(map[string]*placementLock),
+	}
+}
+
+// lock serializes placements that share a client order id.
+func (p *placedOrders) lock(clientOrderId string) func() {
+	p.mu.Lock()
+	l, ok := p.locks[clientOrderId]
+	if !ok {
+		l = &placementLock{}
+		p.locks[clientOrderId] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		p.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(p.locks, clientOrderId)
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *placedOrders) get(clientOrderId string) (*Order, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pruneLocked(time.Now())
+	order, ok := p.byClientId[clientOrderId]
+	return order, ok
+}
+
+// claim records order for clientOrderId unless another client order id
+// already claimed it, checking and claiming under one lock.
+func (p *placedOrders) claim(clientOrderId string, order *Order) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.pruneLocked(now)
+	if owner, ok := p.claimed[order.ID]; ok && owner != clientOrderId {
+		return false
+	}
+	if _, ok := p.byClientId[clientOrderId]; !ok {
+		p.order = append(p.order, placedEntry{clientOrderId: clientOrderId, at: now})
+	}
+	p.byClientId[clientOrderId] = order
+	p.claimed[order.ID] = clientOrderId
+	return true
+}
+
+// pruneLocked drops the entries older than the retention. The caller holds
+// p.mu.
+func (p *placedOrders) pruneLocked(now time.Time) {
+	n := 0
+	for _, e := range p.order {
+		if now.Sub(e.at) < p.retention {
+			break
+		}
+		if order, ok := p.byClientId[e.clientOrderId]; ok {
+			delete(p.claimed, order.ID)
+			delete(p.byClientId, e.clientOrderId)
+		}
+		n++
+	}
+	if n > 0 {
+		p.order = slices.Delete(p.order, 0, n)
+	}
+}
+
+// LookupClientOrder returns the order placed for clientOrderId by this
+// client within DefaultPlacedOrderRetention, if any.
+func (c *Client) LookupClientOrder(clientOrderId string) (*Order, bool) {
+	return c.placed.get(clientOrderId)
+}
+
+// POST Create order, at most once per client order id
+type PlaceOrderService struct {
+	c                *Client
+	clientOrderId    string
+	pair             string
+	side             SideType
+	orderType        OrderType
+	price            string
+	amount           string
+	maxAttempts      int
+	settleDelay      time.Duration
+	reconcileTimeout time.Duration
+}
+
+type PlaceOrderResult struct {
+	ClientOrderId string
+	Order         *Order
+	// Attempts is the number of create requests sent, zero when the client
+	// order id had already been placed.
+	Attempts int
+	// Reconciled is set when the order was found on the exchange after a
+	// create request failed ambiguously.
+	Reconciled bool
+}
+
+func (s *PlaceOrderService) MaxAttempts(n int) *PlaceOrderService {
+	s.maxAttempts = n
+	return s
+}
+
+// SettleDelay sets how long to wait after an ambiguous failure before
+// looking for the order on the exchange.
+func (s *PlaceOrderService) SettleDelay(d time.Duration) *PlaceOrderService {
+	s.settleDelay = d
+	return s
+}
+
+// ReconcileTimeout bounds each reconciliation. Reconciliation runs even if
+// the context passed to Do is already done, since a timed out create
+// request is the main reason to reconcile.
+func (s *PlaceOrderService) ReconcileTimeout(d time.Duration) *PlaceOrderService {
+	s.reconcileTimeout = d
+	return s
+}
+
+// Do places the order and returns a definite outcome. A nil error means the
+// order exists on the exchange. An error wrapping ErrOrderNotPlaced means it
+// does not, and an error wrapping ErrOrderStatusUnknown means reconciliation
+// itself failed, or the created order was claimed by another client order
+// id, and the caller must check before placing it again.
+//
+// The exchange has no client order id field, so after an ambiguous failure
+// the order is recognised by pair, side, type, price, amount and creation
+// time among open orders, closed orders and recent trades, skipping orders
+// already claimed by another client order id of this client.
+func (s *PlaceOrderService) Do(ctx context.Context, opts ...RequestOption) (res *PlaceOrderResult, err error) {
+	unlock := s.c.placed.lock(s.clientOrderId)
+	defer unlock()
+
+	if order, ok := s.c.placed.get(s.clientOrderId); ok {
+		return &PlaceOrderResult{ClientOrderId: s.clientOrderId, Order: order}, nil
+	}
+
+	// Every reconciliation looks back to the first attempt, since an order
+	// of an earlier attempt may be recorded late by the exchange.
+	submittedAt := time.Now()
+	var lastErr error
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		order, err := s.c.NewCreateOrderService(s.pair, s.side, s.orderType, s.price, s.amount).
+			Do(ctx, opts...)
+		if err == nil {
+			if !s.c.placed.claim(s.clientOrderId, order) {
+				// Another reconciliation took this order as its own, so which
+				// order belongs to which client order id is unknown.
+				return nil, fmt.Errorf("%w: order %d was claimed by another client order id", ErrOrderStatusUnknown, order.ID)
+			}
+			return &PlaceOrderResult{ClientOrderId: s.clientOrderId, Order: order, Attempts: attempt}, nil
+		}
+		if placementRejected(err) {
+			return nil, fmt.Errorf("%w: %w", ErrOrderNotPlaced, err)
+		}
+		lastErr = err
+
+		s.c.Logger.Warn("Orbix order placement ambiguous, reconciling",
+			"clientOrderId", s.clientOrderId,
+			"attempt", attempt,
+			"error", err,
+		)
+		order, err = s.reconcile(ctx, submittedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: reconciliation failed: %w (placement error: %v)", ErrOrderStatusUnknown, err, lastErr)
+		}
+		if order != nil {
+			return &PlaceOrderResult{ClientOrderId: s.clientOrderId, Order: order, Attempts: attempt, Reconciled: true}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %w", ErrOrderNotPlaced, lastErr)
+		}
+	}
+	return nil, fmt.Errorf("%w after %d attempts: %w", ErrOrderNotPlaced, s.maxAttempts, lastErr)
+}
+
+// placementRejected reports whether err proves the create request did not
+// create an order: the API refused it, or it never left this host.
+func placementRejected(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode < 500
+	}
+	return isDialError(err)
+}
+
+// reconcile looks for the order on the exchange and claims it. It returns
+// a nil order when the order does not exist.
+func (s *PlaceOrderService) reconcile(ctx context.Context, submittedAt time.Time) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.reconcileTimeout)
+	defer cancel()
+
+	select {
+	case <-time.After(s.settleDelay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	seen := make(map[int]bool)
+	var candidates []Order
+	for _, status := range []OrderStatusType{OrderStatusOpen, OrderStatusClose} {
+		orders, err := s.c.NewListCurrentOrdersService(s.pair, DefaultReconcileLookback, 0).
+			Status(status).
+			Side(s.side).
+			Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s orders: %w", status, err)
+		}
+		if orders == nil {
+			continue
+		}
+		for _, o := range *orders {
+			if !seen[o.ID] {
+				seen[o.ID] = true
+				candidates = append(candidates, o)
+			}
+		}
+	}
+
+	// A market order can fill and drop off both lists before we look, but
+	// its fills stay in the trade history.
+	trades, err := s.c.NewTradeHistoryService().
+		Pair(s.pair).
+		Limit(DefaultReconcileLookback).
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trade history: %w", err)
+	}
+	for _, t := range trades {
+		if seen[t.OrderID] || t.Side != s.side {
+			continue
+		}
+		seen[t.OrderID] = true
+		o, err := s.c.NewGetOrderByIdService(strconv.Itoa(t.OrderID), s.pair).Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order %d: %w", t.OrderID, err)
+		}
+		candidates = append(candidates, *o)
+	}
+
+	// The oldest match not claimed by another client order id wins; the
+	// claim is atomic so concurrent reconciliations never share an order.
+	slices.SortFunc(candidates, func(a, b Order) int { return a.ID - b.ID })
+	for i := range candidates {
+		o := &candidates[i]
+		if s.matches(o, submittedAt) && s.c.placed.claim(s.clientOrderId, o) {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
+// matches reports whether o looks like the order this service submitted at
+// submittedAt.
+func (s *PlaceOrderService) matches(o *Order, submittedAt time.Time) bool {
+	if o.Side != s.side || o.Type != s.orderType || !equalDecimal(o.Amount, s.amount) {
+		return false
+	}
+	if s.orderType == OrderTypeLimit && !equalDecimal(o.Price, s.price) {
+		return false
+	}
+	if createdAt, err := o.CreatedTime(); err == nil {
+		return !createdAt.Before(submittedAt.Add(-DefaultReconcileClockSkew))
+	}
+	return true
+}
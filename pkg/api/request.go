@@ -3,7 +3,6 @@ package api
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 )
@@ -20,12 +19,10 @@ type params map[string]any
 type request struct {
 	method     string
 	endpoint   string
-	fullURL    string
 	secType    secType
 	query      url.Values
 	form       url.Values
 	header     http.Header
-	body       io.Reader
 	bodyBuffer []byte
 }
 
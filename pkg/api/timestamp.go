@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// timestampLayouts are the layouts the API uses for created_at fields.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+}
+
+// parseTimestamp parses an API timestamp, either formatted or as Unix
+// milliseconds.
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// CreatedTime parses the order's CreatedAt field.
+func (o Order) CreatedTime() (time.Time, error) {
+	return parseTimestamp(o.CreatedAt)
+}
+
+// CreatedTime parses the trade's CreatedAt field.
+func (t Trade) CreatedTime() (time.Time, error) {
+	return parseTimestamp(t.CreatedAt)
+}
+
+// CreatedTime parses the transfer's CreatedAt field.
+func (t Transfer) CreatedTime() (time.Time, error) {
+	return parseTimestamp(t.CreatedAt)
+}
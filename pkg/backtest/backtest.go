@@ -0,0 +1,268 @@
+// Package backtest replays market history through a trading strategy and
+// measures how it would have done. History comes from the kline and
+// aggregate trade services or from local files.
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// epsilon absorbs float rounding when comparing amounts.
+const epsilon = 1e-12
+
+var (
+	ErrNoData        = errors.New("error: no history to replay")
+	ErrInvalidConfig = errors.New("error: invalid backtest config")
+)
+
+// Strategy decides on orders as history unfolds.
+type Strategy interface {
+	// OnBar is called for every bar, after the open orders were matched
+	// against it. Orders placed now are matched from the next bar on, so
+	// a strategy never trades on a price it has already seen.
+	OnBar(ctx *Context, bar Bar)
+}
+
+// StrategyFunc adapts a function to a Strategy.
+type StrategyFunc func(ctx *Context, bar Bar)
+
+func (f StrategyFunc) OnBar(ctx *Context, bar Bar) {
+	f(ctx, bar)
+}
+
+type Config struct {
+	// InitialCash is the starting quote balance.
+	InitialCash float64
+	// FeeRate is charged on the value of every fill, 0.0025 = 0.25%.
+	FeeRate float64
+	// Slippage makes market fills this fraction worse than the bar open.
+	Slippage float64
+	// PeriodsPerYear annualizes the Sharpe ratio. Defaults to the number of
+	// bars a year holds at the median bar spacing.
+	PeriodsPerYear float64
+}
+
+func (cfg *Config) validate() error {
+	if cfg.InitialCash <= 0 {
+		return fmt.Errorf("%w: initial cash must be positive", ErrInvalidConfig)
+	}
+	if cfg.FeeRate < 0 || cfg.Slippage < 0 || cfg.PeriodsPerYear < 0 {
+		return fmt.Errorf("%w: negative fee rate, slippage or periods per year", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Order is an order of the simulation. Market orders have no price.
+type Order struct {
+	ID     int
+	Side   api.SideType
+	Type   api.OrderType
+	Price  float64
+	Amount float64
+	// Bar is the index of the bar the order was placed on.
+	Bar int
+}
+
+// Fill is an executed order.
+type Fill struct {
+	OrderID int
+	Bar     int
+	Time    time.Time
+	Side    api.SideType
+	Price   float64
+	Amount  float64
+	Fee     float64
+}
+
+// Context is the strategy's view of the simulation: balances, history and
+// order entry.
+type Context struct {
+	cfg      Config
+	bars     []Bar
+	index    int
+	cash     float64
+	position float64
+	orders   []Order
+	nextId   int
+	fills    []Fill
+}
+
+// Bar returns the index of the current bar.
+func (c *Context) Bar() int {
+	return c.index
+}
+
+// History returns the bars up to and including the current one.
+func (c *Context) History() []Bar {
+	return c.bars[:c.index+1]
+}
+
+// Cash returns the quote balance.
+func (c *Context) Cash() float64 {
+	return c.cash
+}
+
+// Position returns the base balance.
+func (c *Context) Position() float64 {
+	return c.position
+}
+
+// Equity returns cash plus the position at the current close.
+func (c *Context) Equity() float64 {
+	return c.cash + c.position*c.bars[c.index].Close
+}
+
+// Orders returns the open orders.
+func (c *Context) Orders() []Order {
+	return append([]Order(nil), c.orders...)
+}
+
+// Buy places a market buy of amount and returns its ID.
+func (c *Context) Buy(amount float64) int {
+	return c.place(api.SideTypeBuy, api.OrderTypeMarket, 0, amount)
+}
+
+// Sell places a market sell of amount and returns its ID.
+func (c *Context) Sell(amount float64) int {
+	return c.place(api.SideTypeSell, api.OrderTypeMarket, 0, amount)
+}
+
+// BuyLimit places a limit buy and returns its ID.
+func (c *Context) BuyLimit(price float64, amount float64) int {
+	return c.place(api.SideTypeBuy, api.OrderTypeLimit, price, amount)
+}
+
+// SellLimit places a limit sell and returns its ID.
+func (c *Context) SellLimit(price float64, amount float64) int {
+	return c.place(api.SideTypeSell, api.OrderTypeLimit, price, amount)
+}
+
+// Cancel cancels an open order. It reports whether the order was open.
+func (c *Context) Cancel(id int) bool {
+	for i, o := range c.orders {
+		if o.ID == id {
+			c.orders = append(c.orders[:i], c.orders[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// CancelAll cancels every open order.
+func (c *Context) CancelAll() {
+	c.orders = nil
+}
+
+func (c *Context) place(side api.SideType, typ api.OrderType, price float64, amount float64) int {
+	if amount <= 0 || (typ == api.OrderTypeLimit && price <= 0) {
+		return 0
+	}
+	c.nextId++
+	c.orders = append(c.orders, Order{
+		ID:     c.nextId,
+		Side:   side,
+		Type:   typ,
+		Price:  price,
+		Amount: amount,
+		Bar:    c.index,
+	})
+	return c.nextId
+}
+
+// match fills the open orders that bar reaches, oldest first. Market
+// orders fill at the open with slippage; limit orders at their price, or
+// the open if the bar gapped through it. Buys shrink to the cash available
+// and sells to the position; orders that cannot fill at all are dropped.
+func (c *Context) match(bar Bar) {
+	open := c.orders[:0]
+	for _, o := range c.orders {
+		price, ok := o.fillPrice(bar, c.cfg.Slippage)
+		if !ok {
+			open = append(open, o)
+			continue
+		}
+
+		amount := o.Amount
+		if o.Side == api.SideTypeBuy {
+			amount = math.Min(amount, c.cash/(price*(1+c.cfg.FeeRate)))
+		} else {
+			amount = math.Min(amount, c.position)
+		}
+		if amount <= epsilon {
+			continue
+		}
+
+		value := price * amount
+		fee := value * c.cfg.FeeRate
+		if o.Side == api.SideTypeBuy {
+			c.cash -= value + fee
+			c.position += amount
+		} else {
+			c.cash += value - fee
+			c.position -= amount
+		}
+		c.fills = append(c.fills, Fill{
+			OrderID: o.ID,
+			Bar:     c.index,
+			Time:    bar.Time,
+			Side:    o.Side,
+			Price:   price,
+			Amount:  amount,
+			Fee:     fee,
+		})
+	}
+	c.orders = open
+}
+
+func (o Order) fillPrice(bar Bar, slippage float64) (float64, bool) {
+	switch {
+	case o.Type == api.OrderTypeMarket && o.Side == api.SideTypeBuy:
+		return bar.Open * (1 + slippage), true
+	case o.Type == api.OrderTypeMarket:
+		return bar.Open * (1 - slippage), true
+	case o.Side == api.SideTypeBuy && bar.Low <= o.Price:
+		return math.Min(o.Price, bar.Open), true
+	case o.Side == api.SideTypeSell && bar.High >= o.Price:
+		return math.Max(o.Price, bar.Open), true
+	}
+	return 0, false
+}
+
+// Run loads the history of src and replays it.
+func Run(ctx context.Context, src Source, strategy Strategy, cfg Config) (*Result, error) {
+	bars, err := src.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Replay(bars, strategy, cfg)
+}
+
+// Replay runs strategy over bars, oldest first.
+func Replay(bars []Bar, strategy Strategy, cfg Config) (*Result, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if len(bars) == 0 {
+		return nil, ErrNoData
+	}
+
+	c := &Context{
+		cfg:  cfg,
+		bars: bars,
+		cash: cfg.InitialCash,
+	}
+	equity := make([]EquityPoint, 0, len(bars))
+	for i, bar := range bars {
+		c.index = i
+		c.match(bar)
+		strategy.OnBar(c, bar)
+		equity = append(equity, EquityPoint{Time: bar.Time, Equity: c.Equity()})
+	}
+	return newResult(cfg, bars, equity, c), nil
+}
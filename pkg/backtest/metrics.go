@@ -0,0 +1,254 @@
+package backtest
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// year is the span PeriodsPerYear is inferred over.
+const year = 365 * 24 * time.Hour
+
+// EquityPoint is the equity at the close of a bar.
+type EquityPoint struct {
+	Time     time.Time
+	Equity   float64
+	Drawdown float64
+}
+
+// RoundTrip is a closed position. Sells close the oldest open buys first,
+// so one fill can take part in several round trips.
+type RoundTrip struct {
+	EntryTime  time.Time
+	ExitTime   time.Time
+	Amount     float64
+	EntryPrice float64
+	ExitPrice  float64
+	Fees       float64
+	// PnL is net of fees.
+	PnL float64
+	// Return is PnL over the entry cost including its fee.
+	Return float64
+}
+
+func (t RoundTrip) Duration() time.Duration {
+	return t.ExitTime.Sub(t.EntryTime)
+}
+
+// TradeStats summarizes the round trips.
+type TradeStats struct {
+	Trades       int
+	Wins         int
+	Losses       int
+	WinRate      float64
+	AvgWin       float64
+	AvgLoss      float64
+	AvgReturn    float64
+	BestTrade    float64
+	WorstTrade   float64
+	ProfitFactor float64
+	AvgDuration  time.Duration
+}
+
+type Result struct {
+	InitialCash float64
+	FinalEquity float64
+	// Position is still open at the end and valued at the last close.
+	Position    float64
+	TotalReturn float64
+	// MaxDrawdown is the deepest fall from a previous equity peak, 0.2 = 20%.
+	MaxDrawdown         float64
+	MaxDrawdownDuration time.Duration
+	Sharpe              float64
+	Fees                float64
+	EquityCurve         []EquityPoint
+	Fills               []Fill
+	RoundTrips          []RoundTrip
+	Stats               TradeStats
+}
+
+func newResult(cfg Config, bars []Bar, equity []EquityPoint, c *Context) *Result {
+	res := &Result{
+		InitialCash: cfg.InitialCash,
+		FinalEquity: equity[len(equity)-1].Equity,
+		Position:    c.position,
+		EquityCurve: equity,
+		Fills:       c.fills,
+		RoundTrips:  roundTrips(c.fills),
+	}
+	res.TotalReturn = res.FinalEquity/res.InitialCash - 1
+	for _, f := range c.fills {
+		res.Fees += f.Fee
+	}
+	res.MaxDrawdown, res.MaxDrawdownDuration = drawdown(equity)
+
+	periods := cfg.PeriodsPerYear
+	if periods == 0 {
+		periods = periodsPerYear(bars)
+	}
+	res.Sharpe = sharpe(cfg.InitialCash, equity, periods)
+	res.Stats = tradeStats(res.RoundTrips)
+	return res
+}
+
+// drawdown fills in the drawdown of every point and returns the deepest
+// one with the longest time spent below a peak.
+func drawdown(equity []EquityPoint) (float64, time.Duration) {
+	var (
+		maxDrawdown float64
+		maxDuration time.Duration
+		peak        = equity[0].Equity
+		peakTime    = equity[0].Time
+	)
+	for i := range equity {
+		p := &equity[i]
+		if p.Equity >= peak {
+			peak, peakTime = p.Equity, p.Time
+			continue
+		}
+		p.Drawdown = 1 - p.Equity/peak
+		maxDrawdown = math.Max(maxDrawdown, p.Drawdown)
+		if d := p.Time.Sub(peakTime); d > maxDuration {
+			maxDuration = d
+		}
+	}
+	return maxDrawdown, maxDuration
+}
+
+// sharpe returns the annualized Sharpe ratio of the bar returns, with a
+// zero risk-free rate.
+func sharpe(initial float64, equity []EquityPoint, periods float64) float64 {
+	returns := make([]float64, len(equity))
+	prev := initial
+	for i, p := range equity {
+		returns[i] = p.Equity/prev - 1
+		prev = p.Equity
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	if len(returns) < 2 || variance == 0 {
+		return 0
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	return mean / std * math.Sqrt(periods)
+}
+
+// periodsPerYear infers the bars per year from the median bar spacing,
+// which is robust to gaps in the history.
+func periodsPerYear(bars []Bar) float64 {
+	if len(bars) < 2 {
+		return 0
+	}
+	gaps := make([]time.Duration, 0, len(bars)-1)
+	for i := 1; i < len(bars); i++ {
+		if d := bars[i].Time.Sub(bars[i-1].Time); d > 0 {
+			gaps = append(gaps, d)
+		}
+	}
+	if len(gaps) == 0 {
+		return 0
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return float64(year) / float64(gaps[len(gaps)/2])
+}
+
+// lot is the open part of a buy fill.
+type lot struct {
+	time   time.Time
+	amount float64
+	price  float64
+	fee    float64 // per unit
+}
+
+// roundTrips matches sells against the open buys, oldest first.
+func roundTrips(fills []Fill) []RoundTrip {
+	var (
+		lots  []lot
+		trips []RoundTrip
+	)
+	for _, f := range fills {
+		if f.Side == api.SideTypeBuy {
+			lots = append(lots, lot{time: f.Time, amount: f.Amount, price: f.Price, fee: f.Fee / f.Amount})
+			continue
+		}
+
+		exitFee := f.Fee / f.Amount
+		left := f.Amount
+		for left > epsilon && len(lots) > 0 {
+			l := &lots[0]
+			amount := math.Min(left, l.amount)
+			fees := (l.fee + exitFee) * amount
+			cost := (l.price + l.fee) * amount
+			pnl := (f.Price-l.price)*amount - fees
+			trips = append(trips, RoundTrip{
+				EntryTime:  l.time,
+				ExitTime:   f.Time,
+				Amount:     amount,
+				EntryPrice: l.price,
+				ExitPrice:  f.Price,
+				Fees:       fees,
+				PnL:        pnl,
+				Return:     pnl / cost,
+			})
+			left -= amount
+			l.amount -= amount
+			if l.amount <= epsilon {
+				lots = lots[1:]
+			}
+		}
+	}
+	return trips
+}
+
+func tradeStats(trips []RoundTrip) TradeStats {
+	s := TradeStats{Trades: len(trips)}
+	if len(trips) == 0 {
+		return s
+	}
+
+	var (
+		won, lost float64
+		returns   float64
+		duration  time.Duration
+	)
+	s.BestTrade, s.WorstTrade = math.Inf(-1), math.Inf(1)
+	for _, t := range trips {
+		if t.PnL > 0 {
+			s.Wins++
+			won += t.PnL
+		} else {
+			s.Losses++
+			lost -= t.PnL
+		}
+		returns += t.Return
+		duration += t.Duration()
+		s.BestTrade = math.Max(s.BestTrade, t.Return)
+		s.WorstTrade = math.Min(s.WorstTrade, t.Return)
+	}
+	s.WinRate = float64(s.Wins) / float64(s.Trades)
+	if s.Wins > 0 {
+		s.AvgWin = won / float64(s.Wins)
+	}
+	if s.Losses > 0 {
+		s.AvgLoss = lost / float64(s.Losses)
+	}
+	s.AvgReturn = returns / float64(s.Trades)
+	s.AvgDuration = duration / time.Duration(s.Trades)
+	switch {
+	case lost > 0:
+		s.ProfitFactor = won / lost
+	case won > 0:
+		s.ProfitFactor = math.Inf(1)
+	}
+	return s
+}
@@ -0,0 +1,300 @@
+package backtest
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// pageSize is the largest page of klines or trades one request returns.
+const pageSize = 1000
+
+// Bar is one step of history. Trades replay as bars whose prices are all
+// the trade price.
+type Bar struct {
+	Time   time.Time `json:"time"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+}
+
+// Source loads the history a backtest replays, oldest first.
+type Source interface {
+	Load(ctx context.Context) ([]Bar, error)
+}
+
+// KlineSource loads klines from the KlineService.
+type KlineSource struct {
+	Client   *api.Client
+	Symbol   string
+	Interval string
+	Start    time.Time
+	End      time.Time
+}
+
+func (s *KlineSource) Load(ctx context.Context) ([]Bar, error) {
+	var bars []Bar
+	from := s.Start
+	for from.Before(s.End) {
+		klines, err := s.Client.NewKlineService().Symbol(s.Symbol).Interval(s.Interval).
+			StartTime(from.UnixMilli()).EndTime(s.End.UnixMilli()).Limit(pageSize).
+			Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load klines of %s: %w", s.Symbol, err)
+		}
+		for _, k := range klines {
+			bar, err := barFromKline(k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid kline of %s: %w", s.Symbol, err)
+			}
+			bars = append(bars, bar)
+		}
+		if len(klines) < pageSize {
+			break
+		}
+		from = time.UnixMilli(klines[len(klines)-1].OpenTime + 1)
+	}
+	return bars, nil
+}
+
+func barFromKline(k api.Kline) (Bar, error) {
+	return parseBar(time.UnixMilli(k.OpenTime), k.Open, k.High, k.Low, k.Close, k.Volume)
+}
+
+// parseBar parses the prices and volume of a bar and validates it.
+func parseBar(t time.Time, open string, high string, low string, last string, volume string) (Bar, error) {
+	bar := Bar{Time: t}
+	var err error
+	if bar.Open, err = api.ParseFloat(open); err != nil {
+		return Bar{}, err
+	}
+	if bar.High, err = api.ParseFloat(high); err != nil {
+		return Bar{}, err
+	}
+	if bar.Low, err = api.ParseFloat(low); err != nil {
+		return Bar{}, err
+	}
+	if bar.Close, err = api.ParseFloat(last); err != nil {
+		return Bar{}, err
+	}
+	if bar.Volume, err = api.ParseFloat(volume); err != nil {
+		return Bar{}, err
+	}
+	if err := bar.validate(); err != nil {
+		return Bar{}, err
+	}
+	return bar, nil
+}
+
+// validate rejects a bar with a missing or non-positive price, a high
+// below its low or a negative volume. Missing prices parse as zero.
+func (b Bar) validate() error {
+	if b.Time.IsZero() {
+		return errors.New("bar has no time")
+	}
+	if b.Open <= 0 || b.High <= 0 || b.Low <= 0 || b.Close <= 0 {
+		return fmt.Errorf("bar at %s has a missing or non-positive price", b.Time.Format(time.RFC3339))
+	}
+	if b.High < b.Low {
+		return fmt.Errorf("bar at %s has high %v below low %v", b.Time.Format(time.RFC3339), b.High, b.Low)
+	}
+	if b.Volume < 0 {
+		return fmt.Errorf("bar at %s has a negative volume", b.Time.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// TradeSource loads aggregate trades from the AggregateTradeService.
+type TradeSource struct {
+	Client *api.Client
+	Symbol string
+	Start  time.Time
+	End    time.Time
+}
+
+func (s *TradeSource) Load(ctx context.Context) ([]Bar, error) {
+	var bars []Bar
+	next := s.Client.NewAggregateTradeService().Symbol(s.Symbol).StartTime(s.Start.UnixMilli()).EndTime(s.End.UnixMilli())
+	for {
+		trades, err := next.Limit(pageSize).Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load trades of %s: %w", s.Symbol, err)
+		}
+		for _, t := range trades {
+			if t.Timestamp > s.End.UnixMilli() {
+				return bars, nil
+			}
+			bar, err := barFromTrade(t)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trade of %s: %w", s.Symbol, err)
+			}
+			bars = append(bars, bar)
+		}
+		if len(trades) < pageSize {
+			return bars, nil
+		}
+		next = s.Client.NewAggregateTradeService().Symbol(s.Symbol).FromId(trades[len(trades)-1].AggregateTradeID + 1)
+	}
+}
+
+func barFromTrade(t api.AggregateTrade) (Bar, error) {
+	return parseBar(time.UnixMilli(t.Timestamp), t.Price, t.Price, t.Price, t.Price, t.Quantity)
+}
+
+// FileSource loads bars from a local file so backtests run offline. A .csv
+// file has the columns time,open,high,low,close,volume with time in Unix
+// milliseconds or RFC 3339 and an optional header. A .jsonl file holds one
+// Bar, kline array or aggregate trade per line.
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) Load(ctx context.Context) ([]Bar, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", s.Path, err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(s.Path)) {
+	case ".csv":
+		return readCSV(f)
+	case ".jsonl", ".json":
+		return readJSONL(f)
+	default:
+		return nil, fmt.Errorf("error: unsupported file type %q", filepath.Ext(s.Path))
+	}
+}
+
+func readCSV(r io.Reader) ([]Bar, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	var bars []Bar
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return bars, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		if len(record) < 6 {
+			return nil, fmt.Errorf("error: CSV line %d has %d columns, want 6", line, len(record))
+		}
+		t, err := parseTime(record[0])
+		if err != nil {
+			if line == 1 {
+				// Header
+				continue
+			}
+			return nil, fmt.Errorf("error: CSV line %d: %w", line, err)
+		}
+		bar, err := parseBar(t, record[1], record[2], record[3], record[4], record[5])
+		if err != nil {
+			return nil, fmt.Errorf("error: CSV line %d: %w", line, err)
+		}
+		bars = append(bars, bar)
+	}
+}
+
+func readJSONL(r io.Reader) ([]Bar, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var bars []Bar
+	for line := 1; scanner.Scan(); line++ {
+		data := []byte(strings.TrimSpace(scanner.Text()))
+		if len(data) == 0 {
+			continue
+		}
+		bar, err := decodeBar(data)
+		if err != nil {
+			return nil, fmt.Errorf("error: JSONL line %d: %w", line, err)
+		}
+		bars = append(bars, bar)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSONL: %w", err)
+	}
+	return bars, nil
+}
+
+// decodeBar decodes a Bar, a kline array or an aggregate trade.
+func decodeBar(data []byte) (Bar, error) {
+	if data[0] == '[' {
+		var k api.Kline
+		if err := json.Unmarshal(data, &k); err != nil {
+			return Bar{}, err
+		}
+		return barFromKline(k)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Bar{}, err
+	}
+	if _, ok := fields["a"]; ok {
+		var t api.AggregateTrade
+		if err := json.Unmarshal(data, &t); err != nil {
+			return Bar{}, err
+		}
+		return barFromTrade(t)
+	}
+	var bar Bar
+	if err := json.Unmarshal(data, &bar); err != nil {
+		return Bar{}, err
+	}
+	if err := bar.validate(); err != nil {
+		return Bar{}, err
+	}
+	return bar, nil
+}
+
+// WriteCSV saves bars in the CSV format FileSource reads.
+func WriteCSV(path string, bars []Bar) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"time", "open", "high", "low", "close", "volume"})
+	for _, b := range bars {
+		w.Write([]string{
+			strconv.FormatInt(b.Time.UnixMilli(), 10),
+			formatFloat(b.Open),
+			formatFloat(b.High),
+			formatFloat(b.Low),
+			formatFloat(b.Close),
+			formatFloat(b.Volume),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+func parseTime(s string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,477 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/trading"
+)
+
+// CatchUpPolicy decides what happens to runs missed while the DCA was not
+// running.
+type CatchUpPolicy string
+
+const (
+	// CatchUpSkip records missed runs without buying.
+	CatchUpSkip CatchUpPolicy = "skip"
+	// CatchUpOnce buys once for the latest missed run.
+	CatchUpOnce CatchUpPolicy = "once"
+	// CatchUpAll buys for every missed run, up to MaxCatchUp of the latest.
+	CatchUpAll CatchUpPolicy = "all"
+)
+
+// maxMissedRuns bounds how many missed runs are looked at after downtime.
+const maxMissedRuns = 1000
+
+var ErrInvalidDCAPlan = errors.New("error: invalid DCA plan")
+
+// DCAPlan buys a fixed quote amount of a pair on a schedule.
+type DCAPlan struct {
+	// Name identifies the plan in the history. Defaults to the pair and
+	// schedule.
+	Name string
+	Pair string
+	// Symbol is the exchange info symbol of the pair. Defaults to Pair.
+	Symbol string
+	// Schedule is a cron expression, see ParseSchedule.
+	Schedule string
+	// Amount is the quote amount of each buy, e.g. THB for btc_thb.
+	Amount float64
+	// OrderType is market or limit. Defaults to market.
+	OrderType api.OrderType
+	// LimitOffset prices limit orders this fraction above the best ask,
+	// 0.001 = 0.1%.
+	LimitOffset float64
+	// CatchUp defaults to CatchUpSkip.
+	CatchUp CatchUpPolicy
+	// MaxCatchUp caps the buys of CatchUpAll. Zero means no cap.
+	MaxCatchUp int
+}
+
+func (p *DCAPlan) validate() error {
+	if p.Pair == "" || p.Amount <= 0 {
+		return fmt.Errorf("%w: a pair and a positive amount are required", ErrInvalidDCAPlan)
+	}
+	if p.OrderType != api.OrderTypeMarket && p.OrderType != api.OrderTypeLimit {
+		return fmt.Errorf("%w: unknown order type %q", ErrInvalidDCAPlan, p.OrderType)
+	}
+	if p.LimitOffset < 0 || p.MaxCatchUp < 0 {
+		return fmt.Errorf("%w: negative limit offset or catch-up cap", ErrInvalidDCAPlan)
+	}
+	switch p.CatchUp {
+	case CatchUpSkip, CatchUpOnce, CatchUpAll:
+	default:
+		return fmt.Errorf("%w: unknown catch-up policy %q", ErrInvalidDCAPlan, p.CatchUp)
+	}
+	return nil
+}
+
+// quoteAsset returns the quote currency of the pair, e.g. thb for btc_thb.
+func (p *DCAPlan) quoteAsset() string {
+	_, quote, _ := strings.Cut(p.Pair, "_")
+	return quote
+}
+
+// DCAStatus is the outcome of a scheduled run.
+type DCAStatus string
+
+const (
+	DCAPlaced DCAStatus = "placed"
+	// DCASkipped means the run was due but not bought, e.g. for a short
+	// balance. Reason says why.
+	DCASkipped DCAStatus = "skipped"
+	// DCAMissed means the run fell in downtime and the catch-up policy
+	// dropped it.
+	DCAMissed DCAStatus = "missed"
+	DCAFailed DCAStatus = "failed"
+)
+
+// DCAExecution is one entry of the history.
+type DCAExecution struct {
+	Plan        string        `json:"plan"`
+	Pair        string        `json:"pair"`
+	ScheduledAt time.Time     `json:"scheduled_at"`
+	ExecutedAt  time.Time     `json:"executed_at"`
+	Status      DCAStatus     `json:"status"`
+	Reason      string        `json:"reason,omitempty"`
+	OrderId     int           `json:"order_id,omitempty"`
+	OrderType   api.OrderType `json:"order_type,omitempty"`
+	Price       string        `json:"price,omitempty"`
+	Amount      string        `json:"amount,omitempty"`
+	// Filled and AveragePrice are read back from the order until it is no
+	// longer open, then Settled is set.
+	Filled       float64 `json:"filled"`
+	AveragePrice float64 `json:"average_price"`
+	Settled      bool    `json:"settled"`
+}
+
+// DCAStats sums the filled buys of a plan.
+type DCAStats struct {
+	Buys   int
+	Amount float64
+	Cost   float64
+	// AverageCost is Cost / Amount.
+	AverageCost float64
+}
+
+type DCAOptions struct {
+	// History persists executions, so runs missed during downtime are
+	// detected and average cost survives restarts. Optional.
+	History trading.Store[DCAExecution]
+	// Location is the time zone schedules are read in. Defaults to
+	// time.Local.
+	Location *time.Location
+}
+
+type dcaPlan struct {
+	DCAPlan
+	schedule *Schedule
+	rules    rules
+	next     time.Time
+}
+
+// DCA runs DCA plans and keeps the history of their executions.
+type DCA struct {
+	c     *api.Client
+	opts  DCAOptions
+	plans []*dcaPlan
+
+	mu      sync.Mutex
+	history []DCAExecution
+}
+
+func NewDCA(ctx context.Context, c *api.Client, plans []DCAPlan, opts DCAOptions) (*DCA, error) {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	d := &DCA{c: c, opts: opts}
+
+	names := make(map[string]bool)
+	for _, p := range plans {
+		if p.Symbol == "" {
+			p.Symbol = p.Pair
+		}
+		if p.Name == "" {
+			p.Name = p.Pair + " " + p.Schedule
+		}
+		if p.OrderType == "" {
+			p.OrderType = api.OrderTypeMarket
+		}
+		if p.CatchUp == "" {
+			p.CatchUp = CatchUpSkip
+		}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("%w: duplicate plan name %q", ErrInvalidDCAPlan, p.Name)
+		}
+		names[p.Name] = true
+
+		schedule, err := ParseSchedule(p.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		r, err := loadRules(ctx, c, p.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		d.plans = append(d.plans, &dcaPlan{DCAPlan: p, schedule: schedule, rules: r})
+	}
+
+	if opts.History != nil {
+		history, err := opts.History.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load DCA history: %w", err)
+		}
+		d.history = history
+	}
+	return d, nil
+}
+
+// History returns the executions of all plans, oldest first.
+func (d *DCA) History() []DCAExecution {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.history)
+}
+
+// Stats returns the filled buys of the named plan.
+func (d *DCA) Stats(plan string) DCAStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var stats DCAStats
+	for _, e := range d.history {
+		if e.Plan != plan || e.Filled <= 0 {
+			continue
+		}
+		stats.Buys++
+		stats.Amount += e.Filled
+		stats.Cost += e.Filled * e.AveragePrice
+	}
+	if stats.Amount > 0 {
+		stats.AverageCost = stats.Cost / stats.Amount
+	}
+	return stats
+}
+
+// Run catches up on missed runs, then buys on schedule until ctx is done.
+func (d *DCA) Run(ctx context.Context) error {
+	now := time.Now().In(d.opts.Location)
+	for _, p := range d.plans {
+		d.catchUp(ctx, p, now)
+		p.next = p.schedule.Next(now)
+	}
+
+	for {
+		var due *dcaPlan
+		for _, p := range d.plans {
+			if !p.next.IsZero() && (due == nil || p.next.Before(due.next)) {
+				due = p
+			}
+		}
+		if due == nil {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		timer := time.NewTimer(time.Until(due.next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		d.record(d.execute(ctx, due, due.next))
+		due.next = due.schedule.Next(due.next)
+		if err := d.Refresh(ctx); err != nil {
+			d.c.Logger.Warn("Orbix DCA refresh failed", "error", err)
+		}
+	}
+}
+
+// catchUp applies the plan's catch-up policy to the runs scheduled after
+// its last recorded run and up to now. A plan without history starts
+// fresh.
+func (d *DCA) catchUp(ctx context.Context, p *dcaPlan, now time.Time) {
+	last, ok := d.lastRun(p.Name)
+	if !ok {
+		return
+	}
+
+	var missed []time.Time
+	for t := p.schedule.Next(last.In(d.opts.Location)); !t.IsZero() && !t.After(now) && len(missed) < maxMissedRuns; t = p.schedule.Next(t) {
+		missed = append(missed, t)
+	}
+
+	buy := 0
+	switch p.CatchUp {
+	case CatchUpOnce:
+		buy = min(len(missed), 1)
+	case CatchUpAll:
+		buy = len(missed)
+		if p.MaxCatchUp > 0 {
+			buy = min(buy, p.MaxCatchUp)
+		}
+	}
+
+	for i, at := range missed {
+		if i < len(missed)-buy {
+			d.record(DCAExecution{
+				Plan:        p.Name,
+				Pair:        p.Pair,
+				ScheduledAt: at,
+				ExecutedAt:  now,
+				Status:      DCAMissed,
+				Reason:      fmt.Sprintf("missed during downtime, catch-up policy %s", p.CatchUp),
+			})
+			continue
+		}
+		d.record(d.execute(ctx, p, at))
+	}
+}
+
+func (d *DCA) lastRun(plan string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var last time.Time
+	for _, e := range d.history {
+		if e.Plan == plan && e.ScheduledAt.After(last) {
+			last = e.ScheduledAt
+		}
+	}
+	return last, !last.IsZero()
+}
+
+// execute buys the plan's amount for the run scheduled at, or skips it when
+// the quote balance is short.
+func (d *DCA) execute(ctx context.Context, p *dcaPlan, at time.Time) DCAExecution {
+	exec := DCAExecution{
+		Plan:        p.Name,
+		Pair:        p.Pair,
+		ScheduledAt: at,
+		ExecutedAt:  time.Now(),
+		OrderType:   p.OrderType,
+	}
+	fail := func(status DCAStatus, err error) DCAExecution {
+		exec.Status = status
+		exec.Reason = err.Error()
+		d.c.Logger.Warn("Orbix DCA buy not placed", "plan", p.Name, "status", status, "error", err)
+		return exec
+	}
+
+	balance, err := d.balance(ctx, p.quoteAsset())
+	if err != nil {
+		return fail(DCAFailed, err)
+	}
+	if balance < p.Amount {
+		return fail(DCASkipped, fmt.Errorf("insufficient %s balance: %v available, %v needed", p.quoteAsset(), balance, p.Amount))
+	}
+
+	book, err := d.c.NewOrderbookService(p.Pair).Side(api.SideTypeSell).Do(ctx)
+	if err != nil {
+		return fail(DCAFailed, fmt.Errorf("failed to read order book: %w", err))
+	}
+	if len(book.Asks) == 0 {
+		return fail(DCASkipped, fmt.Errorf("no asks for %s", p.Pair))
+	}
+	ask, err := api.ParseFloat(book.Asks[0].Price)
+	if err != nil {
+		return fail(DCAFailed, fmt.Errorf("invalid best ask: %w", err))
+	}
+
+	price, sizePrice := "0", ask
+	if p.OrderType == api.OrderTypeLimit {
+		price = p.rules.price(ask * (1 + p.LimitOffset))
+		if sizePrice, err = api.ParseFloat(price); err != nil {
+			return fail(DCAFailed, err)
+		}
+	}
+	amount := p.rules.amount(p.Amount / sizePrice)
+	if err := p.rules.check(sizePrice, amount); err != nil {
+		return fail(DCASkipped, err)
+	}
+
+	res, err := d.c.NewPlaceOrderService(api.NewClientOrderId(), p.Pair, api.SideTypeBuy, p.OrderType, price, amount).
+		Do(ctx)
+	if err != nil {
+		return fail(DCAFailed, err)
+	}
+	exec.Status = DCAPlaced
+	exec.OrderId = res.Order.ID
+	exec.Price = price
+	exec.Amount = amount
+	return exec
+}
+
+// balance returns the available balance of asset.
+func (d *DCA) balance(ctx context.Context, asset string) (float64, error) {
+	user, err := d.c.NewListBalanceAddressService().Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balances: %w", err)
+	}
+	for symbol, wallet := range user.Wallets {
+		if strings.EqualFold(string(symbol), asset) {
+			balance, err := api.ParseFloat(wallet.AvailableBalance)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s balance: %w", asset, err)
+			}
+			return balance, nil
+		}
+	}
+	return 0, nil
+}
+
+// Refresh reads back the fills of placed buys that are not settled yet.
+func (d *DCA) Refresh(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var errs []error
+	for i := range d.history {
+		e := &d.history[i]
+		if e.Status != DCAPlaced || e.Settled {
+			continue
+		}
+		order, err := d.c.NewGetOrderByIdService(strconv.Itoa(e.OrderId), e.Pair).Do(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get DCA order %d: %w", e.OrderId, err))
+			continue
+		}
+		filled, avg, err := orderFills(order)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid DCA order %d: %w", e.OrderId, err))
+			continue
+		}
+		e.Filled, e.AveragePrice = filled, avg
+		e.Settled = order.Status != string(api.OrderStatusOpen)
+	}
+	if err := d.saveLocked(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// orderFills returns the executed amount of order and its average price,
+// derived from the cost or the limit price when the exchange leaves it out.
+// A missing amount or remaining amount is an error, not zero, which would
+// book the whole order as filled.
+func orderFills(order *api.Order) (filled float64, avg float64, err error) {
+	if strings.TrimSpace(order.Amount) == "" || strings.TrimSpace(order.RemainingAmount) == "" {
+		return 0, 0, errors.New("error: no amount or remaining amount")
+	}
+	amount, err := api.ParseFloat(order.Amount)
+	if err != nil {
+		return 0, 0, err
+	}
+	remaining, err := api.ParseFloat(order.RemainingAmount)
+	if err != nil {
+		return 0, 0, err
+	}
+	if avg, err = api.ParseFloat(order.AveragePrice); err != nil {
+		return 0, 0, err
+	}
+	filled = amount - remaining
+	if avg > 0 || filled <= 0 {
+		return filled, avg, nil
+	}
+	cost, err := api.ParseFloat(order.Cost)
+	if err != nil {
+		return 0, 0, err
+	}
+	if cost > 0 {
+		return filled, cost / filled, nil
+	}
+	price, err := api.ParseFloat(order.Price)
+	if err != nil {
+		return 0, 0, err
+	}
+	return filled, price, nil
+}
+
+func (d *DCA) record(exec DCAExecution) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.history = append(d.history, exec)
+	if err := d.saveLocked(); err != nil {
+		d.c.Logger.Warn("Orbix DCA history not saved", "error", err)
+	}
+}
+
+func (d *DCA) saveLocked() error {
+	if d.opts.History == nil {
+		return nil
+	}
+	if err := d.opts.History.Save(d.history); err != nil {
+		return fmt.Errorf("failed to save DCA history: %w", err)
+	}
+	return nil
+}
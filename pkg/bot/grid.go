@@ -0,0 +1,547 @@
+// Package bot implements long-running trading bots built on the order
+// services of the api package.
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/trading"
+)
+
+// GridSpacing is how grid levels are spaced between the bounds.
+type GridSpacing string
+
+const (
+	// GridArithmetic spaces levels by the same price difference.
+	GridArithmetic GridSpacing = "arithmetic"
+	// GridGeometric spaces levels by the same price ratio.
+	GridGeometric GridSpacing = "geometric"
+)
+
+// Default Constants
+const (
+	DefaultPollInterval = 5 * time.Second
+	listPageSize        = 100
+)
+
+var ErrInvalidGrid = errors.New("error: invalid grid config")
+
+type GridConfig struct {
+	Pair string
+	// Symbol is the exchange info symbol of the pair. Defaults to Pair.
+	Symbol string
+	// Lower and Upper bound the grid; both are levels.
+	Lower float64
+	Upper float64
+	// Levels is the number of price levels, bounds included. At least 2.
+	Levels  int
+	Spacing GridSpacing
+	// Amount is the base amount of every order.
+	Amount float64
+	// PollInterval is how often Run syncs with the exchange. Defaults to
+	// DefaultPollInterval.
+	PollInterval time.Duration
+	// Store persists the cells across restarts, realized profit included.
+	// Optional: without it a restarted grid adopts its open orders by price.
+	Store trading.Store[GridCell]
+}
+
+func (cfg *GridConfig) validate() error {
+	if cfg.Pair == "" {
+		return fmt.Errorf("%w: missing pair", ErrInvalidGrid)
+	}
+	if cfg.Lower <= 0 || cfg.Upper <= cfg.Lower {
+		return fmt.Errorf("%w: bounds must satisfy 0 < lower < upper", ErrInvalidGrid)
+	}
+	if cfg.Levels < 2 {
+		return fmt.Errorf("%w: at least 2 levels are needed", ErrInvalidGrid)
+	}
+	if cfg.Spacing != GridArithmetic && cfg.Spacing != GridGeometric {
+		return fmt.Errorf("%w: unknown spacing %q", ErrInvalidGrid, cfg.Spacing)
+	}
+	if cfg.Amount <= 0 {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidGrid)
+	}
+	return nil
+}
+
+// levels returns the level prices, lowest first.
+func (cfg *GridConfig) levels() []float64 {
+	n := cfg.Levels - 1
+	levels := make([]float64, cfg.Levels)
+	for i := range levels {
+		if cfg.Spacing == GridGeometric {
+			levels[i] = cfg.Lower * math.Pow(cfg.Upper/cfg.Lower, float64(i)/float64(n))
+		} else {
+			levels[i] = cfg.Lower + (cfg.Upper-cfg.Lower)*float64(i)/float64(n)
+		}
+	}
+	return levels
+}
+
+// GridCell is the span between two adjacent levels. It holds either a buy
+// at BuyPrice or, once that filled, a sell at SellPrice; when the sell
+// fills the round trip is booked and the buy placed again.
+type GridCell struct {
+	Index     int    `json:"index"`
+	BuyPrice  string `json:"buy_price"`
+	SellPrice string `json:"sell_price"`
+	Amount    string `json:"amount"`
+	// Side is the side of the cell's order. Empty until first placed.
+	Side    api.SideType `json:"side,omitempty"`
+	OrderId int          `json:"order_id,omitempty"`
+	// EntryPrice is the price of the buy the pending sell closes. Sells
+	// placed at start against existing inventory use BuyPrice. While a buy
+	// is partly filled it is the average price of the filled part.
+	EntryPrice float64 `json:"entry_price,omitempty"`
+	// Filled is the amount the side already executed through orders
+	// cancelled outside the grid. The next order of the side is only for
+	// the rest.
+	Filled     float64 `json:"filled,omitempty"`
+	RoundTrips int     `json:"round_trips"`
+	// Profit is the realized quote profit of the cell before fees.
+	Profit float64 `json:"profit"`
+}
+
+// GridStatus is a snapshot of a grid.
+type GridStatus struct {
+	Cells      []GridCell
+	Profit     float64
+	RoundTrips int
+}
+
+// Grid keeps a ladder of buy and sell limit orders between two bounds.
+// Each filled order is replaced by the opposite order one level away.
+type Grid struct {
+	c     *api.Client
+	cfg   GridConfig
+	rules rules
+	// levels are the level prices, lowest first, and amount the order
+	// amount, as placed.
+	levels []float64
+	amount float64
+
+	// orders serializes Sync and Close, which place and cancel orders
+	// without holding mu.
+	orders sync.Mutex
+	mu     sync.Mutex
+	cells  []GridCell
+}
+
+// NewGrid builds the grid from cfg, rounding levels to the symbol's tick
+// size and the amount to its lot step, and restores saved cells from the
+// store. Call Run or Sync to place the orders.
+func NewGrid(ctx context.Context, c *api.Client, cfg GridConfig) (*Grid, error) {
+	if cfg.Symbol == "" {
+		cfg.Symbol = cfg.Pair
+	}
+	if cfg.Spacing == "" {
+		cfg.Spacing = GridArithmetic
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	r, err := loadRules(ctx, c, cfg.Symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make([]string, cfg.Levels)
+	levels := make([]float64, cfg.Levels)
+	for i, level := range cfg.levels() {
+		prices[i] = r.price(level)
+		if levels[i], err = api.ParseFloat(prices[i]); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidGrid, err)
+		}
+		if i > 0 && levels[i] <= levels[i-1] {
+			return nil, fmt.Errorf("%w: levels are closer than the tick size %s", ErrInvalidGrid, r.TickSize)
+		}
+	}
+	amount := r.amount(cfg.Amount)
+	if err := r.check(levels[0], amount); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidGrid, err)
+	}
+	amountValue, err := api.ParseFloat(amount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidGrid, err)
+	}
+
+	cells := make([]GridCell, cfg.Levels-1)
+	for i := range cells {
+		cells[i] = GridCell{
+			Index:     i,
+			BuyPrice:  prices[i],
+			SellPrice: prices[i+1],
+			Amount:    amount,
+		}
+	}
+
+	if cfg.Store != nil {
+		saved, err := cfg.Store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load grid: %w", err)
+		}
+		if len(saved) > 0 {
+			if !sameLadder(saved, cells) {
+				return nil, fmt.Errorf("%w: saved grid does not match the config", ErrInvalidGrid)
+			}
+			cells = saved
+		}
+	}
+
+	return &Grid{
+		c:      c,
+		cfg:    cfg,
+		rules:  r,
+		levels: levels,
+		amount: amountValue,
+		cells:  cells,
+	}, nil
+}
+
+func sameLadder(a []GridCell, b []GridCell) bool {
+	return slices.EqualFunc(a, b, func(x GridCell, y GridCell) bool {
+		return x.Index == y.Index && x.BuyPrice == y.BuyPrice && x.SellPrice == y.SellPrice && x.Amount == y.Amount
+	})
+}
+
+// Status returns the cells and the realized profit.
+func (g *Grid) Status() GridStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	status := GridStatus{Cells: slices.Clone(g.cells)}
+	for _, cell := range g.cells {
+		status.Profit += cell.Profit
+		status.RoundTrips += cell.RoundTrips
+	}
+	return status
+}
+
+// Run syncs the grid every PollInterval until ctx is done.
+func (g *Grid) Run(ctx context.Context) error {
+	ticker := time.NewTicker(g.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := g.Sync(ctx); err != nil {
+			g.c.Logger.Warn("Orbix grid sync failed", "pair", g.cfg.Pair, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync reconciles the cells with the open orders of the pair. Filled
+// orders are flipped to the opposite side, orders cancelled outside the
+// grid are placed again for what they left unfilled, and cells without an
+// order adopt a matching open order or get a new one: a buy below the
+// market, a sell above it.
+func (g *Grid) Sync(ctx context.Context) error {
+	g.orders.Lock()
+	defer g.orders.Unlock()
+
+	open, err := g.openOrders(ctx)
+	if err != nil {
+		return err
+	}
+
+	cells := g.Status().Cells
+	adopted := make(map[int]bool)
+	for _, cell := range cells {
+		if cell.OrderId != 0 {
+			adopted[cell.OrderId] = true
+		}
+	}
+
+	// Cells placed for the first time need the mid price to pick a side.
+	var mid float64
+	var errs []error
+	if slices.ContainsFunc(cells, func(cell GridCell) bool { return cell.Side == "" }) {
+		if mid, err = g.midPrice(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := range cells {
+		cell := &cells[i]
+		if err := g.syncCell(ctx, cell, open, adopted, mid); err != nil {
+			errs = append(errs, err)
+		}
+		g.setCell(*cell)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.saveLocked(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// syncCell settles, adopts or places the order of one cell. A cell without
+// a side is left unplaced when mid, the mid price, is unknown. The caller
+// holds g.orders.
+func (g *Grid) syncCell(ctx context.Context, cell *GridCell, open map[int]api.Order, adopted map[int]bool, mid float64) error {
+	if cell.OrderId != 0 {
+		if _, ok := open[cell.OrderId]; ok {
+			return nil
+		}
+		if err := g.settle(ctx, cell); err != nil {
+			return err
+		}
+	}
+	if cell.OrderId == 0 && cell.Side == "" {
+		g.adopt(cell, open, adopted)
+	}
+	if cell.OrderId != 0 {
+		return nil
+	}
+
+	if cell.Side == "" {
+		if mid == 0 {
+			return nil
+		}
+		cell.Side = api.SideTypeBuy
+		if g.buyPrice(cell) >= mid {
+			cell.Side = api.SideTypeSell
+		}
+	}
+	return g.place(ctx, cell)
+}
+
+// setCell publishes the synced state of cell to Status.
+func (g *Grid) setCell(cell GridCell) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cells[cell.Index] = cell
+}
+
+// settle handles a cell order that is no longer open. Its fills are
+// booked, and once the side is filled the cell flips; otherwise the order
+// is cleared so the rest is placed again. The caller holds g.orders.
+func (g *Grid) settle(ctx context.Context, cell *GridCell) error {
+	order, err := g.c.NewGetOrderByIdService(strconv.Itoa(cell.OrderId), g.cfg.Pair).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get grid order %d: %w", cell.OrderId, err)
+	}
+	if order.Status == string(api.OrderStatusOpen) {
+		// Not listed yet or listed late: check again next sync.
+		return nil
+	}
+	// Read as zero, a missing remaining amount would book the order as
+	// filled: keep it and check again next sync.
+	if strings.TrimSpace(order.Amount) == "" || strings.TrimSpace(order.RemainingAmount) == "" {
+		return fmt.Errorf("error: grid order %d has no amount or remaining amount", order.ID)
+	}
+	amount, err := api.ParseFloat(order.Amount)
+	if err != nil {
+		return fmt.Errorf("invalid grid order %d: %w", order.ID, err)
+	}
+	remaining, err := api.ParseFloat(order.RemainingAmount)
+	if err != nil {
+		return fmt.Errorf("invalid grid order %d: %w", order.ID, err)
+	}
+	price, err := api.ParseFloat(order.AveragePrice)
+	if err != nil {
+		return fmt.Errorf("invalid grid order %d: %w", order.ID, err)
+	}
+	cell.OrderId = 0
+
+	if filled := amount - remaining; filled > 0 {
+		g.book(cell, filled, price)
+	}
+	if remaining > 0 && g.orderAmount(cell) != "" {
+		g.c.Logger.Warn("Orbix grid order cancelled outside the grid", "pair", g.cfg.Pair, "orderId", order.ID, "remaining", order.RemainingAmount)
+		return nil
+	}
+
+	if cell.Side == api.SideTypeBuy {
+		cell.Side = api.SideTypeSell
+	} else {
+		cell.RoundTrips++
+		cell.EntryPrice = 0
+		cell.Side = api.SideTypeBuy
+	}
+	cell.Filled = 0
+	return nil
+}
+
+// book records amount executed at price on the cell's side: a buy
+// averages it into the entry price, a sell realizes its profit.
+func (g *Grid) book(cell *GridCell, amount float64, price float64) {
+	if cell.Side == api.SideTypeBuy {
+		if price <= 0 {
+			price = g.buyPrice(cell)
+		}
+		cell.EntryPrice = (cell.EntryPrice*cell.Filled + price*amount) / (cell.Filled + amount)
+	} else {
+		if price <= 0 {
+			price = g.sellPrice(cell)
+		}
+		cell.Profit += (price - cell.EntryPrice) * amount
+	}
+	cell.Filled += amount
+}
+
+// orderAmount returns the amount of the cell's next order: the cell amount
+// less what the side already filled. It is empty when the rest is below
+// the minimum order, which completes the side.
+func (g *Grid) orderAmount(cell *GridCell) string {
+	if cell.Filled == 0 {
+		return cell.Amount
+	}
+	price := g.buyPrice(cell)
+	if cell.Side == api.SideTypeSell {
+		price = g.sellPrice(cell)
+	}
+	amount := g.rules.amount(g.amount - cell.Filled)
+	if g.rules.check(price, amount) != nil {
+		return ""
+	}
+	return amount
+}
+
+// adopt takes over an open order at one of the cell's prices, left by an
+// earlier run. The caller holds g.orders.
+func (g *Grid) adopt(cell *GridCell, open map[int]api.Order, adopted map[int]bool) {
+	for id, order := range open {
+		if adopted[id] {
+			continue
+		}
+		if (order.Side == api.SideTypeBuy && equalPrice(order.Price, cell.BuyPrice)) ||
+			(order.Side == api.SideTypeSell && equalPrice(order.Price, cell.SellPrice)) {
+			adopted[id] = true
+			cell.OrderId = id
+			cell.Side = order.Side
+			if cell.Side == api.SideTypeSell && cell.EntryPrice == 0 {
+				cell.EntryPrice = g.buyPrice(cell)
+			}
+			return
+		}
+	}
+}
+
+// place places the cell's order. The caller holds g.orders.
+func (g *Grid) place(ctx context.Context, cell *GridCell) error {
+	price := cell.BuyPrice
+	if cell.Side == api.SideTypeSell {
+		price = cell.SellPrice
+		if cell.EntryPrice == 0 {
+			cell.EntryPrice = g.buyPrice(cell)
+		}
+	}
+	res, err := g.c.NewPlaceOrderService(api.NewClientOrderId(), g.cfg.Pair, cell.Side, api.OrderTypeLimit, price, g.orderAmount(cell)).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to place grid %s at %s: %w", cell.Side, price, err)
+	}
+	cell.OrderId = res.Order.ID
+	return nil
+}
+
+// openOrders returns the open orders of the pair by ID.
+func (g *Grid) openOrders(ctx context.Context) (map[int]api.Order, error) {
+	open := make(map[int]api.Order)
+	for offset := 0; ; offset += listPageSize {
+		orders, err := g.c.NewListCurrentOrdersService(g.cfg.Pair, listPageSize, offset).
+			Status(api.OrderStatusOpen).
+			Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list open orders for %s: %w", g.cfg.Pair, err)
+		}
+		if orders == nil {
+			return open, nil
+		}
+		for _, order := range *orders {
+			open[order.ID] = order
+		}
+		if len(*orders) < listPageSize {
+			return open, nil
+		}
+	}
+}
+
+func (g *Grid) midPrice(ctx context.Context) (float64, error) {
+	book, err := g.c.NewOrderbookService(g.cfg.Pair).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read order book: %w", err)
+	}
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return 0, fmt.Errorf("error: order book of %s is empty", g.cfg.Pair)
+	}
+	bid, err := api.ParseFloat(book.Bids[0].Price)
+	if err != nil {
+		return 0, fmt.Errorf("invalid best bid: %w", err)
+	}
+	ask, err := api.ParseFloat(book.Asks[0].Price)
+	if err != nil {
+		return 0, fmt.Errorf("invalid best ask: %w", err)
+	}
+	return (bid + ask) / 2, nil
+}
+
+// buyPrice and sellPrice return the level prices of cell.
+func (g *Grid) buyPrice(cell *GridCell) float64 {
+	return g.levels[cell.Index]
+}
+
+func (g *Grid) sellPrice(cell *GridCell) float64 {
+	return g.levels[cell.Index+1]
+}
+
+// Close cancels the grid's open orders. Cells keep their side, so a later
+// Sync places the same ladder again.
+func (g *Grid) Close(ctx context.Context) error {
+	g.orders.Lock()
+	defer g.orders.Unlock()
+
+	var errs []error
+	for _, cell := range g.Status().Cells {
+		if cell.OrderId == 0 {
+			continue
+		}
+		if err := g.c.NewCancelOrderService(strconv.Itoa(cell.OrderId), g.cfg.Pair).Do(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to cancel grid order %d: %w", cell.OrderId, err))
+			continue
+		}
+		cell.OrderId = 0
+		g.setCell(cell)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.saveLocked(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (g *Grid) saveLocked() error {
+	if g.cfg.Store == nil {
+		return nil
+	}
+	if err := g.cfg.Store.Save(g.cells); err != nil {
+		return fmt.Errorf("failed to save grid: %w", err)
+	}
+	return nil
+}
+
+// equalPrice reports whether a and b are the same price. Unparseable
+// prices never compare equal.
+func equalPrice(a string, b string) bool {
+	cmp, err := api.CmpDecimal(a, b)
+	return err == nil && cmp == 0
+}
@@ -0,0 +1,389 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/valuation"
+)
+
+// Default Constants
+const (
+	DefaultQuoteAsset         = "thb"
+	DefaultRebalanceTolerance = 0.01
+	// routeAsset is the asset trades route through, and valuations prefer
+	// to, when an asset has no pair with the quote asset.
+	routeAsset = "usdt"
+)
+
+var ErrInvalidRebalance = errors.New("error: invalid rebalance config")
+
+type RebalanceConfig struct {
+	// Targets are the target weights by asset, e.g. {"btc": 0.5, "eth":
+	// 0.2, "thb": 0.3}. They must add up to 1 and are relative to the value
+	// of the listed assets; other holdings are left alone.
+	Targets map[string]float64
+	// Quote is the asset holdings are valued in. Defaults to
+	// DefaultQuoteAsset.
+	Quote string
+	// Tolerance is the band around each target weight, 0.01 = ±1 point,
+	// inside which an asset is not traded. Defaults to
+	// DefaultRebalanceTolerance.
+	Tolerance float64
+	// OrderType is market or limit. Limit orders are priced at the touch.
+	// Defaults to market.
+	OrderType api.OrderType
+	// DryRun prints the plan to Output instead of trading.
+	DryRun bool
+	// Output defaults to os.Stdout.
+	Output io.Writer
+}
+
+func (cfg *RebalanceConfig) validate() error {
+	var total float64
+	for asset, w := range cfg.Targets {
+		if w < 0 {
+			return fmt.Errorf("%w: negative weight for %s", ErrInvalidRebalance, asset)
+		}
+		total += w
+	}
+	if math.Abs(total-1) > 1e-9 {
+		return fmt.Errorf("%w: weights add up to %v, not 1", ErrInvalidRebalance, total)
+	}
+	if cfg.Tolerance < 0 || cfg.Tolerance >= 1 {
+		return fmt.Errorf("%w: tolerance must be in [0, 1)", ErrInvalidRebalance)
+	}
+	if cfg.OrderType != api.OrderTypeMarket && cfg.OrderType != api.OrderTypeLimit {
+		return fmt.Errorf("%w: unknown order type %q", ErrInvalidRebalance, cfg.OrderType)
+	}
+	return nil
+}
+
+// RebalanceHolding is a listed asset valued in the quote asset.
+type RebalanceHolding struct {
+	Asset   string
+	Balance float64
+	Price   float64
+	Value   float64
+	Weight  float64
+	Target  float64
+}
+
+// RebalanceTrade is one order of a plan. Skipped trades keep the reason,
+// e.g. below the minimum notional.
+type RebalanceTrade struct {
+	Asset  string
+	Pair   string
+	Side   api.SideType
+	Amount string
+	Price  string
+	// Value is the traded value in the quote asset.
+	Value float64
+	// Route is the asset a routed trade moves, set on both of its legs.
+	Route   string
+	Skipped string
+	OrderId int
+	Err     error
+}
+
+// RebalancePlan holds the valuation and the trades that reach the targets.
+// Sells come first so their proceeds fund the buys.
+type RebalancePlan struct {
+	Quote    string
+	Total    float64
+	Holdings []RebalanceHolding
+	Trades   []RebalanceTrade
+}
+
+// WriteTo prints the plan as tables.
+func (p *RebalancePlan) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "asset\tbalance\tprice\tvalue (%s)\tweight\ttarget\t\n", p.Quote)
+	for _, h := range p.Holdings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\t%.2f%%\t%.2f%%\t\n", h.Asset, formatFloat(h.Balance), formatFloat(h.Price), h.Value, h.Weight*100, h.Target*100)
+	}
+	fmt.Fprintf(tw, "total\t\t\t%.2f\t\t\t\n\n", p.Total)
+	fmt.Fprintf(tw, "pair\tside\tamount\tprice\tvalue (%s)\tnote\t\n", p.Quote)
+	for _, t := range p.Trades {
+		note := t.Skipped
+		if t.Err != nil {
+			note = t.Err.Error()
+		} else if t.OrderId != 0 {
+			note = "order " + strconv.Itoa(t.OrderId)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.2f\t%s\t\n", t.Pair, t.Side, t.Amount, t.Price, t.Value, note)
+	}
+	err := tw.Flush()
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Rebalancer trades wallet balances towards target weights.
+type Rebalancer struct {
+	c   *api.Client
+	cfg RebalanceConfig
+}
+
+func NewRebalancer(c *api.Client, cfg RebalanceConfig) (*Rebalancer, error) {
+	targets := make(map[string]float64, len(cfg.Targets))
+	for asset, w := range cfg.Targets {
+		targets[strings.ToLower(asset)] = w
+	}
+	cfg.Targets = targets
+	if cfg.Quote == "" {
+		cfg.Quote = DefaultQuoteAsset
+	}
+	cfg.Quote = strings.ToLower(cfg.Quote)
+	if cfg.Tolerance == 0 {
+		cfg.Tolerance = DefaultRebalanceTolerance
+	}
+	if cfg.OrderType == "" {
+		cfg.OrderType = api.OrderTypeMarket
+	}
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &Rebalancer{c: c, cfg: cfg}, nil
+}
+
+// Run plans the rebalance and executes it, or prints it on a dry run.
+func (r *Rebalancer) Run(ctx context.Context) (*RebalancePlan, error) {
+	plan, err := r.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !r.cfg.DryRun {
+		err = r.Execute(ctx, plan)
+	}
+	if _, werr := plan.WriteTo(r.cfg.Output); werr != nil {
+		err = errors.Join(err, werr)
+	}
+	return plan, err
+}
+
+// Plan values the listed assets and computes the trades that bring each
+// one outside its tolerance band back to its target weight.
+func (r *Rebalancer) Plan(ctx context.Context) (*RebalancePlan, error) {
+	user, err := r.c.NewListBalanceAddressService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balances: %w", err)
+	}
+	tickers, err := r.c.NewOrderbookTickerService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tickers: %w", err)
+	}
+	info, err := r.c.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exchange info: %w", err)
+	}
+
+	balances := make(map[string]float64)
+	for symbol, wallet := range user.Wallets {
+		balance, err := api.ParseFloat(wallet.AvailableBalance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s balance: %w", symbol, err)
+		}
+		balances[strings.ToLower(string(symbol))] += balance
+	}
+	books := make(map[string]api.OrderbookTicker, len(tickers))
+	for pair, t := range tickers {
+		books[strings.ToLower(pair)] = t
+	}
+	now := time.Now()
+	prices := valuation.NewGraph(valuation.GraphOptions{Via: []string{routeAsset}})
+	if err := prices.SetTickers(books, now); err != nil {
+		r.c.Logger.Warn("Orbix rebalance skipped tickers", "error", err)
+	}
+
+	plan := &RebalancePlan{Quote: r.cfg.Quote}
+	for asset, target := range r.cfg.Targets {
+		price, ok := prices.Price(asset, r.cfg.Quote, now)
+		if !ok {
+			return nil, fmt.Errorf("error: no price for %s in %s", asset, r.cfg.Quote)
+		}
+		h := RebalanceHolding{
+			Asset:   asset,
+			Balance: balances[asset],
+			Price:   price.Price,
+			Value:   balances[asset] * price.Price,
+			Target:  target,
+		}
+		plan.Total += h.Value
+		plan.Holdings = append(plan.Holdings, h)
+	}
+	sort.Slice(plan.Holdings, func(i, j int) bool {
+		return plan.Holdings[i].Value > plan.Holdings[j].Value
+	})
+	if plan.Total <= 0 {
+		return plan, nil
+	}
+
+	var sells, buys []RebalanceTrade
+	for i := range plan.Holdings {
+		h := &plan.Holdings[i]
+		h.Weight = h.Value / plan.Total
+		if h.Asset == r.cfg.Quote || math.Abs(h.Weight-h.Target) <= r.cfg.Tolerance {
+			continue
+		}
+		trades := r.trades(books, prices, info, h, h.Target*plan.Total-h.Value)
+		if trades[0].Side == api.SideTypeSell {
+			sells = append(sells, trades...)
+		} else {
+			buys = append(buys, trades...)
+		}
+	}
+	plan.Trades = append(sells, buys...)
+	return plan, nil
+}
+
+// trades sizes the orders moving holding h by value, in the quote asset.
+// Without a quote pair the asset trades on its route pair, with a second
+// leg converting between the route and quote assets: after a sell, before
+// a buy. An asset with neither, e.g. one only priced by triangulation,
+// gets a single skipped trade, and when one leg of a route is skipped so
+// is the other, so a route is never traded halfway.
+func (r *Rebalancer) trades(books map[string]api.OrderbookTicker, prices *valuation.Graph, info *api.ExchangeInfo, h *RebalanceHolding, value float64) []RebalanceTrade {
+	side := api.SideTypeBuy
+	if value < 0 {
+		side = api.SideTypeSell
+	}
+	value = math.Abs(value)
+
+	pair := h.Asset + "_" + r.cfg.Quote
+	if _, ok := books[pair]; ok || r.cfg.Quote == routeAsset {
+		return []RebalanceTrade{r.order(books, info, h.Asset, pair, side, value, 1, h.Balance)}
+	}
+
+	routePair, convertPair := h.Asset+"_"+routeAsset, routeAsset+"_"+r.cfg.Quote
+	_, hasRoute := books[routePair]
+	_, hasConvert := books[convertPair]
+	routePrice, ok := prices.Price(routeAsset, r.cfg.Quote, time.Now())
+	if h.Asset == routeAsset || !hasRoute || !hasConvert || !ok {
+		return []RebalanceTrade{{Asset: h.Asset, Pair: pair, Side: side, Value: value, Skipped: "no tradable pair with " + r.cfg.Quote}}
+	}
+	leg := r.order(books, info, h.Asset, routePair, side, value, routePrice.Price, h.Balance)
+	convert := r.order(books, info, routeAsset, convertPair, side, value, 1, math.Inf(1))
+	leg.Route, convert.Route = h.Asset, h.Asset
+	switch {
+	case leg.Skipped != "" && convert.Skipped == "":
+		convert.Skipped = "route leg skipped"
+	case convert.Skipped != "" && leg.Skipped == "":
+		leg.Skipped = "conversion leg skipped"
+	}
+	if side == api.SideTypeSell {
+		return []RebalanceTrade{leg, convert}
+	}
+	return []RebalanceTrade{convert, leg}
+}
+
+// order sizes one order on pair worth value in the quote asset, where
+// quotePrice is the price of the pair's quote asset. Sells are capped at
+// balance.
+func (r *Rebalancer) order(books map[string]api.OrderbookTicker, info *api.ExchangeInfo, asset string, pair string, side api.SideType, value float64, quotePrice float64, balance float64) RebalanceTrade {
+	t := RebalanceTrade{
+		Asset: asset,
+		Pair:  pair,
+		Side:  side,
+		Value: value,
+	}
+	book, ok := books[pair]
+	if !ok {
+		t.Skipped = "no tradable pair"
+		return t
+	}
+
+	var tr api.TradingRules
+	if s, ok := info.Symbol(pair); ok {
+		tr = s.TradingRules()
+	}
+	rr, err := newRules(tr)
+	if err != nil {
+		t.Skipped = err.Error()
+		return t
+	}
+
+	touchPrice := book.Ask.Price
+	if side == api.SideTypeSell {
+		touchPrice = book.Bid.Price
+	}
+	touch, err := api.ParseFloat(touchPrice)
+	if err != nil {
+		t.Skipped = err.Error()
+		return t
+	}
+	if touch <= 0 {
+		t.Skipped = "empty order book"
+		return t
+	}
+	t.Price = "0"
+	if r.cfg.OrderType == api.OrderTypeLimit {
+		t.Price = rr.price(touch)
+	}
+	amount := value / quotePrice / touch
+	if side == api.SideTypeSell {
+		amount = math.Min(amount, balance)
+	}
+	t.Amount = rr.amount(amount)
+	if err := rr.check(touch, t.Amount); err != nil {
+		t.Skipped = err.Error()
+	}
+	return t
+}
+
+// Execute places the plan's trades that are not skipped, sells first.
+// When a leg of a route fails, the leg after it is skipped rather than
+// leaving the route asset traded halfway.
+func (r *Rebalancer) Execute(ctx context.Context, plan *RebalancePlan) error {
+	var errs []error
+	failed := make(map[string]bool)
+	for i := range plan.Trades {
+		t := &plan.Trades[i]
+		if t.Skipped != "" || t.OrderId != 0 {
+			continue
+		}
+		if t.Route != "" && failed[t.Route] {
+			t.Skipped = "other route leg failed"
+			continue
+		}
+		res, err := r.c.NewPlaceOrderService(api.NewClientOrderId(), t.Pair, t.Side, r.cfg.OrderType, t.Price, t.Amount).
+			Do(ctx)
+		if err != nil {
+			t.Err = err
+			if t.Route != "" {
+				failed[t.Route] = true
+			}
+			errs = append(errs, fmt.Errorf("failed to %s %s %s: %w", t.Side, t.Amount, t.Pair, err))
+			continue
+		}
+		t.OrderId = res.Order.ID
+	}
+	return errors.Join(errs...)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
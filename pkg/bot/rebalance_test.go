@@ -0,0 +1,87 @@
+package bot_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/bot"
+	"github.com/BinLab64/Orbix-client/pkg/orbixtest"
+)
+
+// newRoutedExchange serves an exchange where eth only trades against usdt,
+// which trades against thb, and an account holding only thb.
+func newRoutedExchange(t *testing.T) (*orbixtest.Exchange, *httptest.Server) {
+	t.Helper()
+	ex := orbixtest.New(orbixtest.Options{})
+	rules := api.TradingRules{TickSize: "0.01", StepSize: "0.0001", MinQty: "0.0001"}
+	ex.AddPair("eth_usdt", rules)
+	ex.AddPair("usdt_thb", rules)
+	ex.AddAccount("maker", "secret")
+	ex.AddAccount("bot", "secret")
+	for asset, amount := range map[string]float64{"eth": 100, "usdt": 1_000_000, "thb": 10_000_000} {
+		if err := ex.Deposit("maker", asset, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ex.Deposit("bot", "thb", 100_000); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range []struct {
+		pair  string
+		side  api.SideType
+		price float64
+	}{
+		{"eth_usdt", api.SideTypeBuy, 1990},
+		{"eth_usdt", api.SideTypeSell, 2010},
+		{"usdt_thb", api.SideTypeBuy, 34.9},
+		{"usdt_thb", api.SideTypeSell, 35.1},
+	} {
+		if _, err := ex.PlaceOrder("maker", o.pair, o.side, api.OrderTypeLimit, o.price, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(ex)
+	t.Cleanup(srv.Close)
+	return ex, srv
+}
+
+func TestRebalanceSkipsRouteAfterFailedLeg(t *testing.T) {
+	ex, srv := newRoutedExchange(t)
+	r, err := bot.NewRebalancer(ex.NewClient(srv.URL, "bot"), bot.RebalanceConfig{
+		Targets:   map[string]float64{"eth": 0.5, "thb": 0.5},
+		OrderType: api.OrderTypeLimit,
+		Output:    io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The eth buy routes through usdt: the usdt buy goes first and is
+	// rejected, so the eth buy must not be placed.
+	ex.InjectError(http.MethodPost, "/api/orders/", http.StatusBadRequest, 1)
+	plan, err := r.Run(context.Background())
+	if !errors.Is(err, api.ErrOrderNotPlaced) {
+		t.Fatalf("error = %v, want ErrOrderNotPlaced", err)
+	}
+	if len(plan.Trades) != 2 {
+		t.Fatalf("trades = %+v, want the two legs of the eth route", plan.Trades)
+	}
+	convert, leg := plan.Trades[0], plan.Trades[1]
+	if convert.Pair != "usdt_thb" || convert.Err == nil {
+		t.Errorf("first leg = %+v, want a failed usdt_thb order", convert)
+	}
+	if leg.Pair != "eth_usdt" || leg.Skipped == "" || leg.OrderId != 0 {
+		t.Errorf("second leg = %+v, want a skipped eth_usdt order", leg)
+	}
+	if n := ex.Calls(http.MethodPost, "/api/orders/"); n != 1 {
+		t.Errorf("create requests = %d, want 1", n)
+	}
+	if got := ex.Balances("bot")["eth"]; got.Available != 0 || got.Locked != 0 {
+		t.Errorf("eth balance = %+v, want none bought", got)
+	}
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// Steps used when a symbol has no price or lot size filter.
+const (
+	DefaultTickSize = "0.01"
+	DefaultStepSize = "0.0001"
+
+	defaultTick = 0.01
+	defaultStep = 0.0001
+)
+
+// rules are the trading rules of a symbol with the steps parsed.
+type rules struct {
+	api.TradingRules
+	tick        float64
+	step        float64
+	minQty      float64
+	minNotional float64
+}
+
+// loadRules reads the trading rules of symbol from the exchange info.
+func loadRules(ctx context.Context, c *api.Client, symbol string) (rules, error) {
+	info, err := c.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return rules{}, fmt.Errorf("failed to load exchange info: %w", err)
+	}
+	s, ok := info.Symbol(symbol)
+	if !ok {
+		return rules{}, fmt.Errorf("error: unknown symbol %q", symbol)
+	}
+	return newRules(s.TradingRules())
+}
+
+func newRules(tr api.TradingRules) (rules, error) {
+	r := rules{TradingRules: tr}
+	var err error
+	if r.tick, err = api.ParseFloat(tr.TickSize); err != nil {
+		return rules{}, fmt.Errorf("invalid tick size: %w", err)
+	}
+	if r.tick <= 0 {
+		r.TickSize, r.tick = DefaultTickSize, defaultTick
+	}
+	if r.step, err = api.ParseFloat(tr.StepSize); err != nil {
+		return rules{}, fmt.Errorf("invalid step size: %w", err)
+	}
+	if r.step <= 0 {
+		r.StepSize, r.step = DefaultStepSize, defaultStep
+	}
+	if r.minQty, err = api.ParseFloat(tr.MinQty); err != nil {
+		return rules{}, fmt.Errorf("invalid minimum quantity: %w", err)
+	}
+	if r.minNotional, err = api.ParseFloat(tr.MinNotional); err != nil {
+		return rules{}, fmt.Errorf("invalid minimum notional: %w", err)
+	}
+	return r, nil
+}
+
+// price rounds price to the nearest tick.
+func (r rules) price(price float64) string {
+	return formatStep(math.Round(price/r.tick)*r.tick, r.TickSize)
+}
+
+// amount rounds amount down to the lot step.
+func (r rules) amount(amount float64) string {
+	// Nudge up before flooring so 0.3 stays 0.3 despite binary rounding.
+	return formatStep(math.Floor(amount/r.step+1e-9)*r.step, r.StepSize)
+}
+
+// check returns an error if an order of amount at price breaks the minimum
+// quantity or notional.
+func (r rules) check(price float64, amount string) error {
+	a, err := api.ParseFloat(amount)
+	if err != nil {
+		return err
+	}
+	if a <= 0 || a < r.minQty {
+		return fmt.Errorf("error: amount %s is below the minimum quantity %s", amount, r.MinQty)
+	}
+	if price*a < r.minNotional {
+		return fmt.Errorf("error: order of %s at %v is below the minimum notional %s", amount, price, r.MinNotional)
+	}
+	return nil
+}
+
+// formatStep formats x with the decimals of step.
+func formatStep(x float64, step string) string {
+	return strconv.FormatFloat(x, 'f', stepDecimals(step), 64)
+}
+
+// stepDecimals returns the number of significant decimals of a step such
+// as "0.01000000".
+func stepDecimals(step string) int {
+	i := strings.IndexByte(step, '.')
+	if i < 0 {
+		return 0
+	}
+	return len(strings.TrimRight(step[i+1:], "0"))
+}
@@ -0,0 +1,370 @@
+// Package cassette records exchange interactions to files and replays them,
+// so tests run deterministically and offline. A Cassette is an
+// http.RoundTripper: plug it into api.ClientOptions.HttpClient. Recorded
+// credentials and signatures are scrubbed before they reach the file.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces scrubbed values.
+const Redacted = "REDACTED"
+
+var (
+	ErrUnmatched = errors.New("error: no recorded interaction matches the request")
+	ErrUnused    = errors.New("error: recorded interactions were not replayed")
+)
+
+type Mode int
+
+const (
+	// ModeReplay answers from the cassette and never touches the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests through the transport and records them,
+	// replacing the cassette on Close.
+	ModeRecord
+)
+
+// sensitiveHeaders are redacted from recorded requests and responses.
+var sensitiveHeaders = []string{"Authorization", "Signature", "Cookie", "Set-Cookie"}
+
+// sensitiveFields are redacted from recorded JSON bodies and query strings,
+// matched case-insensitively.
+var sensitiveFields = map[string]bool{
+	"apikey":             true,
+	"api_key":            true,
+	"secret":             true,
+	"signature":          true,
+	"email":              true,
+	"anti_phishing_code": true,
+}
+
+// volatileFields change on every request and are left out of matching.
+var volatileFields = map[string]bool{
+	"nonce": true,
+}
+
+type Options struct {
+	Mode Mode
+	// Transport sends the requests while recording. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// Scrub, when set, is applied to every interaction after the built-in
+	// scrubbing and before it is stored.
+	Scrub func(*Interaction)
+}
+
+type Request struct {
+	Method   string      `json:"method"`
+	Endpoint string      `json:"endpoint"`
+	Params   string      `json:"params"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request    Request   `json:"request"`
+	Response   Response  `json:"response"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type file struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Cassette records or replays the interactions of one file. Replay matches
+// requests by method, endpoint and canonical params: the query and JSON
+// body fields sorted by key, volatile fields such as the nonce left out.
+// Identical requests are answered in the order they were recorded.
+type Cassette struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	scrub     func(*Interaction)
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	unmatched    []string
+}
+
+// Open opens the cassette at path. In replay mode the file must exist.
+func Open(path string, opts Options) (*Cassette, error) {
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+	c := &Cassette{
+		path:      path,
+		mode:      opts.Mode,
+		transport: opts.Transport,
+		scrub:     opts.Scrub,
+	}
+	if c.mode == ModeRecord {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+	c.interactions = f.Interactions
+	c.used = make([]bool, len(f.Interactions))
+	return c, nil
+}
+
+// Client returns an HTTP client sending requests through the cassette.
+func (c *Cassette) Client() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// Interactions returns the recorded interactions.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	interactions := make([]Interaction, len(c.interactions))
+	for i, in := range c.interactions {
+		interactions[i] = *in
+	}
+	return interactions
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.mode == ModeRecord {
+		return c.record(req, body)
+	}
+	return c.replay(req, body)
+}
+
+func (c *Cassette) record(req *http.Request, body []byte) (*http.Response, error) {
+	res, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(data))
+
+	in := &Interaction{
+		Request: Request{
+			Method:   req.Method,
+			Endpoint: req.URL.Path,
+			Params:   canonicalParams(req.URL.Query(), body),
+			Header:   scrubHeader(req.Header),
+			Body:     scrubBody(body),
+		},
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Header:     scrubHeader(res.Header),
+			Body:       scrubBody(data),
+		},
+		RecordedAt: time.Now().UTC(),
+	}
+	in.Request.Params = scrubParams(in.Request.Params)
+	if c.scrub != nil {
+		c.scrub(in)
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, in)
+	c.mu.Unlock()
+	return res, nil
+}
+
+func (c *Cassette) replay(req *http.Request, body []byte) (*http.Response, error) {
+	params := scrubParams(canonicalParams(req.URL.Query(), body))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, in := range c.interactions {
+		if c.used[i] || in.Request.Method != req.Method || in.Request.Endpoint != req.URL.Path || in.Request.Params != params {
+			continue
+		}
+		c.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	call := req.Method + " " + req.URL.Path
+	if params != "" {
+		call += "?" + params
+	}
+	c.unmatched = append(c.unmatched, call)
+	return nil, fmt.Errorf("%w: %s in %s", ErrUnmatched, call, c.path)
+}
+
+// Close saves the cassette in record mode. In replay mode it reports the
+// requests that matched nothing and the interactions never replayed, so a
+// test fails even if the code under test swallowed the error.
+func (c *Cassette) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mode == ModeRecord {
+		return c.saveLocked()
+	}
+
+	if len(c.unmatched) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnmatched, strings.Join(c.unmatched, ", "))
+	}
+	var unused []string
+	for i, in := range c.interactions {
+		if !c.used[i] {
+			unused = append(unused, in.Request.Method+" "+in.Request.Endpoint)
+		}
+	}
+	if len(unused) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnused, strings.Join(unused, ", "))
+	}
+	return nil
+}
+
+// saveLocked writes the cassette file. The caller holds c.mu.
+func (c *Cassette) saveLocked() error {
+	data, err := json.MarshalIndent(file{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("err marshalling JSON: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// readBody reads the request body and puts it back for the transport.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// canonicalParams merges the query and the fields of a JSON object body
+// into one query string sorted by key, leaving out volatile fields.
+func canonicalParams(query url.Values, body []byte) string {
+	params := url.Values{}
+	for k, vs := range query {
+		if !volatileFields[strings.ToLower(k)] {
+			params[k] = append(params[k], vs...)
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) == nil {
+		for k, raw := range fields {
+			if volatileFields[strings.ToLower(k)] {
+				continue
+			}
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				params.Add(k, s)
+			} else {
+				params.Add(k, string(raw))
+			}
+		}
+	}
+	return params.Encode()
+}
+
+func scrubHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, key := range sensitiveHeaders {
+		if h.Get(key) != "" {
+			h.Set(key, Redacted)
+		}
+	}
+	return h
+}
+
+func scrubParams(params string) string {
+	values, err := url.ParseQuery(params)
+	if err != nil {
+		return params
+	}
+	for k := range values {
+		if sensitiveFields[strings.ToLower(k)] {
+			values.Set(k, Redacted)
+		}
+	}
+	return values.Encode()
+}
+
+// scrubBody redacts sensitive fields anywhere in a JSON body. Other bodies
+// are kept as they are.
+func scrubBody(body []byte) string {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if len(body) == 0 || dec.Decode(&v) != nil {
+		return string(body)
+	}
+	data, err := json.Marshal(scrubValue(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(data)
+}
+
+func scrubValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if sensitiveFields[strings.ToLower(k)] {
+				v[k] = Redacted
+			} else {
+				v[k] = scrubValue(field)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = scrubValue(item)
+		}
+	}
+	return v
+}
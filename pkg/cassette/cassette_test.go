@@ -0,0 +1,184 @@
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/cassette"
+)
+
+const (
+	apiKey       = "test-api-key"
+	apiSecret    = "test-api-secret"
+	email        = "trader@example.com"
+	phishingCode = "phish-me-not"
+)
+
+// server is an exchange stub that remembers the signatures it was sent.
+type server struct {
+	mu         sync.Mutex
+	signatures []string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if sig := r.Header.Get("Signature"); sig != "" {
+		s.signatures = append(s.signatures, sig)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/users/me":
+		fmt.Fprintf(w, `{"id":1,"email":%q,"anti_phishing_code":%q,"wallets":{"btc":{"available_balance":"1.5"}}}`, email, phishingCode)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/orders/":
+		fmt.Fprint(w, `{"id":7,"pair":"btc_thb","side":"buy","type":"limit","price":"90","amount":"1","remaining_amount":"1","status":"open"}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newClient(httpClient *http.Client, baseURL string, nonce *api.NonceManager) *api.Client {
+	return api.NewClient(api.ClientOptions{
+		ClientAuth: api.NewClientAuth(apiKey, apiSecret),
+		BaseURL:    baseURL,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		HttpClient: httpClient,
+		Nonce:      nonce,
+	})
+}
+
+// session makes the calls recorded and replayed by the tests.
+func session(ctx context.Context, c *api.Client) error {
+	user, err := c.NewListBalanceAddressService().Do(ctx)
+	if err != nil {
+		return err
+	}
+	if user.Wallets["btc"].AvailableBalance != "1.5" {
+		return fmt.Errorf("btc balance = %q, want 1.5", user.Wallets["btc"].AvailableBalance)
+	}
+	order, err := c.NewCreateOrderService("btc_thb", api.SideTypeBuy, api.OrderTypeLimit, "90", "1").Do(ctx)
+	if err != nil {
+		return err
+	}
+	if order.ID != 7 {
+		return fmt.Errorf("order id = %d, want 7", order.ID)
+	}
+	return nil
+}
+
+// record records session against a stub server, signing with nonce, and
+// returns the cassette path and the stub.
+func record(t *testing.T, nonce *api.NonceManager) (string, *server) {
+	t.Helper()
+	stub := &server{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	cas, err := cassette.Open(path, cassette.Options{Mode: cassette.ModeRecord})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session(context.Background(), newClient(cas.Client(), srv.URL, nonce)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cas.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, stub
+}
+
+func openReplay(t *testing.T, path string) *cassette.Cassette {
+	t.Helper()
+	cas, err := cassette.Open(path, cassette.Options{Mode: cassette.ModeReplay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cas
+}
+
+func TestRecordRedactsSecrets(t *testing.T) {
+	path, stub := record(t, api.NewNonceManager(""))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := string(data)
+
+	secrets := []string{apiKey, apiSecret, email, phishingCode}
+	if len(stub.signatures) == 0 {
+		t.Fatal("no signed request was recorded")
+	}
+	secrets = append(secrets, stub.signatures...)
+	for _, secret := range secrets {
+		if strings.Contains(file, secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+	if !strings.Contains(file, cassette.Redacted) {
+		t.Errorf("cassette has no redacted value:\n%s", file)
+	}
+}
+
+func TestReplayIgnoresNonce(t *testing.T) {
+	nonce := api.NewNonceManager("")
+	path, _ := record(t, nonce)
+
+	// Sharing the nonce manager signs the replayed requests with nonces
+	// greater than every recorded one; the cassette must still answer them,
+	// without a server.
+	cas := openReplay(t, path)
+	if err := session(context.Background(), newClient(cas.Client(), "http://replay.invalid", nonce)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cas.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayUnmatched(t *testing.T) {
+	path, _ := record(t, api.NewNonceManager(""))
+
+	cas := openReplay(t, path)
+	c := newClient(cas.Client(), "http://replay.invalid", api.NewNonceManager(""))
+	ctx := context.Background()
+	if err := session(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.NewCreateOrderService("btc_thb", api.SideTypeBuy, api.OrderTypeLimit, "91", "1").Do(ctx)
+	if !errors.Is(err, cassette.ErrUnmatched) {
+		t.Errorf("request error = %v, want ErrUnmatched", err)
+	}
+	if err := cas.Close(); !errors.Is(err, cassette.ErrUnmatched) {
+		t.Errorf("Close error = %v, want ErrUnmatched", err)
+	}
+}
+
+func TestReplayUnused(t *testing.T) {
+	path, _ := record(t, api.NewNonceManager(""))
+
+	cas := openReplay(t, path)
+	c := newClient(cas.Client(), "http://replay.invalid", api.NewNonceManager(""))
+	if _, err := c.NewListBalanceAddressService().Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	err := cas.Close()
+	if !errors.Is(err, cassette.ErrUnused) {
+		t.Fatalf("Close error = %v, want ErrUnused", err)
+	}
+	if !strings.Contains(err.Error(), "POST /api/orders/") {
+		t.Errorf("Close error = %v, want the unused create order call", err)
+	}
+}
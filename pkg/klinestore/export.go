@@ -0,0 +1,49 @@
+package klinestore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+type Format string
+
+const (
+	// FormatCSV writes a header and one kline per row.
+	FormatCSV Format = "csv"
+	// FormatJSONL writes one kline per line in the array form of the klines
+	// endpoint.
+	FormatJSONL Format = "jsonl"
+)
+
+// Export writes the stored klines of [start, end) to w. Both formats load
+// with backtest.FileSource.
+func (s *Store) Export(w io.Writer, format Format, symbol string, interval string, start time.Time, end time.Time) error {
+	klines, err := s.Range(symbol, interval, start, end)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, klines)
+	case FormatJSONL:
+		return writeJSONL(w, klines)
+	}
+	return fmt.Errorf("error: unknown export format %q", format)
+}
+
+func writeJSONL(w io.Writer, klines []api.Kline) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, k := range klines {
+		row := []any{k.OpenTime, k.Open, k.High, k.Low, k.Close, k.Volume, k.CloseTime, k.QuoteAssetVolume, k.TradeNum}
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("err marshalling JSON: %w", err)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,446 @@
+// Package klinestore keeps klines on disk, keyed by symbol and interval,
+// so backtests and research stop re-downloading candles. The store syncs
+// incrementally from the KlineService, detects and backfills gaps and
+// answers range queries from monthly partitions.
+package klinestore
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// partitionLayout names the monthly partition files.
+const partitionLayout = "2006-01"
+
+var (
+	ErrUnsupportedInterval = errors.New("error: unsupported kline interval")
+	ErrInvalidSymbol       = errors.New("error: invalid symbol")
+)
+
+// intervals are the supported kline intervals.
+var intervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"3m":  3 * time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+	"3d":  3 * 24 * time.Hour,
+	"1w":  7 * 24 * time.Hour,
+}
+
+// IntervalDuration returns the length of a kline interval.
+func IntervalDuration(interval string) (time.Duration, error) {
+	d, ok := intervals[interval]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedInterval, interval)
+	}
+	return d, nil
+}
+
+// Gap is a span of missing klines, by open time, End exclusive.
+type Gap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// series is the stored klines of one symbol and interval.
+type series struct {
+	dir      string
+	interval time.Duration
+	// parts caches loaded partitions by month, sorted by open time.
+	parts map[string][]api.Kline
+	// empty are the spans the exchange has no klines for.
+	empty []Gap
+}
+
+// Store is a kline store rooted at a directory laid out as
+// <symbol>/<interval>/<yyyy-mm>.csv. It is safe for concurrent use.
+type Store struct {
+	dir string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return &Store{dir: dir, series: make(map[string]*series)}, nil
+}
+
+// seriesLocked returns the series of symbol and interval, loading its list
+// of empty spans. The caller holds s.mu.
+func (s *Store) seriesLocked(symbol string, interval string) (*series, error) {
+	d, err := IntervalDuration(interval)
+	if err != nil {
+		return nil, err
+	}
+	symbol = strings.ToLower(symbol)
+	if symbol == "" || strings.ContainsAny(symbol, `/\.`) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSymbol, symbol)
+	}
+
+	key := symbol + "/" + interval
+	if ser, ok := s.series[key]; ok {
+		return ser, nil
+	}
+	ser := &series{
+		dir:      filepath.Join(s.dir, symbol, interval),
+		interval: d,
+		parts:    make(map[string][]api.Kline),
+	}
+	data, err := os.ReadFile(filepath.Join(ser.dir, "empty.json"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read empty spans: %w", err)
+	default:
+		if err := json.Unmarshal(data, &ser.empty); err != nil {
+			return nil, fmt.Errorf("failed to decode empty spans: %w", err)
+		}
+	}
+	s.series[key] = ser
+	return ser, nil
+}
+
+// part returns the partition of month, reading it from disk once.
+func (ser *series) part(month string) ([]api.Kline, error) {
+	if klines, ok := ser.parts[month]; ok {
+		return klines, nil
+	}
+	f, err := os.Open(filepath.Join(ser.dir, month+".csv"))
+	if errors.Is(err, fs.ErrNotExist) {
+		ser.parts[month] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open partition %s: %w", month, err)
+	}
+	defer f.Close()
+	klines, err := readCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read partition %s: %w", month, err)
+	}
+	ser.parts[month] = klines
+	return klines, nil
+}
+
+// months returns the partitions overlapping [start, end).
+func months(start time.Time, end time.Time) []string {
+	var names []string
+	t := time.Date(start.UTC().Year(), start.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	for t.Before(end) {
+		names = append(names, t.Format(partitionLayout))
+		t = t.AddDate(0, 1, 0)
+	}
+	return names
+}
+
+// Range returns the stored klines opening in [start, end), oldest first.
+func (s *Store) Range(symbol string, interval string, start time.Time, end time.Time) ([]api.Kline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ser, err := s.seriesLocked(symbol, interval)
+	if err != nil {
+		return nil, err
+	}
+	return ser.rangeOf(start, end)
+}
+
+func (ser *series) rangeOf(start time.Time, end time.Time) ([]api.Kline, error) {
+	from, to := start.UnixMilli(), end.UnixMilli()
+	var klines []api.Kline
+	for _, month := range months(start, end) {
+		part, err := ser.part(month)
+		if err != nil {
+			return nil, err
+		}
+		i := sort.Search(len(part), func(i int) bool { return part[i].OpenTime >= from })
+		j := sort.Search(len(part), func(i int) bool { return part[i].OpenTime >= to })
+		klines = append(klines, part[i:j]...)
+	}
+	return klines, nil
+}
+
+// Put stores klines, replacing stored ones with the same open time. The
+// touched partitions are rewritten atomically.
+func (s *Store) Put(symbol string, interval string, klines []api.Kline) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ser, err := s.seriesLocked(symbol, interval)
+	if err != nil {
+		return err
+	}
+	return ser.put(klines)
+}
+
+func (ser *series) put(klines []api.Kline) error {
+	byMonth := make(map[string][]api.Kline)
+	for _, k := range klines {
+		month := time.UnixMilli(k.OpenTime).UTC().Format(partitionLayout)
+		byMonth[month] = append(byMonth[month], k)
+	}
+	if err := os.MkdirAll(ser.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", ser.dir, err)
+	}
+
+	for month, added := range byMonth {
+		part, err := ser.part(month)
+		if err != nil {
+			return err
+		}
+		merged := make(map[int64]api.Kline, len(part)+len(added))
+		for _, k := range part {
+			merged[k.OpenTime] = k
+		}
+		for _, k := range added {
+			merged[k.OpenTime] = k
+		}
+		next := make([]api.Kline, 0, len(merged))
+		for _, k := range merged {
+			next = append(next, k)
+		}
+		sort.Slice(next, func(i, j int) bool { return next[i].OpenTime < next[j].OpenTime })
+
+		if err := writeFile(filepath.Join(ser.dir, month+".csv"), func(w io.Writer) error {
+			return writeCSV(w, next)
+		}); err != nil {
+			return err
+		}
+		ser.parts[month] = next
+	}
+	return nil
+}
+
+// Gaps returns the spans of [start, end) without stored klines, leaving
+// out the spans the exchange is known to have no klines for.
+func (s *Store) Gaps(symbol string, interval string, start time.Time, end time.Time) ([]Gap, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ser, err := s.seriesLocked(symbol, interval)
+	if err != nil {
+		return nil, err
+	}
+	return ser.gaps(start, end)
+}
+
+func (ser *series) gaps(start time.Time, end time.Time) ([]Gap, error) {
+	start = alignUp(start, ser.interval)
+	klines, err := ser.rangeOf(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var gaps []Gap
+	next := start
+	for _, k := range klines {
+		if t := time.UnixMilli(k.OpenTime).UTC(); t.After(next) {
+			gaps = append(gaps, Gap{Start: next, End: t})
+		}
+		next = time.UnixMilli(k.OpenTime).UTC().Add(ser.interval)
+	}
+	if next.Before(end) {
+		gaps = append(gaps, Gap{Start: next, End: end})
+	}
+	return subtract(gaps, ser.empty), nil
+}
+
+// markEmpty records spans the exchange has no klines for.
+func (ser *series) markEmpty(spans []Gap) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	ser.empty = merge(append(ser.empty, spans...))
+	return ser.saveEmpty()
+}
+
+// ClearEmpty forgets the spans of [start, end) recorded as having no
+// klines, so the next Sync requests them again, e.g. after the exchange
+// backfilled an outage.
+func (s *Store) ClearEmpty(symbol string, interval string, start time.Time, end time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ser, err := s.seriesLocked(symbol, interval)
+	if err != nil {
+		return err
+	}
+	if len(ser.empty) == 0 {
+		return nil
+	}
+	ser.empty = subtract(ser.empty, []Gap{{Start: start.UTC(), End: end.UTC()}})
+	return ser.saveEmpty()
+}
+
+// saveEmpty writes the empty spans of the series.
+func (ser *series) saveEmpty() error {
+	data, err := json.MarshalIndent(ser.empty, "", "  ")
+	if err != nil {
+		return fmt.Errorf("err marshalling JSON: %w", err)
+	}
+	if err := os.MkdirAll(ser.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", ser.dir, err)
+	}
+	return writeFile(filepath.Join(ser.dir, "empty.json"), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// merge sorts spans and joins the overlapping or touching ones.
+func merge(spans []Gap) []Gap {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	var merged []Gap
+	for _, sp := range spans {
+		if n := len(merged); n > 0 && !sp.Start.After(merged[n-1].End) {
+			if sp.End.After(merged[n-1].End) {
+				merged[n-1].End = sp.End
+			}
+			continue
+		}
+		merged = append(merged, sp)
+	}
+	return merged
+}
+
+// subtract removes the sorted, disjoint spans cut from gaps.
+func subtract(gaps []Gap, cut []Gap) []Gap {
+	var out []Gap
+	for _, g := range gaps {
+		for _, c := range cut {
+			if !c.End.After(g.Start) || !c.Start.Before(g.End) {
+				continue
+			}
+			if c.Start.After(g.Start) {
+				out = append(out, Gap{Start: g.Start, End: c.Start})
+			}
+			g.Start = c.End
+			if !g.Start.Before(g.End) {
+				break
+			}
+		}
+		if g.Start.Before(g.End) {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// alignUp returns the first kline open time at or after t. Klines open on
+// multiples of their interval since the Unix epoch, weeks on Mondays.
+func alignUp(t time.Time, d time.Duration) time.Time {
+	a := alignDown(t, d)
+	if a.Before(t) {
+		a = a.Add(d)
+	}
+	return a
+}
+
+// alignDown returns the last kline open time at or before t.
+func alignDown(t time.Time, d time.Duration) time.Time {
+	t = t.UTC()
+	if d == 7*24*time.Hour {
+		// The epoch is a Thursday; weeks open on Mondays.
+		const monday = 4 * 24 * time.Hour
+		return t.Add(-monday).Truncate(d).Add(monday)
+	}
+	return t.Truncate(d)
+}
+
+// writeFile replaces path atomically with what write writes.
+func writeFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// csvHeader are the columns of stored and exported CSV files. The first
+// six columns are the ones backtest.FileSource reads.
+var csvHeader = []string{"open_time", "open", "high", "low", "close", "volume", "close_time", "quote_volume", "trades"}
+
+func writeCSV(w io.Writer, klines []api.Kline) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, k := range klines {
+		cw.Write([]string{
+			strconv.FormatInt(k.OpenTime, 10),
+			k.Open,
+			k.High,
+			k.Low,
+			k.Close,
+			k.Volume,
+			strconv.FormatInt(k.CloseTime, 10),
+			k.QuoteAssetVolume,
+			strconv.FormatInt(k.TradeNum, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV(r io.Reader) ([]api.Kline, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	klines := make([]api.Kline, 0, len(records))
+	for i, rec := range records {
+		if i == 0 && rec[0] == csvHeader[0] {
+			continue
+		}
+		openTime, err1 := strconv.ParseInt(rec[0], 10, 64)
+		closeTime, err2 := strconv.ParseInt(rec[6], 10, 64)
+		trades, err3 := strconv.ParseInt(rec[8], 10, 64)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return nil, fmt.Errorf("error: line %d: %w", i+1, err)
+		}
+		klines = append(klines, api.Kline{
+			OpenTime:         openTime,
+			Open:             rec[1],
+			High:             rec[2],
+			Low:              rec[3],
+			Close:            rec[4],
+			Volume:           rec[5],
+			CloseTime:        closeTime,
+			QuoteAssetVolume: rec[7],
+			TradeNum:         trades,
+		})
+	}
+	return klines, nil
+}
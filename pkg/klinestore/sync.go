@@ -0,0 +1,125 @@
+package klinestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+const (
+	// pageSize is the largest page of klines one request returns.
+	pageSize = 1000
+	// settleIntervals is how many intervals before now a span must end to
+	// be marked empty: the exchange may not serve the latest closed klines
+	// yet.
+	settleIntervals = 2
+)
+
+// SyncResult summarises a sync.
+type SyncResult struct {
+	// Gaps are the spans that were missing before the sync.
+	Gaps []Gap
+	// Empty are the spans the exchange had no klines for.
+	Empty    []Gap
+	Fetched  int
+	Requests int
+}
+
+// Sync downloads the klines of [start, end) missing from the store. Only
+// gaps and the tail after the last stored kline are requested, so syncing
+// the same range again is cheap. Klines still open are not stored; end is
+// clamped to the open time of the current kline. Spans found empty are
+// skipped by later syncs until ClearEmpty forgets them, except for the
+// last few intervals, which are requested again. The store is only
+// locked while reading and writing it, not during the downloads.
+func (s *Store) Sync(ctx context.Context, c *api.Client, symbol string, interval string, start time.Time, end time.Time) (*SyncResult, error) {
+	s.mu.Lock()
+	ser, err := s.seriesLocked(symbol, interval)
+	var gaps []Gap
+	if err == nil {
+		if now := alignDown(time.Now(), ser.interval); end.After(now) {
+			end = now
+		}
+		gaps, err = ser.gaps(start, end)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SyncResult{Gaps: gaps}
+	for _, g := range gaps {
+		if err := s.fill(ctx, c, ser, symbol, interval, g, res); err != nil {
+			return res, err
+		}
+		empty, err := s.markMissing(ser, g)
+		if err != nil {
+			return res, err
+		}
+		res.Empty = append(res.Empty, empty...)
+	}
+	return res, nil
+}
+
+// markMissing records the spans of g still without klines after it was
+// filled as empty, and returns them. Spans within settleIntervals of now
+// are left missing, so the next sync asks for them again.
+func (s *Store) markMissing(ser *series, g Gap) ([]Gap, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// What the exchange did not return in the gap does not exist, unless
+	// it is too recent to be served yet.
+	settled := alignDown(time.Now(), ser.interval).Add(-settleIntervals * ser.interval)
+	if g.End.After(settled) {
+		g.End = settled
+	}
+	if !g.Start.Before(g.End) {
+		return nil, nil
+	}
+	empty, err := ser.gaps(g.Start, g.End)
+	if err != nil {
+		return nil, err
+	}
+	return empty, ser.markEmpty(empty)
+}
+
+// fill pages through the klines of g and stores them, locking the store
+// only to write each page.
+func (s *Store) fill(ctx context.Context, c *api.Client, ser *series, symbol string, interval string, g Gap, res *SyncResult) error {
+	from := g.Start
+	for from.Before(g.End) {
+		klines, err := c.NewKlineService().
+			Symbol(symbol).
+			Interval(interval).
+			StartTime(from.UnixMilli()).
+			EndTime(g.End.UnixMilli() - 1).
+			Limit(pageSize).
+			Do(ctx)
+		res.Requests++
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s %s klines: %w", symbol, interval, err)
+		}
+
+		closed := klines[:0]
+		for _, k := range klines {
+			if k.OpenTime >= from.UnixMilli() && k.OpenTime < g.End.UnixMilli() {
+				closed = append(closed, k)
+			}
+		}
+		s.mu.Lock()
+		err = ser.put(closed)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		res.Fetched += len(closed)
+
+		if len(klines) < pageSize || len(closed) == 0 {
+			return nil
+		}
+		from = time.UnixMilli(closed[len(closed)-1].OpenTime).UTC().Add(ser.interval)
+	}
+	return nil
+}
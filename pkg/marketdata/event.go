@@ -0,0 +1,122 @@
+// Package marketdata records market data the exchange does not keep, such
+// as order book changes and tick-level trades, to rotating compressed
+// files, and replays it through the same interfaces as the live market.
+package marketdata
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// FileExt is the extension of recorded files: gzip-compressed JSON Lines.
+const FileExt = ".jsonl.gz"
+
+// maxLineSize bounds one recorded event, e.g. a deep order book snapshot.
+const maxLineSize = 16 * 1024 * 1024
+
+type EventType string
+
+const (
+	// EventDepthSnapshot carries the full order book.
+	EventDepthSnapshot EventType = "depth_snapshot"
+	// EventDepthDiff carries the levels changed since the previous depth
+	// event; an amount of "0" removes the level.
+	EventDepthDiff EventType = "depth_diff"
+	EventTrade     EventType = "trade"
+	EventTicker    EventType = "ticker"
+)
+
+// Ticker is the best bid and ask of a symbol with its last trade price.
+type Ticker struct {
+	Bid  api.OrderbookItem `json:"bid"`
+	Ask  api.OrderbookItem `json:"ask"`
+	Last string            `json:"last,omitempty"`
+}
+
+// Event is one recorded line. Exactly one of Depth, Trade and Ticker is set,
+// according to Type.
+type Event struct {
+	// Time is when the event was recorded. The exchange time of a trade is
+	// Trade.Timestamp.
+	Time   time.Time           `json:"time"`
+	Type   EventType           `json:"type"`
+	Symbol string              `json:"symbol"`
+	Depth  *api.OrderbookDepth `json:"depth,omitempty"`
+	Trade  *api.AggregateTrade `json:"trade,omitempty"`
+	Ticker *Ticker             `json:"ticker,omitempty"`
+}
+
+// Files returns the recorded files in dir, oldest first.
+func Files(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+FileExt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	// Names start with the time the file was opened.
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ReadFile calls fn for every event of a recorded file. A file cut short,
+// e.g. by a crash of the recorder, ends at its last complete event.
+func ReadFile(path string, fn func(Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			// The last line of a truncated file may be partial.
+			if isTruncated(scanner) {
+				return nil
+			}
+			return fmt.Errorf("failed to decode event in %s: %w", path, err)
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// isTruncated reports whether the scanner is at the end of a stream cut
+// short.
+func isTruncated(scanner *bufio.Scanner) bool {
+	return !scanner.Scan() && errors.Is(scanner.Err(), io.ErrUnexpectedEOF)
+}
+
+// fileName returns the name of a file opened at t.
+func fileName(t time.Time) string {
+	return t.UTC().Format("20060102T150405.000Z") + FileExt
+}
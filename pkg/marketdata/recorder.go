@@ -0,0 +1,337 @@
+package marketdata
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// Default Constants
+const (
+	DefaultInterval      = time.Second
+	DefaultSnapshotEvery = 60
+	DefaultDepthLimit    = 100
+	DefaultRotateEvery   = time.Hour
+	DefaultMaxFileSize   = 64 << 20
+)
+
+// tradePageSize is the largest page of trades one request returns.
+const tradePageSize = 1000
+
+var ErrInvalidRecorder = errors.New("error: invalid recorder config")
+
+type RecorderConfig struct {
+	// Dir receives the recorded files.
+	Dir     string
+	Symbols []string
+	// Interval is the polling interval of depth, trades and tickers.
+	Interval time.Duration
+	// SnapshotEvery records a full depth snapshot every so many polls and
+	// diffs in between.
+	SnapshotEvery int
+	// DepthLimit is the number of levels recorded on each side.
+	DepthLimit int
+	// RotateEvery and MaxFileSize start a new file once the current one is
+	// this old or has this many uncompressed bytes.
+	RotateEvery time.Duration
+	MaxFileSize int64
+}
+
+// RecorderStats counts what a recorder has written.
+type RecorderStats struct {
+	Events  int
+	Files   int
+	Errors  int
+	LastErr error
+}
+
+// symbolState is what the recorder remembers of a symbol between polls.
+type symbolState struct {
+	bids      map[string]string
+	asks      map[string]string
+	polls     int
+	lastTrade int64
+	lastPrice string
+	started   bool
+}
+
+// Recorder polls the market data of some symbols and appends it to
+// rotating gzip-compressed JSON Lines files. Files are only ever appended
+// to and are flushed after every poll, so a crash loses at most one poll.
+type Recorder struct {
+	c       *api.Client
+	cfg     RecorderConfig
+	symbols map[string]*symbolState
+
+	mu    sync.Mutex
+	file  *os.File
+	gz    *gzip.Writer
+	size  int64
+	since time.Time
+	stats RecorderStats
+}
+
+func NewRecorder(c *api.Client, cfg RecorderConfig) (*Recorder, error) {
+	if cfg.Dir == "" || len(cfg.Symbols) == 0 {
+		return nil, fmt.Errorf("%w: a directory and symbols are required", ErrInvalidRecorder)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.SnapshotEvery <= 0 {
+		cfg.SnapshotEvery = DefaultSnapshotEvery
+	}
+	if cfg.DepthLimit <= 0 {
+		cfg.DepthLimit = DefaultDepthLimit
+	}
+	if cfg.RotateEvery <= 0 {
+		cfg.RotateEvery = DefaultRotateEvery
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = DefaultMaxFileSize
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", cfg.Dir, err)
+	}
+
+	r := &Recorder{c: c, cfg: cfg, symbols: make(map[string]*symbolState)}
+	for _, symbol := range cfg.Symbols {
+		r.symbols[strings.ToLower(symbol)] = &symbolState{}
+	}
+	return r, nil
+}
+
+// Stats returns what the recorder has written so far.
+func (r *Recorder) Stats() RecorderStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// Run records until ctx is done, then closes the current file. Failed
+// polls are logged and retried on the next interval.
+func (r *Recorder) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		r.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return r.Close()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll records one round of depth, trades and tickers.
+func (r *Recorder) poll(ctx context.Context) {
+	tickers, err := r.c.NewOrderbookTickerService().Do(ctx)
+	if err != nil {
+		r.recordError(ctx, "tickers", err)
+	}
+
+	for _, symbol := range r.cfg.Symbols {
+		symbol = strings.ToLower(symbol)
+		s := r.symbols[symbol]
+		if err := r.pollDepth(ctx, symbol, s); err != nil {
+			r.recordError(ctx, symbol, err)
+		}
+		if err := r.pollTrades(ctx, symbol, s); err != nil {
+			r.recordError(ctx, symbol, err)
+		}
+		if t, ok := tickers[symbol]; ok {
+			r.write(Event{
+				Time:   time.Now(),
+				Type:   EventTicker,
+				Symbol: symbol,
+				Ticker: &Ticker{Bid: t.Bid, Ask: t.Ask, Last: s.lastPrice},
+			})
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gz != nil {
+		if err := r.gz.Flush(); err != nil {
+			r.recordErrorLocked(err)
+		}
+	}
+}
+
+func (r *Recorder) recordError(ctx context.Context, what string, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	r.c.Logger.Warn("Orbix market data poll failed", "symbol", what, "error", err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordErrorLocked(err)
+}
+
+func (r *Recorder) recordErrorLocked(err error) {
+	r.stats.Errors++
+	r.stats.LastErr = err
+}
+
+// pollDepth records a snapshot every SnapshotEvery polls and the diff
+// against the previous poll otherwise.
+func (r *Recorder) pollDepth(ctx context.Context, symbol string, s *symbolState) error {
+	depth, err := r.c.NewOrderbookDepthService(symbol).Limit(max(r.cfg.DepthLimit, 5)).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read depth: %w", err)
+	}
+	bids, asks := levelMap(depth.Bids), levelMap(depth.Asks)
+
+	ev := Event{Time: time.Now(), Symbol: symbol, Type: EventDepthSnapshot, Depth: depth}
+	if s.polls%r.cfg.SnapshotEvery != 0 {
+		ev.Type = EventDepthDiff
+		ev.Depth = &api.OrderbookDepth{
+			LastUpdateId: depth.LastUpdateId,
+			Bids:         diffLevels(s.bids, bids),
+			Asks:         diffLevels(s.asks, asks),
+		}
+	}
+	s.polls++
+	s.bids, s.asks = bids, asks
+	if ev.Type == EventDepthDiff && len(ev.Depth.Bids) == 0 && len(ev.Depth.Asks) == 0 {
+		return nil
+	}
+	r.write(ev)
+	return nil
+}
+
+func levelMap(levels [][2]string) map[string]string {
+	m := make(map[string]string, len(levels))
+	for _, l := range levels {
+		m[l[0]] = l[1]
+	}
+	return m
+}
+
+// diffLevels returns the levels of next that differ from prev, and the
+// levels of prev missing from next with an amount of "0".
+func diffLevels(prev map[string]string, next map[string]string) [][2]string {
+	diff := [][2]string{}
+	for price, amount := range next {
+		if prev[price] != amount {
+			diff = append(diff, [2]string{price, amount})
+		}
+	}
+	for price := range prev {
+		if _, ok := next[price]; !ok {
+			diff = append(diff, [2]string{price, "0"})
+		}
+	}
+	return diff
+}
+
+// pollTrades records the trades since the last poll. The first poll only
+// notes the latest trade, so trades from before the recorder started are
+// left out.
+func (r *Recorder) pollTrades(ctx context.Context, symbol string, s *symbolState) error {
+	for {
+		svc := r.c.NewAggregateTradeService().Symbol(symbol).Limit(tradePageSize)
+		if s.started {
+			svc.FromId(s.lastTrade + 1)
+		}
+		trades, err := svc.Do(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read trades: %w", err)
+		}
+
+		first := !s.started
+		s.started = true
+		for i := range trades {
+			t := trades[i]
+			if t.AggregateTradeID <= s.lastTrade {
+				continue
+			}
+			s.lastTrade, s.lastPrice = t.AggregateTradeID, t.Price
+			if first {
+				continue
+			}
+			// Stamped when recorded like every other event, so a file stays
+			// in time order; the exchange time is kept in the trade.
+			r.write(Event{Time: time.Now(), Type: EventTrade, Symbol: symbol, Trade: &t})
+		}
+		if first || len(trades) < tradePageSize {
+			return nil
+		}
+	}
+}
+
+// write appends ev to the current file, rotating it when due.
+func (r *Recorder) write(ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		r.mu.Lock()
+		r.recordErrorLocked(err)
+		r.mu.Unlock()
+		return
+	}
+	data = append(data, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.gz != nil && (now.Sub(r.since) >= r.cfg.RotateEvery || r.size+int64(len(data)) > r.cfg.MaxFileSize) {
+		if err := r.closeLocked(); err != nil {
+			r.recordErrorLocked(err)
+		}
+	}
+	if r.gz == nil {
+		if err := r.openLocked(now); err != nil {
+			r.recordErrorLocked(err)
+			return
+		}
+	}
+	if _, err := r.gz.Write(data); err != nil {
+		r.recordErrorLocked(fmt.Errorf("failed to write %s: %w", r.file.Name(), err))
+		return
+	}
+	r.size += int64(len(data))
+	r.stats.Events++
+}
+
+// openLocked starts a new file. The caller holds r.mu.
+func (r *Recorder) openLocked(now time.Time) error {
+	path := filepath.Join(r.cfg.Dir, fileName(now))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	r.file, r.gz, r.size, r.since = f, gzip.NewWriter(f), 0, now
+	r.stats.Files++
+	return nil
+}
+
+// closeLocked finishes the current file. The caller holds r.mu.
+func (r *Recorder) closeLocked() error {
+	if r.gz == nil {
+		return nil
+	}
+	gzErr := r.gz.Close()
+	fileErr := r.file.Close()
+	name := r.file.Name()
+	r.file, r.gz = nil, nil
+	if err := errors.Join(gzErr, fileErr); err != nil {
+		return fmt.Errorf("failed to close %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close finishes the current file. Run calls it when done.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeLocked()
+}
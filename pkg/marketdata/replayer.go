@@ -0,0 +1,413 @@
+package marketdata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/trading"
+)
+
+// Replay defaults
+const (
+	DefaultEventBuffer = 1024
+	// recentTrades is how many trades per symbol the replayer serves.
+	recentTrades = 1000
+)
+
+var ErrNoRecording = errors.New("error: no recorded files")
+
+type ReplayOptions struct {
+	// Speed scales the pace of the replay: 1 is real time, 60 replays an
+	// hour in a minute. Zero or less replays as fast as possible.
+	Speed float64
+	// Start and End, when set, bound the replayed events. Depth events
+	// before Start still build the order books.
+	Start time.Time
+	End   time.Time
+	// Symbols, when set, selects the replayed symbols.
+	Symbols []string
+}
+
+// book is the replayed order book of a symbol.
+type book struct {
+	lastUpdateId int64
+	bids         map[string]string
+	asks         map[string]string
+}
+
+// apply applies a depth event. Diffs are ignored until the first
+// snapshot, which they would otherwise be mistaken for.
+func (b *book) apply(ev Event) {
+	if ev.Type == EventDepthSnapshot {
+		b.bids, b.asks = make(map[string]string), make(map[string]string)
+	} else if b.bids == nil {
+		return
+	}
+	b.lastUpdateId = ev.Depth.LastUpdateId
+	applyLevels(b.bids, ev.Depth.Bids)
+	applyLevels(b.asks, ev.Depth.Asks)
+}
+
+// applyLevels updates side with levels; an amount of zero removes the
+// level. Levels with an unparseable price or amount are skipped.
+func applyLevels(side map[string]string, levels [][2]string) {
+	for _, l := range levels {
+		if _, err := api.ParseFloat(l[0]); err != nil {
+			continue
+		}
+		amount, err := api.ParseFloat(l[1])
+		switch {
+		case err != nil:
+		case amount == 0:
+			delete(side, l[0])
+		default:
+			side[l[0]] = l[1]
+		}
+	}
+}
+
+// levels returns the side sorted best first.
+func levels(side map[string]string, descending bool) []api.OrderbookItem {
+	items := make([]api.OrderbookItem, 0, len(side))
+	for price, amount := range side {
+		items = append(items, api.OrderbookItem{Price: price, Amount: amount})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		// applyLevels only keeps parseable prices.
+		pi, _ := api.ParseFloat(items[i].Price)
+		pj, _ := api.ParseFloat(items[j].Price)
+		if descending {
+			return pi > pj
+		}
+		return pi < pj
+	})
+	return items
+}
+
+// Replayer streams recorded files back. While it runs it keeps the order
+// books, tickers and recent trades as of the replay clock and serves them
+// like the live market: as a trading.PriceFeed of the recorded tickers, as
+// an http.RoundTripper answering the market data endpoints, e.g. for
+// api.ClientOptions.HttpClient or paper.Options.Market, and as a channel
+// of raw events.
+type Replayer struct {
+	paths   []string
+	opts    ReplayOptions
+	symbols map[string]bool
+	feed    *trading.StreamFeed
+	events  chan Event
+
+	mu      sync.Mutex
+	now     time.Time
+	books   map[string]*book
+	tickers map[string]Ticker
+	trades  map[string][]api.AggregateTrade
+}
+
+// NewReplayer replays the files recorded in dir.
+func NewReplayer(dir string, opts ReplayOptions) (*Replayer, error) {
+	paths, err := Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoRecording, dir)
+	}
+	r := &Replayer{
+		paths:   paths,
+		opts:    opts,
+		feed:    trading.NewStreamFeed(),
+		events:  make(chan Event, DefaultEventBuffer),
+		books:   make(map[string]*book),
+		tickers: make(map[string]Ticker),
+		trades:  make(map[string][]api.AggregateTrade),
+	}
+	if len(opts.Symbols) > 0 {
+		r.symbols = make(map[string]bool)
+		for _, s := range opts.Symbols {
+			r.symbols[strings.ToLower(s)] = true
+		}
+	}
+	return r, nil
+}
+
+// Events delivers the replayed events. Events are dropped when the
+// channel is full.
+func (r *Replayer) Events() <-chan Event {
+	return r.events
+}
+
+// Subscribe delivers the recorded tickers of pair as quotes.
+func (r *Replayer) Subscribe(ctx context.Context, pair string) (<-chan trading.Quote, error) {
+	return r.feed.Subscribe(ctx, pair)
+}
+
+// Now returns the replay clock: the time of the latest replayed event. It
+// never goes backwards.
+func (r *Replayer) Now() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.now
+}
+
+// Run replays every file and returns once the last event was replayed or
+// ctx is done. The events channel is closed when Run returns.
+func (r *Replayer) Run(ctx context.Context) error {
+	defer close(r.events)
+
+	var first time.Time
+	started := time.Now()
+	errStop := errors.New("stop")
+	for _, path := range r.paths {
+		err := ReadFile(path, func(ev Event) error {
+			if !r.selected(ev) {
+				return nil
+			}
+			if !r.opts.Start.IsZero() && ev.Time.Before(r.opts.Start) {
+				// Depth before Start is not replayed but still builds the
+				// book the first replayed diffs apply to.
+				r.mu.Lock()
+				r.applyDepthLocked(ev)
+				r.mu.Unlock()
+				return nil
+			}
+			if !r.opts.End.IsZero() && ev.Time.After(r.opts.End) {
+				return errStop
+			}
+			if first.IsZero() {
+				first = ev.Time
+			}
+			if r.opts.Speed > 0 {
+				at := started.Add(time.Duration(float64(ev.Time.Sub(first)) / r.opts.Speed))
+				if err := sleepUntil(ctx, at); err != nil {
+					return err
+				}
+			} else if err := ctx.Err(); err != nil {
+				return err
+			}
+			r.apply(ev)
+			return nil
+		})
+		if errors.Is(err, errStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) selected(ev Event) bool {
+	return r.symbols == nil || r.symbols[strings.ToLower(ev.Symbol)]
+}
+
+func sleepUntil(ctx context.Context, at time.Time) error {
+	d := time.Until(at)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// apply moves the replay state to ev and publishes it.
+func (r *Replayer) apply(ev Event) {
+	symbol := strings.ToLower(ev.Symbol)
+	r.mu.Lock()
+	if ev.Time.After(r.now) {
+		r.now = ev.Time
+	}
+	switch ev.Type {
+	case EventDepthSnapshot, EventDepthDiff:
+		r.applyDepthLocked(ev)
+	case EventTrade:
+		if ev.Trade != nil {
+			trades := append(r.trades[symbol], *ev.Trade)
+			if len(trades) > recentTrades {
+				trades = trades[len(trades)-recentTrades:]
+			}
+			r.trades[symbol] = trades
+		}
+	case EventTicker:
+		if ev.Ticker != nil {
+			r.tickers[symbol] = *ev.Ticker
+		}
+	}
+	r.mu.Unlock()
+
+	if ev.Type == EventTicker && ev.Ticker != nil {
+		// A ticker with an unparseable price is not published as a quote.
+		if q, err := tickerQuote(symbol, ev.Time, ev.Ticker); err == nil {
+			r.feed.Publish(q)
+		}
+	}
+	select {
+	case r.events <- ev:
+	default:
+	}
+}
+
+// applyDepthLocked applies a depth event to the book of its symbol. Other
+// events are ignored. The caller holds r.mu.
+func (r *Replayer) applyDepthLocked(ev Event) {
+	if (ev.Type != EventDepthSnapshot && ev.Type != EventDepthDiff) || ev.Depth == nil {
+		return
+	}
+	symbol := strings.ToLower(ev.Symbol)
+	b, ok := r.books[symbol]
+	if !ok {
+		b = &book{}
+		r.books[symbol] = b
+	}
+	b.apply(ev)
+}
+
+// Client returns an HTTP client answering market data requests from the
+// replay.
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip answers the depth, order book, order book ticker and aggregate
+// trade endpoints from the replay state. Other endpoints are not found.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	q := req.URL.Query()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case req.Method != http.MethodGet:
+	case req.URL.Path == "/api/v3/depth":
+		b := r.books[strings.ToLower(q.Get("symbol"))]
+		if b == nil {
+			b = &book{}
+		}
+		depth := api.OrderbookDepth{LastUpdateId: b.lastUpdateId, Bids: [][2]string{}, Asks: [][2]string{}}
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		for _, l := range truncate(levels(b.bids, true), limit) {
+			depth.Bids = append(depth.Bids, [2]string{l.Price, l.Amount})
+		}
+		for _, l := range truncate(levels(b.asks, false), limit) {
+			depth.Asks = append(depth.Asks, [2]string{l.Price, l.Amount})
+		}
+		return jsonResponse(req, depth)
+	case req.URL.Path == "/api/orders/":
+		b := r.books[strings.ToLower(q.Get("pair"))]
+		if b == nil {
+			b = &book{}
+		}
+		switch api.SideType(q.Get("side")) {
+		case api.SideTypeBuy:
+			return jsonResponse(req, levels(b.bids, true))
+		case api.SideTypeSell:
+			return jsonResponse(req, levels(b.asks, false))
+		}
+		return jsonResponse(req, api.Orderbook{Bids: levels(b.bids, true), Asks: levels(b.asks, false)})
+	case req.URL.Path == "/api/orderbook-tickers/":
+		tickers := make(map[string]api.OrderbookTicker, len(r.tickers))
+		for symbol, t := range r.tickers {
+			tickers[symbol] = api.OrderbookTicker{Bid: t.Bid, Ask: t.Ask}
+		}
+		return jsonResponse(req, tickers)
+	case req.URL.Path == "/api/v3/aggTrades":
+		return jsonResponse(req, r.aggTrades(q.Get("symbol"), q))
+	}
+
+	data := []byte(`{"message":"error: not recorded"}`)
+	return response(req, http.StatusNotFound, data), nil
+}
+
+// aggTrades applies the fromId, startTime, endTime and limit parameters to
+// the recent trades of symbol. The caller holds r.mu.
+func (r *Replayer) aggTrades(symbol string, q url.Values) []api.AggregateTrade {
+	get := func(key string) (int64, bool) {
+		n, err := strconv.ParseInt(q.Get(key), 10, 64)
+		return n, err == nil
+	}
+	trades := []api.AggregateTrade{}
+	for _, t := range r.trades[strings.ToLower(symbol)] {
+		if fromId, ok := get("fromId"); ok && t.AggregateTradeID < fromId {
+			continue
+		}
+		if start, ok := get("startTime"); ok && t.Timestamp < start {
+			continue
+		}
+		if end, ok := get("endTime"); ok && t.Timestamp > end {
+			continue
+		}
+		trades = append(trades, t)
+	}
+	if limit, ok := get("limit"); ok && limit > 0 && int(limit) < len(trades) {
+		if _, ok := get("fromId"); ok {
+			return trades[:limit]
+		}
+		// Without fromId the most recent trades are returned.
+		return trades[len(trades)-int(limit):]
+	}
+	return trades
+}
+
+func jsonResponse(req *http.Request, v any) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("err marshalling JSON: %w", err)
+	}
+	return response(req, http.StatusOK, data), nil
+}
+
+func response(req *http.Request, status int, data []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+}
+
+func truncate[T any](items []T, n int) []T {
+	if n > 0 && n < len(items) {
+		return items[:n]
+	}
+	return items
+}
+
+// tickerQuote returns the quote of a recorded ticker.
+func tickerQuote(symbol string, at time.Time, t *Ticker) (trading.Quote, error) {
+	bid, err := api.ParseFloat(t.Bid.Price)
+	if err != nil {
+		return trading.Quote{}, err
+	}
+	ask, err := api.ParseFloat(t.Ask.Price)
+	if err != nil {
+		return trading.Quote{}, err
+	}
+	last, err := api.ParseFloat(t.Last)
+	if err != nil {
+		return trading.Quote{}, err
+	}
+	return trading.Quote{Pair: symbol, Bid: bid, Ask: ask, Last: last, Time: at}, nil
+}
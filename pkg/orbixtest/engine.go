@@ -0,0 +1,559 @@
+package orbixtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+type order struct {
+	id        int
+	account   *account
+	pair      string
+	side      api.SideType
+	typ       api.OrderType
+	price     float64
+	amount    float64
+	remaining float64
+	// filledValue is the quote value of the fills, fees excluded.
+	filledValue float64
+	// locked is what the order still holds: quote for buys, base for sells.
+	locked    float64
+	status    string
+	createdAt time.Time
+}
+
+func (o *order) api() api.Order {
+	var avg float64
+	if filled := o.amount - o.remaining; filled > epsilon {
+		avg = o.filledValue / filled
+	}
+	return api.Order{
+		ID:              o.id,
+		Type:            o.typ,
+		Price:           api.FormatFloat(o.price),
+		Amount:          api.FormatFloat(o.amount),
+		RemainingAmount: api.FormatFloat(o.remaining),
+		AveragePrice:    api.FormatFloat(avg),
+		Side:            o.side,
+		Cost:            api.FormatFloat(o.filledValue),
+		CreatedAt:       o.createdAt.UTC().Format(time.RFC3339),
+		Status:          o.status,
+	}
+}
+
+// crosses reports whether the order trades at price p.
+func (o *order) crosses(p float64) bool {
+	if o.typ == api.OrderTypeMarket {
+		return true
+	}
+	if o.side == api.SideTypeBuy {
+		return p <= o.price
+	}
+	return p >= o.price
+}
+
+// trade is a trade of the public history.
+type trade struct {
+	id        int64
+	price     float64
+	amount    float64
+	takerSide api.SideType
+	time      time.Time
+}
+
+// market is the book and trade history of one pair. Each side of the book
+// is kept in priority order: best price first, then oldest first.
+type market struct {
+	pair   string
+	rules  api.TradingRules
+	bids   []*order
+	asks   []*order
+	trades []trade
+	// seq counts book changes, reported as the depth's lastUpdateId.
+	seq int64
+}
+
+func (m *market) insert(o *order) {
+	side := &m.asks
+	better := func(p float64) bool { return p > o.price }
+	if o.side == api.SideTypeBuy {
+		side = &m.bids
+		better = func(p float64) bool { return p < o.price }
+	}
+	i := sort.Search(len(*side), func(i int) bool { return better((*side)[i].price) })
+	*side = append(*side, nil)
+	copy((*side)[i+1:], (*side)[i:])
+	(*side)[i] = o
+	m.seq++
+}
+
+func (m *market) remove(o *order) {
+	side := &m.asks
+	if o.side == api.SideTypeBuy {
+		side = &m.bids
+	}
+	for i, resting := range *side {
+		if resting == o {
+			*side = append((*side)[:i], (*side)[i+1:]...)
+			m.seq++
+			return
+		}
+	}
+}
+
+func (m *market) recordTrade(takerSide api.SideType, price float64, amount float64, at time.Time) {
+	t := trade{
+		id:        int64(len(m.trades) + 1),
+		price:     price,
+		amount:    amount,
+		takerSide: takerSide,
+		time:      at,
+	}
+	// Seeded trades may arrive out of order.
+	i := sort.Search(len(m.trades), func(i int) bool { return m.trades[i].time.After(at) })
+	m.trades = append(m.trades, trade{})
+	copy(m.trades[i+1:], m.trades[i:])
+	m.trades[i] = t
+	for j := i; j < len(m.trades); j++ {
+		m.trades[j].id = int64(j + 1)
+	}
+}
+
+// levels aggregates orders into price levels.
+func levels(orders []*order) []api.OrderbookItem {
+	items := []api.OrderbookItem{}
+	for i := 0; i < len(orders); {
+		price := orders[i].price
+		var amount float64
+		for ; i < len(orders) && orders[i].price == price; i++ {
+			amount += orders[i].remaining
+		}
+		items = append(items, api.OrderbookItem{Price: api.FormatFloat(price), Amount: api.FormatFloat(amount)})
+	}
+	return items
+}
+
+// placeLocked validates, funds and matches a new order. The caller holds
+// e.mu.
+func (e *Exchange) placeLocked(a *account, pair string, side api.SideType, typ api.OrderType, price float64, amount float64) (*order, error) {
+	m, ok := e.markets[strings.ToLower(pair)]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+	case side != api.SideTypeBuy && side != api.SideTypeSell:
+		return nil, fmt.Errorf("%w: invalid side %q", ErrInvalidOrder, side)
+	case typ != api.OrderTypeLimit && typ != api.OrderTypeMarket:
+		return nil, fmt.Errorf("%w: invalid type %q", ErrInvalidOrder, typ)
+	case amount <= 0 || (typ == api.OrderTypeLimit && price <= 0):
+		return nil, fmt.Errorf("%w: invalid price or amount", ErrInvalidOrder)
+	}
+	if typ == api.OrderTypeMarket {
+		price = 0
+	}
+	if err := checkRules(m.rules, price, amount); err != nil {
+		return nil, err
+	}
+
+	o := &order{
+		account:   a,
+		pair:      m.pair,
+		side:      side,
+		typ:       typ,
+		price:     price,
+		amount:    amount,
+		remaining: amount,
+		status:    string(api.OrderStatusOpen),
+		createdAt: e.now(),
+	}
+	if err := e.lock(o, m); err != nil {
+		return nil, err
+	}
+	o.id = e.nextOrderId
+	e.nextOrderId++
+	e.orders[o.id] = o
+
+	book := &m.asks
+	if side == api.SideTypeSell {
+		book = &m.bids
+	}
+	for o.remaining > epsilon && len(*book) > 0 && o.crosses((*book)[0].price) {
+		maker := (*book)[0]
+		take := math.Min(o.remaining, maker.remaining)
+		e.fillLocked(o, maker.price, take)
+		e.fillLocked(maker, maker.price, take)
+		m.recordTrade(side, maker.price, take, o.createdAt)
+		if maker.remaining <= epsilon {
+			*book = (*book)[1:]
+			m.seq++
+		}
+	}
+
+	switch {
+	case o.status != string(api.OrderStatusOpen):
+	case typ == api.OrderTypeMarket:
+		// Market orders never rest; what the book could not fill expires.
+		e.closeLocked(o, string(api.OrderStatusClose))
+	default:
+		m.insert(o)
+	}
+	return o, nil
+}
+
+// checkRules checks price and amount against the trading rules of the pair.
+// Market orders have no price and skip the price rules.
+func checkRules(rules api.TradingRules, price float64, amount float64) error {
+	var tick, minPrice, maxPrice, minNotional, step, minQty, maxQty float64
+	for _, r := range []struct {
+		name  string
+		value string
+		to    *float64
+	}{
+		{"tick size", rules.TickSize, &tick},
+		{"minimum price", rules.MinPrice, &minPrice},
+		{"maximum price", rules.MaxPrice, &maxPrice},
+		{"minimum notional", rules.MinNotional, &minNotional},
+		{"step size", rules.StepSize, &step},
+		{"minimum quantity", rules.MinQty, &minQty},
+		{"maximum quantity", rules.MaxQty, &maxQty},
+	} {
+		v, err := api.ParseFloat(r.value)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidRules, r.name, err)
+		}
+		*r.to = v
+	}
+
+	if price > 0 {
+		if !onStep(price, tick) {
+			return fmt.Errorf("%w: price %s is not a multiple of the tick size %s", ErrInvalidOrder, api.FormatFloat(price), rules.TickSize)
+		}
+		if price < minPrice {
+			return fmt.Errorf("%w: price %s below the minimum %s", ErrInvalidOrder, api.FormatFloat(price), rules.MinPrice)
+		}
+		if maxPrice > 0 && price > maxPrice {
+			return fmt.Errorf("%w: price %s above the maximum %s", ErrInvalidOrder, api.FormatFloat(price), rules.MaxPrice)
+		}
+		if price*amount+epsilon < minNotional {
+			return fmt.Errorf("%w: notional %s below the minimum %s", ErrInvalidOrder, api.FormatFloat(price*amount), rules.MinNotional)
+		}
+	}
+	if !onStep(amount, step) {
+		return fmt.Errorf("%w: amount %s is not a multiple of the step size %s", ErrInvalidOrder, api.FormatFloat(amount), rules.StepSize)
+	}
+	if amount < minQty {
+		return fmt.Errorf("%w: amount %s below the minimum %s", ErrInvalidOrder, api.FormatFloat(amount), rules.MinQty)
+	}
+	if maxQty > 0 && amount > maxQty {
+		return fmt.Errorf("%w: amount %s above the maximum %s", ErrInvalidOrder, api.FormatFloat(amount), rules.MaxQty)
+	}
+	return nil
+}
+
+// onStep reports whether v is a multiple of step. A zero step allows any v.
+func onStep(v float64, step float64) bool {
+	if step <= 0 {
+		return true
+	}
+	n := v / step
+	return math.Abs(n-math.Round(n)) < 1e-9
+}
+
+// lock moves the funds an order needs from available to locked: the base
+// amount for sells, the quote value plus fees for buys. Market buys lock
+// the cost of walking the book.
+func (e *Exchange) lock(o *order, m *market) error {
+	base, quote, _ := strings.Cut(o.pair, "_")
+	asset, need := base, o.amount
+	if o.side == api.SideTypeBuy {
+		asset = quote
+		if o.typ == api.OrderTypeLimit {
+			need = o.price * o.amount * (1 + e.feeRate)
+		} else {
+			need = walkCost(m.asks, o.amount) * (1 + e.feeRate)
+		}
+	}
+
+	b := o.account.balance(asset)
+	if b.Available+epsilon < need {
+		return fmt.Errorf("%w: %s %s needed, %s available", ErrInsufficientBalance, api.FormatFloat(need), asset, api.FormatFloat(b.Available))
+	}
+	b.Available -= need
+	b.Locked += need
+	o.locked = need
+	return nil
+}
+
+// walkCost returns the quote cost of taking amount from orders.
+func walkCost(orders []*order, amount float64) float64 {
+	var cost float64
+	for _, o := range orders {
+		if amount <= epsilon {
+			break
+		}
+		take := math.Min(o.remaining, amount)
+		cost += take * o.price
+		amount -= take
+	}
+	return cost
+}
+
+// fillLocked executes amount of o at price. The caller holds e.mu.
+func (e *Exchange) fillLocked(o *order, price float64, amount float64) {
+	a := o.account
+	base, quote, _ := strings.Cut(o.pair, "_")
+	value := price * amount
+	fee := value * e.feeRate
+
+	if o.side == api.SideTypeBuy {
+		spent := math.Min(value+fee, o.locked)
+		a.balance(quote).Locked -= spent
+		o.locked -= spent
+		a.balance(base).Available += amount
+	} else {
+		a.balance(base).Locked -= amount
+		o.locked -= amount
+		a.balance(quote).Available += value - fee
+	}
+	o.remaining -= amount
+	o.filledValue += value
+
+	a.trades = append(a.trades, api.Trade{
+		ID:          e.nextTradeId,
+		OrderID:     o.id,
+		Pair:        o.pair,
+		Side:        o.side,
+		Price:       api.FormatFloat(price),
+		Amount:      api.FormatFloat(amount),
+		Fee:         api.FormatFloat(fee),
+		FeeCurrency: quote,
+		CreatedAt:   e.now().UTC().Format(time.RFC3339),
+	})
+	e.nextTradeId++
+
+	if o.remaining <= epsilon {
+		o.remaining = 0
+		e.closeLocked(o, string(api.OrderStatusClose))
+	}
+}
+
+// closeLocked ends an order and releases what it still locks. The caller
+// holds e.mu.
+func (e *Exchange) closeLocked(o *order, status string) {
+	base, quote, _ := strings.Cut(o.pair, "_")
+	asset := base
+	if o.side == api.SideTypeBuy {
+		asset = quote
+	}
+	b := o.account.balance(asset)
+	b.Locked -= o.locked
+	b.Available += o.locked
+	o.locked = 0
+	o.status = status
+}
+
+// cancelLocked cancels an open order. The caller holds e.mu.
+func (e *Exchange) cancelLocked(o *order) {
+	e.markets[o.pair].remove(o)
+	e.closeLocked(o, orderStatusCancel)
+}
+
+func (e *Exchange) serveUser(w http.ResponseWriter, a *account) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	wallets := make(map[api.CoinSymbol]api.Wallet, len(a.balances))
+	for asset, b := range a.balances {
+		wallets[api.CoinSymbol(asset)] = api.Wallet{
+			Addresses:        []api.Address{},
+			AvailableBalance: api.FormatFloat(b.Available),
+		}
+	}
+	writeJSON(w, http.StatusOK, api.User{
+		IdentityVerificationLevel: "level_2",
+		TFAEnabled:                []string{},
+		APIKeys:                   []api.APIKey{{APIKey: a.key, Status: 1, Permissions: []string{"trade"}}},
+		IsAuthorizedDevice:        true,
+		Wallets:                   wallets,
+	})
+}
+
+func (e *Exchange) serveCreateOrder(w http.ResponseWriter, a *account, body []byte) {
+	var req api.CreateOrderRequestBody
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrInvalidOrder, err))
+		return
+	}
+
+	price, err := api.ParseFloat(req.Price)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrInvalidOrder, err))
+		return
+	}
+	amount, err := api.ParseFloat(req.Amount)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrInvalidOrder, err))
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, err := e.placeLocked(a, req.Pair, req.Side, req.Type, price, amount)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, o.api())
+}
+
+func (e *Exchange) serveGetOrder(w http.ResponseWriter, a *account, id int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.orders[id]
+	if !ok || (a != nil && o.account != a) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %d", ErrUnknownOrder, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, o.api())
+}
+
+func (e *Exchange) serveCancel(w http.ResponseWriter, a *account, id int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.orders[id]
+	if !ok || o.account != a {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %d", ErrUnknownOrder, id))
+		return
+	}
+	if o.status != string(api.OrderStatusOpen) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: order %d is not open", ErrInvalidOrder, id))
+		return
+	}
+	e.cancelLocked(o)
+	writeJSON(w, http.StatusOK, o.api())
+}
+
+func (e *Exchange) serveCancelAll(w http.ResponseWriter, a *account, body []byte) {
+	var req api.CancelOrderRequestBody
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrInvalidOrder, err))
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	res := []api.CancelAllOrdersResponse{}
+	for _, o := range e.ordersLocked(a, req.Pair) {
+		if o.status != string(api.OrderStatusOpen) {
+			continue
+		}
+		e.cancelLocked(o)
+		res = append(res, api.CancelAllOrdersResponse{Code: "0", Message: "order " + strconv.Itoa(o.id) + " cancelled"})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (e *Exchange) serveListOrders(w http.ResponseWriter, r *http.Request, a *account) {
+	q := r.URL.Query()
+	e.mu.Lock()
+	var orders []api.Order
+	for _, o := range e.ordersLocked(a, q.Get("pair")) {
+		if (q.Get("side") == "" || string(o.side) == q.Get("side")) &&
+			(q.Get("status") == "" || o.status == q.Get("status")) {
+			orders = append(orders, o.api())
+		}
+	}
+	e.mu.Unlock()
+
+	// Newest first, like the exchange.
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID > orders[j].ID })
+	writeJSON(w, http.StatusOK, page(orders, q))
+}
+
+func (e *Exchange) serveTradeHistory(w http.ResponseWriter, r *http.Request, a *account) {
+	q := r.URL.Query()
+	e.mu.Lock()
+	var trades []api.Trade
+	for i := len(a.trades) - 1; i >= 0; i-- {
+		if t := a.trades[i]; q.Get("pair") == "" || strings.EqualFold(t.Pair, q.Get("pair")) {
+			trades = append(trades, t)
+		}
+	}
+	e.mu.Unlock()
+	writeJSON(w, http.StatusOK, page(trades, q))
+}
+
+// transferPaths are the deposit and withdrawal history endpoints.
+var transferPaths = map[string]bool{
+	"/api/bank-account-deposits": true,
+	"/api/fiat-withdrawals":      true,
+	"/api/crypto-deposits":       true,
+	"/api/crypto-withdrawals":    true,
+}
+
+// transferPath returns the endpoint listing the deposits or withdrawals
+// of asset: fiat for THB, crypto otherwise.
+func transferPath(asset string, withdrawal bool) string {
+	fiat := strings.EqualFold(asset, "thb")
+	switch {
+	case fiat && withdrawal:
+		return "/api/fiat-withdrawals"
+	case fiat:
+		return "/api/bank-account-deposits"
+	case withdrawal:
+		return "/api/crypto-withdrawals"
+	}
+	return "/api/crypto-deposits"
+}
+
+// serveTransfers lists the fiat (THB) or crypto transfers of the account
+// for path, newest first.
+func (e *Exchange) serveTransfers(w http.ResponseWriter, r *http.Request, a *account, path string) {
+	fiat := !strings.Contains(path, "crypto")
+	e.mu.Lock()
+	history := a.deposits
+	if strings.Contains(path, "withdrawals") {
+		history = a.withdrawals
+	}
+	var transfers []api.Transfer
+	for i := len(history) - 1; i >= 0; i-- {
+		if t := history[i]; (t.Currency == "thb") == fiat {
+			transfers = append(transfers, t)
+		}
+	}
+	e.mu.Unlock()
+	writeJSON(w, http.StatusOK, page(transfers, r.URL.Query()))
+}
+
+// ordersLocked returns the orders of the account in pair, or in every pair
+// if pair is empty, oldest first. The caller holds e.mu.
+func (e *Exchange) ordersLocked(a *account, pair string) []*order {
+	var orders []*order
+	for _, o := range e.orders {
+		if o.account == a && (pair == "" || strings.EqualFold(o.pair, pair)) {
+			orders = append(orders, o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].id < orders[j].id })
+	return orders
+}
+
+// page applies the limit and offset query parameters.
+func page[T any](items []T, q url.Values) []T {
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	items = items[min(max(offset, 0), len(items)):]
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil && limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	if items == nil {
+		items = []T{}
+	}
+	return items
+}
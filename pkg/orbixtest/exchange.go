@@ -0,0 +1,454 @@
+// Package orbixtest provides a fake Orbix exchange for integration tests.
+// An Exchange is an http.Handler serving every endpoint the api client
+// knows: serve it with httptest.NewServer and point a client at the URL.
+// It verifies TDAX-API auth and signatures, keeps per-account balances,
+// matches orders by price-time priority and can inject errors, latency and
+// rate-limit responses.
+package orbixtest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// DefaultFeeRate is the fee charged on every fill, in the quote asset.
+const DefaultFeeRate = 0.0025
+
+// Order statuses besides api.OrderStatusOpen and api.OrderStatusClose.
+const orderStatusCancel = "cancel"
+
+// epsilon absorbs float rounding when comparing amounts.
+const epsilon = 1e-12
+
+var (
+	ErrUnauthorized        = errors.New("error: unauthorized")
+	ErrInvalidNonce        = errors.New("error: invalid nonce")
+	ErrUnknownPair         = errors.New("error: unknown pair")
+	ErrUnknownOrder        = errors.New("error: unknown order")
+	ErrInvalidOrder        = errors.New("error: invalid order")
+	ErrInsufficientBalance = errors.New("error: insufficient balance")
+	// ErrInvalidRules means the trading rules a pair was added with do not
+	// parse.
+	ErrInvalidRules = errors.New("error: invalid trading rules")
+)
+
+type Options struct {
+	// FeeRate is charged on the value of every fill. Defaults to
+	// DefaultFeeRate; a negative rate means no fees.
+	FeeRate float64
+	// Latency delays every response.
+	Latency time.Duration
+	// Now is the clock of the exchange. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Balance is the balance of one asset.
+type Balance struct {
+	Available float64
+	Locked    float64
+}
+
+type account struct {
+	key      string
+	secret   string
+	balances map[string]*Balance
+	trades   []api.Trade
+	// deposits and withdrawals are the transfer history, oldest first.
+	deposits    []api.Transfer
+	withdrawals []api.Transfer
+	lastNonce   float64
+}
+
+// balance returns the balance of asset, creating it.
+func (a *account) balance(asset string) *Balance {
+	asset = strings.ToLower(asset)
+	b, ok := a.balances[asset]
+	if !ok {
+		b = &Balance{}
+		a.balances[asset] = b
+	}
+	return b
+}
+
+// Exchange is a fake exchange. Pairs and accounts are set up with AddPair
+// and AddAccount before use.
+type Exchange struct {
+	feeRate float64
+	latency time.Duration
+	now     func() time.Time
+
+	mu          sync.Mutex
+	markets     map[string]*market
+	accounts    map[string]*account
+	orders      map[int]*order
+	faults      []*Fault
+	calls       map[string]int
+	nextOrderId int
+	nextTradeId int
+	// lastTransferId numbers every transfer history on its own, like the
+	// exchange does, keyed by the endpoint listing it.
+	lastTransferId map[string]int
+}
+
+func New(opts Options) *Exchange {
+	if opts.FeeRate == 0 {
+		opts.FeeRate = DefaultFeeRate
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Exchange{
+		feeRate:        math.Max(opts.FeeRate, 0),
+		latency:        opts.Latency,
+		now:            opts.Now,
+		markets:        make(map[string]*market),
+		accounts:       make(map[string]*account),
+		orders:         make(map[int]*order),
+		calls:          make(map[string]int),
+		nextOrderId:    1,
+		nextTradeId:    1,
+		lastTransferId: make(map[string]int),
+	}
+}
+
+// AddPair lists pair, e.g. "btc_thb", under the given trading rules. The
+// pair doubles as the symbol of the market data endpoints.
+func (e *Exchange) AddPair(pair string, rules api.TradingRules) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	pair = strings.ToLower(pair)
+	e.markets[pair] = &market{pair: pair, rules: rules}
+}
+
+// AddAccount opens an account for the API key and secret.
+func (e *Exchange) AddAccount(key string, secret string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.accounts[key] = &account{key: key, secret: secret, balances: make(map[string]*Balance)}
+}
+
+// Deposit adds amount of asset to the available balance of the account
+// and to its fiat or crypto deposit history.
+func (e *Exchange) Deposit(key string, asset string, amount float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, ok := e.accounts[key]
+	if !ok {
+		return fmt.Errorf("%w: unknown API key %q", ErrUnauthorized, key)
+	}
+	a.balance(asset).Available += amount
+	a.deposits = append(a.deposits, e.transferLocked(transferPath(asset, false), asset, amount, 0))
+	return nil
+}
+
+// Withdraw takes amount plus fee of asset from the available balance of
+// the account and adds it to its withdrawal history.
+func (e *Exchange) Withdraw(key string, asset string, amount float64, fee float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, ok := e.accounts[key]
+	if !ok {
+		return fmt.Errorf("%w: unknown API key %q", ErrUnauthorized, key)
+	}
+	b := a.balance(asset)
+	if b.Available+epsilon < amount+fee {
+		return fmt.Errorf("%w: %s", ErrInsufficientBalance, asset)
+	}
+	b.Available -= amount + fee
+	a.withdrawals = append(a.withdrawals, e.transferLocked(transferPath(asset, true), asset, amount, fee))
+	return nil
+}
+
+// transferLocked returns a completed transfer, numbered in the history
+// listed at path. The caller holds e.mu.
+func (e *Exchange) transferLocked(path string, asset string, amount float64, fee float64) api.Transfer {
+	e.lastTransferId[path]++
+	return api.Transfer{
+		ID:        e.lastTransferId[path],
+		Currency:  strings.ToLower(asset),
+		Amount:    api.FormatFloat(amount),
+		Fee:       api.FormatFloat(fee),
+		Status:    "completed",
+		CreatedAt: e.now().UTC().Format(time.RFC3339),
+	}
+}
+
+// Balances returns the balances of the account by asset.
+func (e *Exchange) Balances(key string) map[string]Balance {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, ok := e.accounts[key]
+	if !ok {
+		return nil
+	}
+	balances := make(map[string]Balance, len(a.balances))
+	for asset, b := range a.balances {
+		balances[asset] = *b
+	}
+	return balances
+}
+
+// PlaceOrder places an order for the account without going through HTTP,
+// e.g. to seed the book with liquidity. Market orders have no price.
+func (e *Exchange) PlaceOrder(key string, pair string, side api.SideType, typ api.OrderType, price float64, amount float64) (*api.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, ok := e.accounts[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key %q", ErrUnauthorized, key)
+	}
+	o, err := e.placeLocked(a, pair, side, typ, price, amount)
+	if err != nil {
+		return nil, err
+	}
+	res := o.api()
+	return &res, nil
+}
+
+// SeedTrade adds a trade to the public trade history of pair, e.g. to serve
+// klines and tickers, without touching any account.
+func (e *Exchange) SeedTrade(pair string, takerSide api.SideType, price float64, amount float64, at time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.markets[strings.ToLower(pair)]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+	}
+	m.recordTrade(takerSide, price, amount, at)
+	return nil
+}
+
+// Calls returns how often "METHOD /path" was requested, faulted requests
+// included.
+func (e *Exchange) Calls(method string, path string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls[method+" "+path]
+}
+
+// NewClient returns a client for the account, sending requests to baseURL,
+// the URL the exchange is served at.
+func (e *Exchange) NewClient(baseURL string, key string) *api.Client {
+	e.mu.Lock()
+	var secret string
+	if a, ok := e.accounts[key]; ok {
+		secret = a.secret
+	}
+	e.mu.Unlock()
+	return api.NewClient(api.ClientOptions{
+		ClientAuth: api.NewClientAuth(key, secret),
+		BaseURL:    baseURL,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Nonce:      api.NewNonceManager(""),
+	})
+}
+
+func (e *Exchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	e.calls[r.Method+" "+r.URL.Path]++
+	fault := e.faultLocked(r)
+	e.mu.Unlock()
+
+	delay := e.latency
+	if fault != nil {
+		delay += fault.Latency
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+	if fault != nil && fault.serve(w) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	e.route(w, r, body)
+}
+
+func (e *Exchange) route(w http.ResponseWriter, r *http.Request, body []byte) {
+	path := r.URL.Path
+	if r.Method == http.MethodGet {
+		switch path {
+		case "/api/v3/ping":
+			writeJSON(w, http.StatusOK, struct{}{})
+			return
+		case "/api/v3/exchangeInfo":
+			e.serveExchangeInfo(w)
+			return
+		case "/api/v3/depth":
+			e.serveDepth(w, r)
+			return
+		case "/api/v3/klines":
+			e.serveKlines(w, r)
+			return
+		case "/api/v3/ticker/24hr":
+			e.serveTicker24hr(w, r)
+			return
+		case "/api/v3/aggTrades":
+			e.serveAggTrades(w, r)
+			return
+		case "/api/orders/":
+			e.serveOrderbook(w, r)
+			return
+		case "/api/orderbook-tickers/":
+			e.serveOrderbookTickers(w)
+			return
+		}
+	}
+
+	id, isOrder := orderIdFromPath(path)
+	if isOrder && r.Method == http.MethodGet {
+		// The client reads single orders without signing them, so the
+		// order is only checked against the account when signed.
+		var a *account
+		if r.Header.Get("Authorization") != "" {
+			var err error
+			if a, err = e.authenticate(r, body); err != nil {
+				writeError(w, http.StatusUnauthorized, err)
+				return
+			}
+		}
+		e.serveGetOrder(w, a, id)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && path == "/api/users/me",
+		r.Method == http.MethodGet && path == "/api/orders/user",
+		r.Method == http.MethodGet && path == "/api/trade-history",
+		r.Method == http.MethodGet && transferPaths[path],
+		r.Method == http.MethodPost && path == "/api/orders/",
+		r.Method == http.MethodDelete && path == "/api/orders/all",
+		r.Method == http.MethodDelete && isOrder:
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("error: no route for %s %s", r.Method, path))
+		return
+	}
+
+	a, err := e.authenticate(r, body)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	switch {
+	case path == "/api/users/me":
+		e.serveUser(w, a)
+	case path == "/api/orders/user":
+		e.serveListOrders(w, r, a)
+	case path == "/api/trade-history":
+		e.serveTradeHistory(w, r, a)
+	case transferPaths[path]:
+		e.serveTransfers(w, r, a, path)
+	case path == "/api/orders/":
+		e.serveCreateOrder(w, a, body)
+	case path == "/api/orders/all":
+		e.serveCancelAll(w, a, body)
+	default:
+		e.serveCancel(w, a, id)
+	}
+}
+
+func orderIdFromPath(path string) (int, bool) {
+	rest, ok := strings.CutPrefix(path, "/api/orders/")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(rest)
+	return id, err == nil
+}
+
+// authenticate resolves the account of a signed request. GET requests sign
+// an empty payload; POST and DELETE requests sign their JSON body, which
+// must carry a nonce greater than any the account used before.
+func (e *Exchange) authenticate(r *http.Request, body []byte) (*account, error) {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "TDAX-API ")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing TDAX-API authorization", ErrUnauthorized)
+	}
+	sig, err := hex.DecodeString(r.Header.Get("Signature"))
+	if err != nil || len(sig) == 0 {
+		return nil, fmt.Errorf("%w: missing or malformed signature", ErrUnauthorized)
+	}
+
+	e.mu.Lock()
+	a, ok := e.accounts[key]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key %q", ErrUnauthorized, key)
+	}
+
+	var payload map[string]any
+	if r.Method != http.MethodGet {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("%w: malformed body: %w", ErrUnauthorized, err)
+		}
+	}
+	if !api.Verify([]byte(a.secret), payload, sig) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrUnauthorized)
+	}
+	if r.Method == http.MethodGet {
+		return a, nil
+	}
+
+	nonce, ok := payload["nonce"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing nonce", ErrInvalidNonce)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if nonce <= a.lastNonce {
+		return nil, fmt.Errorf("%w: %.f is not greater than %.f", ErrInvalidNonce, nonce, a.lastNonce)
+	}
+	a.lastNonce = nonce
+	return a, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"message": err.Error()})
+}
+
+// statusOf maps an error of the exchange to an HTTP status.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrInvalidNonce):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrUnknownOrder), errors.Is(err, ErrUnknownPair):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidRules):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
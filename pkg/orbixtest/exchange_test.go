@@ -0,0 +1,281 @@
+package orbixtest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/orbixtest"
+)
+
+const (
+	pair      = "btc_thb"
+	makerKey  = "maker"
+	takerKey  = "taker"
+	secret    = "secret"
+	feeRate   = 0.001
+	floatSlop = 1e-9
+)
+
+// newExchange serves an exchange with a btc_thb market, a maker account
+// holding btc and a taker account holding thb.
+func newExchange(t *testing.T) (*orbixtest.Exchange, *httptest.Server) {
+	t.Helper()
+	ex := orbixtest.New(orbixtest.Options{FeeRate: feeRate})
+	ex.AddPair(pair, api.TradingRules{TickSize: "0.01", StepSize: "0.0001", MinQty: "0.0001"})
+	ex.AddAccount(makerKey, secret)
+	ex.AddAccount(takerKey, secret)
+	if err := ex.Deposit(makerKey, "btc", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := ex.Deposit(takerKey, "thb", 1_000_000); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(ex)
+	t.Cleanup(srv.Close)
+	return ex, srv
+}
+
+func checkBalance(t *testing.T, ex *orbixtest.Exchange, key string, asset string, want orbixtest.Balance) {
+	t.Helper()
+	got := ex.Balances(key)[asset]
+	if math.Abs(got.Available-want.Available) > floatSlop || math.Abs(got.Locked-want.Locked) > floatSlop {
+		t.Errorf("%s %s balance = %+v, want %+v", key, asset, got, want)
+	}
+}
+
+func checkStatus(t *testing.T, err error, want int) {
+	t.Helper()
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want an API error with status %d", err, want)
+	}
+	if apiErr.StatusCode != want {
+		t.Fatalf("status = %d, want %d: %s", apiErr.StatusCode, want, apiErr.Body)
+	}
+}
+
+func TestPlaceAndFill(t *testing.T) {
+	ex, srv := newExchange(t)
+	ctx := context.Background()
+	if _, err := ex.PlaceOrder(makerKey, pair, api.SideTypeSell, api.OrderTypeLimit, 100, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	c := ex.NewClient(srv.URL, takerKey)
+	order, err := c.NewCreateOrderService(pair, api.SideTypeBuy, api.OrderTypeLimit, "101", "1.5").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != string(api.OrderStatusClose) || order.RemainingAmount != "0" || order.AveragePrice != "100" {
+		t.Errorf("order = %+v, want closed, filled at 100", order)
+	}
+
+	got, err := c.NewGetOrderByIdService(strconv.Itoa(order.ID), pair).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != order.Status || got.RemainingAmount != order.RemainingAmount {
+		t.Errorf("looked up order = %+v, want %+v", got, order)
+	}
+
+	checkBalance(t, ex, takerKey, "btc", orbixtest.Balance{Available: 1.5})
+	checkBalance(t, ex, takerKey, "thb", orbixtest.Balance{Available: 1_000_000 - 150*(1+feeRate)})
+	checkBalance(t, ex, makerKey, "btc", orbixtest.Balance{Available: 8, Locked: 0.5})
+	checkBalance(t, ex, makerKey, "thb", orbixtest.Balance{Available: 150 * (1 - feeRate)})
+
+	trades, err := c.NewTradeHistoryService().Pair(pair).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 1 || trades[0].OrderID != order.ID || trades[0].Amount != "1.5" {
+		t.Errorf("trades = %+v, want one fill of 1.5 for order %d", trades, order.ID)
+	}
+}
+
+func TestPlaceAndCancel(t *testing.T) {
+	ex, srv := newExchange(t)
+	ctx := context.Background()
+	c := ex.NewClient(srv.URL, takerKey)
+
+	order, err := c.NewCreateOrderService(pair, api.SideTypeBuy, api.OrderTypeLimit, "90", "1").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != string(api.OrderStatusOpen) {
+		t.Fatalf("status = %s, want open", order.Status)
+	}
+	checkBalance(t, ex, takerKey, "thb", orbixtest.Balance{Available: 1_000_000 - 90*(1+feeRate), Locked: 90 * (1 + feeRate)})
+
+	id := strconv.Itoa(order.ID)
+	if err := c.NewCancelOrderService(id, pair).Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.NewGetOrderByIdService(id, pair).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status == string(api.OrderStatusOpen) {
+		t.Errorf("status = %s after cancel", got.Status)
+	}
+	checkBalance(t, ex, takerKey, "thb", orbixtest.Balance{Available: 1_000_000})
+
+	err = c.NewCancelOrderService(id, pair).Do(ctx)
+	if err == nil {
+		t.Fatal("cancelling a cancelled order succeeded")
+	}
+}
+
+func TestBadSignature(t *testing.T) {
+	ex, srv := newExchange(t)
+	c := api.NewClient(api.ClientOptions{
+		ClientAuth: api.NewClientAuth(takerKey, "wrong"),
+		BaseURL:    srv.URL,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Nonce:      api.NewNonceManager(""),
+	})
+
+	_, err := c.NewCreateOrderService(pair, api.SideTypeBuy, api.OrderTypeLimit, "90", "1").Do(context.Background())
+	checkStatus(t, err, http.StatusUnauthorized)
+	_, err = c.NewListBalanceAddressService().Do(context.Background())
+	checkStatus(t, err, http.StatusUnauthorized)
+	checkBalance(t, ex, takerKey, "thb", orbixtest.Balance{Available: 1_000_000})
+}
+
+// signedCreate sends a create order request signed with nonce.
+func signedCreate(t *testing.T, url string, nonce int64) *http.Response {
+	t.Helper()
+	payload := map[string]any{
+		"pair":   pair,
+		"side":   "buy",
+		"type":   "limit",
+		"price":  "90",
+		"amount": "1",
+		"nonce":  nonce,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := api.Sign(secret, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url+"/api/orders/", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "TDAX-API "+takerKey)
+	req.Header.Set("Signature", sig)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestNonceReplay(t *testing.T) {
+	ex, srv := newExchange(t)
+	nonce := time.Now().UnixMilli()
+
+	if res := signedCreate(t, srv.URL, nonce); res.StatusCode != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", res.StatusCode)
+	}
+	if res := signedCreate(t, srv.URL, nonce); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("replayed request status = %d, want 401", res.StatusCode)
+	}
+	if res := signedCreate(t, srv.URL, nonce-1); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("older nonce status = %d, want 401", res.StatusCode)
+	}
+	if res := signedCreate(t, srv.URL, nonce+1); res.StatusCode != http.StatusOK {
+		t.Errorf("newer nonce status = %d, want 200", res.StatusCode)
+	}
+
+	// Only the two accepted requests placed an order.
+	checkBalance(t, ex, takerKey, "thb", orbixtest.Balance{Available: 1_000_000 - 2*90*(1+feeRate), Locked: 2 * 90 * (1 + feeRate)})
+}
+
+func TestRateLimitedPlacement(t *testing.T) {
+	ex, srv := newExchange(t)
+	ctx := context.Background()
+	c := ex.NewClient(srv.URL, takerKey)
+	clientOrderId := api.NewClientOrderId()
+
+	// A 429 is a definite rejection: the order is not placed and the
+	// create request is not retried.
+	ex.InjectRateLimit(http.MethodPost, "/api/orders/", time.Second, 1)
+	_, err := c.NewPlaceOrderService(clientOrderId, pair, api.SideTypeBuy, api.OrderTypeLimit, "90", "1").
+		SettleDelay(0).
+		Do(ctx)
+	if !errors.Is(err, api.ErrOrderNotPlaced) {
+		t.Fatalf("error = %v, want ErrOrderNotPlaced", err)
+	}
+	checkStatus(t, err, http.StatusTooManyRequests)
+	if n := ex.Calls(http.MethodPost, "/api/orders/"); n != 1 {
+		t.Errorf("create requests = %d, want 1", n)
+	}
+	checkBalance(t, ex, takerKey, "thb", orbixtest.Balance{Available: 1_000_000})
+
+	// Once the limit clears, placing the same client order id again works.
+	res, err := c.NewPlaceOrderService(clientOrderId, pair, api.SideTypeBuy, api.OrderTypeLimit, "90", "1").
+		SettleDelay(0).
+		Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Attempts != 1 || res.Reconciled {
+		t.Errorf("result = %+v, want placed on the first attempt", res)
+	}
+}
+
+func TestPlacementRetriesAfterServerError(t *testing.T) {
+	ex, srv := newExchange(t)
+	c := ex.NewClient(srv.URL, takerKey)
+
+	ex.InjectError(http.MethodPost, "/api/orders/", http.StatusServiceUnavailable, 1)
+	res, err := c.NewPlaceOrderService(api.NewClientOrderId(), pair, api.SideTypeBuy, api.OrderTypeLimit, "90", "1").
+		SettleDelay(0).
+		Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Attempts != 2 || res.Reconciled {
+		t.Errorf("result = %+v, want placed on the second attempt", res)
+	}
+	if n := ex.Calls(http.MethodPost, "/api/orders/"); n != 2 {
+		t.Errorf("create requests = %d, want 2", n)
+	}
+	checkBalance(t, ex, takerKey, "thb", orbixtest.Balance{Available: 1_000_000 - 90*(1+feeRate), Locked: 90 * (1 + feeRate)})
+}
+
+func TestRateLimitedReconciliation(t *testing.T) {
+	ex, srv := newExchange(t)
+	c := ex.NewClient(srv.URL, takerKey)
+
+	// The create request fails ambiguously and the order lookups that would
+	// tell whether it went through are rate limited.
+	ex.InjectError(http.MethodPost, "/api/orders/", http.StatusServiceUnavailable, 1)
+	ex.InjectRateLimit(http.MethodGet, "/api/orders/user", time.Second, 0)
+	_, err := c.NewPlaceOrderService(api.NewClientOrderId(), pair, api.SideTypeBuy, api.OrderTypeLimit, "90", "1").
+		SettleDelay(0).
+		Do(context.Background())
+	if !errors.Is(err, api.ErrOrderStatusUnknown) {
+		t.Fatalf("error = %v, want ErrOrderStatusUnknown", err)
+	}
+	checkStatus(t, err, http.StatusTooManyRequests)
+	if n := ex.Calls(http.MethodPost, "/api/orders/"); n != 1 {
+		t.Errorf("create requests = %d, want 1", n)
+	}
+}
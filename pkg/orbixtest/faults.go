@@ -0,0 +1,119 @@
+package orbixtest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault alters the responses to matching requests.
+type Fault struct {
+	// Method and Path select the requests, e.g. "POST" and "/api/orders/".
+	// Empty matches any; a Path ending in "/" matches the paths under it.
+	Method string
+	Path   string
+	// Times is how many requests the fault applies to; 0 means until
+	// ClearFaults.
+	Times int
+	// Latency delays the response.
+	Latency time.Duration
+	// Status, when set, answers with this status instead of serving the
+	// request, with Body or the status text as the message.
+	Status int
+	Body   string
+	// RetryAfter sets the Retry-After header of the answer.
+	RetryAfter time.Duration
+	// Drop aborts the connection without answering.
+	Drop bool
+}
+
+func (f *Fault) matches(r *http.Request) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, r.Method) {
+		return false
+	}
+	switch {
+	case f.Path == "":
+		return true
+	case strings.HasSuffix(f.Path, "/"):
+		return strings.HasPrefix(r.URL.Path, f.Path)
+	default:
+		return r.URL.Path == f.Path
+	}
+}
+
+// serve answers in place of the exchange. It reports whether it did.
+func (f *Fault) serve(w http.ResponseWriter) bool {
+	if f.Drop {
+		panic(http.ErrAbortHandler)
+	}
+	if f.Status == 0 {
+		return false
+	}
+	if f.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter.Round(time.Second)/time.Second)))
+	}
+	msg := f.Body
+	if msg == "" {
+		msg = http.StatusText(f.Status)
+	}
+	writeError(w, f.Status, errors.New(msg))
+	return true
+}
+
+// Inject adds a fault. Faults apply in the order they were added; the
+// first one matching a request is used.
+func (e *Exchange) Inject(f Fault) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.faults = append(e.faults, &f)
+}
+
+// InjectError answers the next times matching requests with status.
+func (e *Exchange) InjectError(method string, path string, status int, times int) {
+	e.Inject(Fault{Method: method, Path: path, Status: status, Times: times})
+}
+
+// InjectLatency delays the next times matching requests by d.
+func (e *Exchange) InjectLatency(method string, path string, d time.Duration, times int) {
+	e.Inject(Fault{Method: method, Path: path, Latency: d, Times: times})
+}
+
+// InjectRateLimit answers the next times matching requests with 429 Too
+// Many Requests and a Retry-After header.
+func (e *Exchange) InjectRateLimit(method string, path string, retryAfter time.Duration, times int) {
+	e.Inject(Fault{
+		Method:     method,
+		Path:       path,
+		Status:     http.StatusTooManyRequests,
+		Body:       fmt.Sprintf("rate limit exceeded, retry in %s", retryAfter),
+		RetryAfter: retryAfter,
+		Times:      times,
+	})
+}
+
+// ClearFaults removes every fault.
+func (e *Exchange) ClearFaults() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.faults = nil
+}
+
+// faultLocked returns the fault for r and uses it up. The caller holds e.mu.
+func (e *Exchange) faultLocked(r *http.Request) *Fault {
+	for i, f := range e.faults {
+		if !f.matches(r) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				e.faults = append(e.faults[:i:i], e.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package orbixtest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// Default limits of the market data endpoints.
+const (
+	defaultDepthLimit = 100
+	defaultTradeLimit = 500
+)
+
+func (e *Exchange) serveExchangeInfo(w http.ResponseWriter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	info := api.ExchangeInfo{
+		Timezone:        "UTC",
+		ServerTime:      e.now().UnixMilli(),
+		RateLimits:      []any{},
+		ExchangeFilters: []any{},
+		Symbols:         []api.ExchangeInfoSymbol{},
+	}
+	for _, m := range e.sortedMarkets() {
+		base, quote, _ := strings.Cut(m.pair, "_")
+		info.Symbols = append(info.Symbols, api.ExchangeInfoSymbol{
+			Symbol:               m.pair,
+			Status:               "TRADING",
+			BaseAsset:            base,
+			QuoteAsset:           quote,
+			OrderTypes:           []string{"LIMIT", "MARKET"},
+			IsSpotTradingAllowed: true,
+			Filters: []api.ExchangeInfoFilter{
+				{FilterType: api.FilterTypePrice, MinPrice: m.rules.MinPrice, MaxPrice: m.rules.MaxPrice, TickSize: m.rules.TickSize},
+				{FilterType: api.FilterTypeLotSize, MinQty: m.rules.MinQty, MaxQty: m.rules.MaxQty, StepSize: m.rules.StepSize},
+				{FilterType: api.FilterTypeMinNotional, MinNotional: m.rules.MinNotional},
+			},
+		})
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// sortedMarkets returns the markets ordered by pair. The caller holds e.mu.
+func (e *Exchange) sortedMarkets() []*market {
+	markets := make([]*market, 0, len(e.markets))
+	for _, m := range e.markets {
+		markets = append(markets, m)
+	}
+	sort.Slice(markets, func(i, j int) bool { return markets[i].pair < markets[j].pair })
+	return markets
+}
+
+// marketLocked returns the market of the symbol or pair query parameter,
+// or writes a 404. The caller holds e.mu.
+func (e *Exchange) marketLocked(w http.ResponseWriter, q url.Values, param string) (*market, bool) {
+	m, ok := e.markets[strings.ToLower(q.Get(param))]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %q", ErrUnknownPair, q.Get(param)))
+	}
+	return m, ok
+}
+
+func (e *Exchange) serveDepth(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.marketLocked(w, q, "symbol")
+	if !ok {
+		return
+	}
+	limit := intParam(q, "limit", defaultDepthLimit)
+	depth := api.OrderbookDepth{LastUpdateId: m.seq, Bids: [][2]string{}, Asks: [][2]string{}}
+	for _, l := range truncate(levels(m.bids), limit) {
+		depth.Bids = append(depth.Bids, [2]string{l.Price, l.Amount})
+	}
+	for _, l := range truncate(levels(m.asks), limit) {
+		depth.Asks = append(depth.Asks, [2]string{l.Price, l.Amount})
+	}
+	writeJSON(w, http.StatusOK, depth)
+}
+
+// serveOrderbook answers with both sides, or with the bids or asks alone
+// when a side is given.
+func (e *Exchange) serveOrderbook(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.marketLocked(w, q, "pair")
+	if !ok {
+		return
+	}
+	switch api.SideType(q.Get("side")) {
+	case api.SideTypeBuy:
+		writeJSON(w, http.StatusOK, levels(m.bids))
+	case api.SideTypeSell:
+		writeJSON(w, http.StatusOK, levels(m.asks))
+	default:
+		writeJSON(w, http.StatusOK, api.Orderbook{Bids: levels(m.bids), Asks: levels(m.asks)})
+	}
+}
+
+func (e *Exchange) serveOrderbookTickers(w http.ResponseWriter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	tickers := make(map[string]api.OrderbookTicker, len(e.markets))
+	for pair, m := range e.markets {
+		var t api.OrderbookTicker
+		if bids := levels(m.bids); len(bids) > 0 {
+			t.Bid = bids[0]
+		}
+		if asks := levels(m.asks); len(asks) > 0 {
+			t.Ask = asks[0]
+		}
+		tickers[pair] = t
+	}
+	writeJSON(w, http.StatusOK, tickers)
+}
+
+// serveAggTrades answers with the trades of a symbol. Every trade is its
+// own aggregate trade.
+func (e *Exchange) serveAggTrades(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.marketLocked(w, q, "symbol")
+	if !ok {
+		return
+	}
+
+	fromId := int64(intParam(q, "fromId", 0))
+	limit := intParam(q, "limit", defaultTradeLimit)
+	trades := []api.AggregateTrade{}
+	for _, t := range m.tradesBetween(q) {
+		if len(trades) == limit {
+			break
+		}
+		if t.id < fromId {
+			continue
+		}
+		trades = append(trades, api.AggregateTrade{
+			AggregateTradeID: t.id,
+			Price:            api.FormatFloat(t.price),
+			Quantity:         api.FormatFloat(t.amount),
+			FirstTradeID:     t.id,
+			LastTradeID:      t.id,
+			Timestamp:        t.time.UnixMilli(),
+			IsBuyerMaker:     t.takerSide == api.SideTypeSell,
+		})
+	}
+	writeJSON(w, http.StatusOK, trades)
+}
+
+// tradesBetween returns the trades within the startTime and endTime query
+// parameters, both inclusive.
+func (m *market) tradesBetween(q url.Values) []trade {
+	trades := m.trades
+	if q.Get("startTime") != "" {
+		start := time.UnixMilli(int64(intParam(q, "startTime", 0)))
+		i := sort.Search(len(trades), func(i int) bool { return !trades[i].time.Before(start) })
+		trades = trades[i:]
+	}
+	if q.Get("endTime") != "" {
+		end := time.UnixMilli(int64(intParam(q, "endTime", 0)))
+		i := sort.Search(len(trades), func(i int) bool { return trades[i].time.After(end) })
+		trades = trades[:i]
+	}
+	return trades
+}
+
+// serveKlines builds klines from the trade history. Intervals without
+// trades are left out.
+func (e *Exchange) serveKlines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	interval, err := parseInterval(q.Get("interval"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.marketLocked(w, q, "symbol")
+	if !ok {
+		return
+	}
+
+	limit := intParam(q, "limit", defaultTradeLimit)
+	klines := [][]any{}
+	var (
+		open                            time.Time
+		o, h, l, c, volume, quoteVolume float64
+		count                           int64
+	)
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		klines = append(klines, []any{
+			open.UnixMilli(), api.FormatFloat(o), api.FormatFloat(h), api.FormatFloat(l), api.FormatFloat(c), api.FormatFloat(volume),
+			open.Add(interval).UnixMilli() - 1, api.FormatFloat(quoteVolume), count, "0", "0", "0",
+		})
+	}
+	for _, t := range m.tradesBetween(q) {
+		start := t.time.Truncate(interval)
+		if count == 0 || !start.Equal(open) {
+			flush()
+			if len(klines) == limit {
+				break
+			}
+			open, o, h, l, volume, quoteVolume, count = start, t.price, t.price, t.price, 0, 0, 0
+		}
+		h, l, c = math.Max(h, t.price), math.Min(l, t.price), t.price
+		volume += t.amount
+		quoteVolume += t.amount * t.price
+		count++
+	}
+	if len(klines) < limit {
+		flush()
+	}
+	writeJSON(w, http.StatusOK, klines)
+}
+
+// parseInterval parses kline intervals such as "1m", "4h" or "1w".
+func parseInterval(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+	if len(s) < 2 {
+		return 0, fmt.Errorf("error: invalid interval %q", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	unit, ok := units[s[len(s)-1]]
+	if err != nil || !ok || n <= 0 {
+		return 0, fmt.Errorf("error: invalid interval %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// serveTicker24hr answers with the statistics of the last 24 hours, as an
+// object for one symbol or an array for all of them.
+func (e *Exchange) serveTicker24hr(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	if q.Get("symbol") != "" {
+		m, ok := e.marketLocked(w, q, "symbol")
+		if ok {
+			writeJSON(w, http.StatusOK, m.stats(now))
+		}
+		return
+	}
+	stats := []api.PriceChangeStats{}
+	for _, m := range e.sortedMarkets() {
+		stats = append(stats, m.stats(now))
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (m *market) stats(now time.Time) api.PriceChangeStats {
+	from := now.Add(-24 * time.Hour)
+	s := api.PriceChangeStats{
+		Symbol:    m.pair,
+		OpenTime:  from.UnixMilli(),
+		CloseTime: now.UnixMilli(),
+	}
+	if bids := levels(m.bids); len(bids) > 0 {
+		s.BidPrice = bids[0].Price
+	}
+	if asks := levels(m.asks); len(asks) > 0 {
+		s.AskPrice = asks[0].Price
+	}
+
+	var (
+		prevClose, open, last, lastQty float64
+		high, low, volume, quoteVolume float64
+	)
+	for _, t := range m.trades {
+		if t.time.After(now) {
+			break
+		}
+		if t.time.Before(from) {
+			prevClose = t.price
+			continue
+		}
+		if s.Count == 0 {
+			open, high, low = t.price, t.price, t.price
+			s.FirstId = t.id
+		}
+		high, low = math.Max(high, t.price), math.Min(low, t.price)
+		last, lastQty = t.price, t.amount
+		volume += t.amount
+		quoteVolume += t.amount * t.price
+		s.LastId = t.id
+		s.Count++
+	}
+	if prevClose == 0 {
+		prevClose = open
+	}
+
+	s.PrevClosePrice = api.FormatFloat(prevClose)
+	s.OpenPrice = api.FormatFloat(open)
+	s.LastPrice = api.FormatFloat(last)
+	s.LastQty = api.FormatFloat(lastQty)
+	s.HighPrice = api.FormatFloat(high)
+	s.LowPrice = api.FormatFloat(low)
+	s.Volume = api.FormatFloat(volume)
+	s.QuoteVolume = api.FormatFloat(quoteVolume)
+	s.PriceChange = api.FormatFloat(last - open)
+	if open > 0 {
+		s.PriceChangePercent = strconv.FormatFloat((last-open)/open*100, 'f', 2, 64)
+	}
+	if volume > 0 {
+		s.WeightedAvgPrice = api.FormatFloat(quoteVolume / volume)
+	}
+	return s
+}
+
+func intParam(q url.Values, key string, def int) int {
+	n, err := strconv.Atoi(q.Get(key))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func truncate[T any](items []T, n int) []T {
+	if n > 0 && n < len(items) {
+		return items[:n]
+	}
+	return items
+}
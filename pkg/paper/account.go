@@ -0,0 +1,670 @@
+// Package paper simulates an Orbix account for paper trading. An Account
+// is an http.RoundTripper: plug it into api.ClientOptions.HttpClient and
+// the order and balance services trade against simulated balances, while
+// market data requests pass through to the live or recorded market.
+package paper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// DefaultFeeRate is the fee charged on every fill, in the quote asset.
+const DefaultFeeRate = 0.0025
+
+// Order statuses besides api.OrderStatusOpen and api.OrderStatusClose.
+const orderStatusCancel = "cancel"
+
+// epsilon absorbs float rounding when comparing amounts.
+const epsilon = 1e-12
+
+var (
+	ErrInsufficientBalance = errors.New("error: insufficient balance")
+	ErrUnknownOrder        = errors.New("error: unknown order")
+	ErrInvalidOrder        = errors.New("error: invalid order")
+)
+
+type Options struct {
+	// Balances are the starting balances by asset, e.g. {"thb": 100000}.
+	Balances map[string]float64
+	// FeeRate is charged on the value of every fill. Defaults to
+	// DefaultFeeRate; a negative rate means no fees.
+	FeeRate float64
+	// Market serves market data requests and the order books orders are
+	// matched against. Defaults to http.DefaultTransport, the live market;
+	// use a recording transport to replay recorded books.
+	Market http.RoundTripper
+}
+
+type balance struct {
+	available float64
+	locked    float64
+}
+
+type order struct {
+	id        int
+	pair      string
+	side      api.SideType
+	typ       api.OrderType
+	price     float64
+	amount    float64
+	remaining float64
+	// filledValue is the quote value of the fills, fees excluded.
+	filledValue float64
+	// locked is what the order still holds: quote for buys, base for sells.
+	locked    float64
+	status    string
+	createdAt time.Time
+}
+
+func (o *order) api() api.Order {
+	var avg float64
+	if filled := o.amount - o.remaining; filled > epsilon {
+		avg = o.filledValue / filled
+	}
+	return api.Order{
+		ID:              o.id,
+		Type:            o.typ,
+		Price:           api.FormatFloat(o.price),
+		Amount:          api.FormatFloat(o.amount),
+		RemainingAmount: api.FormatFloat(o.remaining),
+		AveragePrice:    api.FormatFloat(avg),
+		Side:            o.side,
+		Cost:            api.FormatFloat(o.filledValue),
+		CreatedAt:       o.createdAt.UTC().Format(time.RFC3339),
+		Status:          o.status,
+	}
+}
+
+// Account is a simulated account. Orders fill against the order books of
+// the market: on placement when they cross the book, as takers at the book
+// prices, and later as makers at their own price whenever an account
+// request finds the book crossing them. Fills do not consume the market's
+// liquidity beyond a single matching pass.
+type Account struct {
+	market  http.RoundTripper
+	feeRate float64
+
+	mu          sync.Mutex
+	balances    map[string]*balance
+	orders      map[int]*order
+	trades      []api.Trade
+	nextOrderId int
+	nextTradeId int
+}
+
+func NewAccount(opts Options) *Account {
+	if opts.Market == nil {
+		opts.Market = http.DefaultTransport
+	}
+	if opts.FeeRate == 0 {
+		opts.FeeRate = DefaultFeeRate
+	}
+	a := &Account{
+		market:      opts.Market,
+		feeRate:     math.Max(opts.FeeRate, 0),
+		balances:    make(map[string]*balance),
+		orders:      make(map[int]*order),
+		nextOrderId: 1,
+		nextTradeId: 1,
+	}
+	for asset, amount := range opts.Balances {
+		a.balanceLocked(asset).available = amount
+	}
+	return a
+}
+
+// Client returns an HTTP client sending requests through the account.
+func (a *Account) Client() *http.Client {
+	return &http.Client{Transport: a}
+}
+
+// Deposit adds amount of asset to the available balance.
+func (a *Account) Deposit(asset string, amount float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.balanceLocked(asset).available += amount
+}
+
+// Balances returns the available and locked balance of every asset.
+func (a *Account) Balances() map[string]float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	balances := make(map[string]float64, len(a.balances))
+	for asset, b := range a.balances {
+		balances[asset] = b.available + b.locked
+	}
+	return balances
+}
+
+// balanceLocked returns the balance of asset, creating it. The caller holds
+// a.mu.
+func (a *Account) balanceLocked(asset string) *balance {
+	asset = strings.ToLower(asset)
+	b, ok := a.balances[asset]
+	if !ok {
+		b = &balance{}
+		a.balances[asset] = b
+	}
+	return b
+}
+
+// RoundTrip serves the account endpoints from the simulation and passes
+// everything else to the market.
+func (a *Account) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodGet && path == "/api/users/me":
+		return a.serveUser(req)
+	case req.Method == http.MethodGet && path == "/api/trade-history":
+		return a.serveTrades(req)
+	case req.Method == http.MethodGet && path == "/api/orders/user":
+		return a.serveList(req)
+	case req.Method == http.MethodPost && path == "/api/orders/":
+		return a.serveCreate(req)
+	case req.Method == http.MethodDelete && path == "/api/orders/all":
+		return a.serveCancelAll(req)
+	}
+	if id, ok := orderIdFromPath(path); ok {
+		switch req.Method {
+		case http.MethodGet:
+			return a.serveGet(req, id)
+		case http.MethodDelete:
+			return a.serveCancel(req, id)
+		}
+	}
+	return a.market.RoundTrip(req)
+}
+
+func orderIdFromPath(path string) (int, bool) {
+	rest, ok := strings.CutPrefix(path, "/api/orders/")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(rest)
+	return id, err == nil
+}
+
+type createOrderBody struct {
+	Pair   string        `json:"pair"`
+	Side   api.SideType  `json:"side"`
+	Type   api.OrderType `json:"type"`
+	Price  string        `json:"price"`
+	Amount string        `json:"amount"`
+}
+
+func (a *Account) serveCreate(req *http.Request) (*http.Response, error) {
+	var body createOrderBody
+	if err := decodeBody(req, &body); err != nil {
+		return errorResponse(req, http.StatusBadRequest, err)
+	}
+	price, err := api.ParseFloat(body.Price)
+	if err != nil {
+		return errorResponse(req, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrInvalidOrder, err))
+	}
+	amount, err := api.ParseFloat(body.Amount)
+	if err != nil {
+		return errorResponse(req, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrInvalidOrder, err))
+	}
+	switch {
+	case body.Pair == "" || !strings.Contains(body.Pair, "_"):
+		return errorResponse(req, http.StatusBadRequest, fmt.Errorf("%w: invalid pair %q", ErrInvalidOrder, body.Pair))
+	case body.Side != api.SideTypeBuy && body.Side != api.SideTypeSell:
+		return errorResponse(req, http.StatusBadRequest, fmt.Errorf("%w: invalid side %q", ErrInvalidOrder, body.Side))
+	case body.Type != api.OrderTypeLimit && body.Type != api.OrderTypeMarket:
+		return errorResponse(req, http.StatusBadRequest, fmt.Errorf("%w: invalid type %q", ErrInvalidOrder, body.Type))
+	case amount <= 0 || (body.Type == api.OrderTypeLimit && price <= 0):
+		return errorResponse(req, http.StatusBadRequest, fmt.Errorf("%w: invalid price or amount", ErrInvalidOrder))
+	}
+
+	book, err := a.book(req.Context(), req.URL, body.Pair)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.matchLocked(body.Pair, book)
+
+	o := &order{
+		pair:      strings.ToLower(body.Pair),
+		side:      body.Side,
+		typ:       body.Type,
+		price:     price,
+		amount:    amount,
+		remaining: amount,
+		status:    string(api.OrderStatusOpen),
+		createdAt: time.Now(),
+	}
+	if body.Type == api.OrderTypeMarket {
+		o.price = 0
+	}
+	if err := a.lockLocked(o, book); err != nil {
+		return errorResponse(req, http.StatusBadRequest, err)
+	}
+	o.id = a.nextOrderId
+	a.nextOrderId++
+	a.orders[o.id] = o
+
+	// Take whatever the book offers within the price.
+	levels := book.asks
+	if o.side == api.SideTypeSell {
+		levels = book.bids
+	}
+	for _, level := range levels {
+		if o.remaining <= epsilon || !o.crosses(level.price) {
+			break
+		}
+		a.fillLocked(o, level.price, math.Min(level.amount, o.remaining))
+	}
+	if o.typ == api.OrderTypeMarket && o.status == string(api.OrderStatusOpen) {
+		// Market orders never rest; what the book could not fill expires.
+		a.closeLocked(o, string(api.OrderStatusClose))
+	}
+	return jsonResponse(req, http.StatusOK, o.api())
+}
+
+// crosses reports whether the order trades at price p.
+func (o *order) crosses(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	if o.typ == api.OrderTypeMarket {
+		return true
+	}
+	if o.side == api.SideTypeBuy {
+		return p <= o.price
+	}
+	return p >= o.price
+}
+
+// lockLocked moves the funds an order needs from available to locked:
+// the base amount for sells, the quote value plus fees for buys. Market
+// buys lock the cost of walking the book. The caller holds a.mu.
+func (a *Account) lockLocked(o *order, book *depth) error {
+	base, quote, _ := strings.Cut(o.pair, "_")
+	asset, need := base, o.amount
+	if o.side == api.SideTypeBuy {
+		asset = quote
+		if o.typ == api.OrderTypeLimit {
+			need = o.price * o.amount * (1 + a.feeRate)
+		} else {
+			need = walkCost(book.asks, o.amount) * (1 + a.feeRate)
+		}
+	}
+
+	b := a.balanceLocked(asset)
+	if b.available+epsilon < need {
+		return fmt.Errorf("%w: %s %s needed, %s available", ErrInsufficientBalance, api.FormatFloat(need), asset, api.FormatFloat(b.available))
+	}
+	b.available -= need
+	b.locked += need
+	o.locked = need
+	return nil
+}
+
+// walkCost returns the quote cost of taking amount from levels.
+func walkCost(levels []level, amount float64) float64 {
+	var cost float64
+	for _, level := range levels {
+		if amount <= epsilon {
+			break
+		}
+		take := math.Min(level.amount, amount)
+		cost += take * level.price
+		amount -= take
+	}
+	return cost
+}
+
+// fillLocked executes amount of o at price. The caller holds a.mu.
+func (a *Account) fillLocked(o *order, price float64, amount float64) {
+	if amount <= epsilon {
+		return
+	}
+	base, quote, _ := strings.Cut(o.pair, "_")
+	value := price * amount
+	fee := value * a.feeRate
+
+	if o.side == api.SideTypeBuy {
+		spent := math.Min(value+fee, o.locked)
+		a.balanceLocked(quote).locked -= spent
+		o.locked -= spent
+		a.balanceLocked(base).available += amount
+	} else {
+		a.balanceLocked(base).locked -= amount
+		o.locked -= amount
+		a.balanceLocked(quote).available += value - fee
+	}
+	o.remaining -= amount
+	o.filledValue += value
+
+	a.trades = append(a.trades, api.Trade{
+		ID:          a.nextTradeId,
+		OrderID:     o.id,
+		Pair:        o.pair,
+		Side:        o.side,
+		Price:       api.FormatFloat(price),
+		Amount:      api.FormatFloat(amount),
+		Fee:         api.FormatFloat(fee),
+		FeeCurrency: quote,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	})
+	a.nextTradeId++
+
+	if o.remaining <= epsilon {
+		o.remaining = 0
+		a.closeLocked(o, string(api.OrderStatusClose))
+	}
+}
+
+// closeLocked ends an order and releases what it still locks. The caller
+// holds a.mu.
+func (a *Account) closeLocked(o *order, status string) {
+	base, quote, _ := strings.Cut(o.pair, "_")
+	asset := base
+	if o.side == api.SideTypeBuy {
+		asset = quote
+	}
+	b := a.balanceLocked(asset)
+	b.locked -= o.locked
+	b.available += o.locked
+	o.locked = 0
+	o.status = status
+}
+
+// matchLocked fills the open orders of pair that book crosses, oldest
+// first, at their own price. The caller holds a.mu.
+func (a *Account) matchLocked(pair string, book *depth) {
+	if book == nil {
+		return
+	}
+	// Fills use up the levels, so work on copies.
+	bids := slices.Clone(book.bids)
+	asks := slices.Clone(book.asks)
+
+	for _, o := range a.openOrders(pair) {
+		levels := asks
+		if o.side == api.SideTypeSell {
+			levels = bids
+		}
+		for i := range levels {
+			if o.remaining <= epsilon || !o.crosses(levels[i].price) {
+				break
+			}
+			take := math.Min(levels[i].amount, o.remaining)
+			levels[i].amount -= take
+			a.fillLocked(o, o.price, take)
+		}
+	}
+}
+
+// depth is an order book with the levels parsed, best first.
+type depth struct {
+	bids []level
+	asks []level
+}
+
+type level struct {
+	price  float64
+	amount float64
+}
+
+func parseLevels(items []api.OrderbookItem) ([]level, error) {
+	levels := make([]level, len(items))
+	for i, item := range items {
+		price, err := api.ParseFloat(item.Price)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := api.ParseFloat(item.Amount)
+		if err != nil {
+			return nil, err
+		}
+		levels[i] = level{price: price, amount: amount}
+	}
+	return levels, nil
+}
+
+// openOrders returns the open orders of pair, or of every pair if pair is
+// empty, oldest first. The caller holds a.mu.
+func (a *Account) openOrders(pair string) []*order {
+	var open []*order
+	for _, o := range a.orders {
+		if o.status == string(api.OrderStatusOpen) && (pair == "" || strings.EqualFold(o.pair, pair)) {
+			open = append(open, o)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool { return open[i].id < open[j].id })
+	return open
+}
+
+// sync matches the open orders of the given pairs, or of every pair with
+// open orders, against fresh books.
+func (a *Account) sync(ctx context.Context, base *url.URL, pairs ...string) error {
+	if len(pairs) == 0 {
+		a.mu.Lock()
+		seen := make(map[string]bool)
+		for _, o := range a.openOrders("") {
+			if !seen[o.pair] {
+				seen[o.pair] = true
+				pairs = append(pairs, o.pair)
+			}
+		}
+		a.mu.Unlock()
+	}
+
+	for _, pair := range pairs {
+		book, err := a.book(ctx, base, pair)
+		if err != nil {
+			return err
+		}
+		a.mu.Lock()
+		a.matchLocked(pair, book)
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// book reads the order book of pair from the market.
+func (a *Account) book(ctx context.Context, base *url.URL, pair string) (*depth, error) {
+	u := url.URL{
+		Scheme:   base.Scheme,
+		Host:     base.Host,
+		Path:     "/api/orders/",
+		RawQuery: url.Values{"pair": {pair}}.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.market.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order book of %s: %w", pair, err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order book of %s: %w", pair, err)
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, &api.APIError{StatusCode: res.StatusCode, Body: string(data)}
+	}
+	var book api.Orderbook
+	if err := json.Unmarshal(data, &book); err != nil {
+		return nil, fmt.Errorf("failed to decode order book of %s: %w", pair, err)
+	}
+	bids, err := parseLevels(book.Bids)
+	if err != nil {
+		return nil, fmt.Errorf("invalid order book of %s: %w", pair, err)
+	}
+	asks, err := parseLevels(book.Asks)
+	if err != nil {
+		return nil, fmt.Errorf("invalid order book of %s: %w", pair, err)
+	}
+	return &depth{bids: bids, asks: asks}, nil
+}
+
+func (a *Account) serveGet(req *http.Request, id int) (*http.Response, error) {
+	a.mu.Lock()
+	o, ok := a.orders[id]
+	a.mu.Unlock()
+	if !ok {
+		return errorResponse(req, http.StatusNotFound, fmt.Errorf("%w: %d", ErrUnknownOrder, id))
+	}
+	if err := a.sync(req.Context(), req.URL, o.pair); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return jsonResponse(req, http.StatusOK, o.api())
+}
+
+func (a *Account) serveList(req *http.Request) (*http.Response, error) {
+	q := req.URL.Query()
+	pair := q.Get("pair")
+	if err := a.sync(req.Context(), req.URL, pair); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	var orders []api.Order
+	for _, o := range a.orders {
+		if (pair == "" || strings.EqualFold(o.pair, pair)) &&
+			(q.Get("side") == "" || string(o.side) == q.Get("side")) &&
+			(q.Get("status") == "" || o.status == q.Get("status")) {
+			orders = append(orders, o.api())
+		}
+	}
+	a.mu.Unlock()
+
+	// Newest first, like the exchange.
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID > orders[j].ID })
+	return jsonResponse(req, http.StatusOK, page(orders, q))
+}
+
+func (a *Account) serveTrades(req *http.Request) (*http.Response, error) {
+	q := req.URL.Query()
+	if err := a.sync(req.Context(), req.URL); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	var trades []api.Trade
+	for i := len(a.trades) - 1; i >= 0; i-- {
+		if t := a.trades[i]; q.Get("pair") == "" || strings.EqualFold(t.Pair, q.Get("pair")) {
+			trades = append(trades, t)
+		}
+	}
+	a.mu.Unlock()
+	return jsonResponse(req, http.StatusOK, page(trades, q))
+}
+
+// page applies the limit and offset query parameters.
+func page[T any](items []T, q url.Values) []T {
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	items = items[min(max(offset, 0), len(items)):]
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil && limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	if items == nil {
+		items = []T{}
+	}
+	return items
+}
+
+func (a *Account) serveUser(req *http.Request) (*http.Response, error) {
+	if err := a.sync(req.Context(), req.URL); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	wallets := make(map[api.CoinSymbol]api.Wallet, len(a.balances))
+	for asset, b := range a.balances {
+		wallets[api.CoinSymbol(asset)] = api.Wallet{
+			Addresses:        []api.Address{},
+			AvailableBalance: api.FormatFloat(b.available),
+		}
+	}
+	return jsonResponse(req, http.StatusOK, api.User{Wallets: wallets})
+}
+
+func (a *Account) serveCancel(req *http.Request, id int) (*http.Response, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	o, ok := a.orders[id]
+	if !ok {
+		return errorResponse(req, http.StatusNotFound, fmt.Errorf("%w: %d", ErrUnknownOrder, id))
+	}
+	if o.status != string(api.OrderStatusOpen) {
+		return errorResponse(req, http.StatusBadRequest, fmt.Errorf("%w: order %d is not open", ErrInvalidOrder, id))
+	}
+	a.closeLocked(o, orderStatusCancel)
+	return jsonResponse(req, http.StatusOK, o.api())
+}
+
+func (a *Account) serveCancelAll(req *http.Request) (*http.Response, error) {
+	var body api.CancelOrderRequestBody
+	if err := decodeBody(req, &body); err != nil {
+		return errorResponse(req, http.StatusBadRequest, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	res := []api.CancelAllOrdersResponse{}
+	for _, o := range a.openOrders(body.Pair) {
+		a.closeLocked(o, orderStatusCancel)
+		res = append(res, api.CancelAllOrdersResponse{Code: "0", Message: "order " + strconv.Itoa(o.id) + " cancelled"})
+	}
+	return jsonResponse(req, http.StatusOK, res)
+}
+
+func decodeBody(req *http.Request, v any) error {
+	if req.Body == nil {
+		return fmt.Errorf("%w: missing body", ErrInvalidOrder)
+	}
+	defer req.Body.Close()
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+	return nil
+}
+
+func jsonResponse(req *http.Request, status int, v any) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("err marshalling JSON: %w", err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+func errorResponse(req *http.Request, status int, err error) (*http.Response, error) {
+	return jsonResponse(req, status, map[string]string{"message": err.Error()})
+}
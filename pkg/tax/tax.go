@@ -0,0 +1,210 @@
+// Package tax generates Thai tax-year capital gains reports from the
+// trade and transfer history of an account. Disposals are valued in THB
+// at execution time, crypto-to-crypto trades included, and reported per
+// calendar year in Thai time as CSV and an HTML summary.
+package tax
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/accounting"
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/klinestore"
+)
+
+// Default Constants
+const (
+	DefaultMethod = accounting.FIFO
+	// DefaultRateInterval is the kline interval KlineRate looks prices up
+	// in.
+	DefaultRateInterval = "1m"
+)
+
+// Bangkok is Thai time. Thailand keeps no daylight saving time.
+var Bangkok = time.FixedZone("ICT", 7*60*60)
+
+var ErrInvalidYear = errors.New("error: invalid tax year")
+
+type Options struct {
+	Year int
+	// Method matches disposals to lots. Defaults to DefaultMethod.
+	Method accounting.Method
+}
+
+type Kind string
+
+const (
+	// KindSale is a sale or a spend of an asset in a trade.
+	KindSale Kind = "sale"
+	// KindFee is an asset paid as a trading or withdrawal fee.
+	KindFee Kind = "fee"
+)
+
+// Row is one disposal. Amounts are in THB.
+type Row struct {
+	Time   time.Time
+	Asset  string
+	Pair   string
+	Kind   Kind
+	Amount float64
+	// Acquired is when the oldest lot matched was acquired; zero if no lot
+	// was matched.
+	Acquired time.Time
+	// Cost is the acquisition cost, acquisition fees included.
+	Cost float64
+	// Proceeds are gross; Fee is deducted from them.
+	Proceeds float64
+	Fee      float64
+	Gain     float64
+	// Lots are the IDs of the lots matched, for the audit trail.
+	Lots []int
+}
+
+// AssetSummary totals the rows of one asset.
+type AssetSummary struct {
+	Asset     string
+	Disposals int
+	Proceeds  float64
+	Cost      float64
+	Fees      float64
+	Gain      float64
+}
+
+type Summary struct {
+	Disposals int
+	Proceeds  float64
+	Cost      float64
+	Fees      float64
+	// Gains and Losses total the positive and negative rows; Net is their
+	// sum.
+	Gains  float64
+	Losses float64
+	Net    float64
+	Assets []AssetSummary
+}
+
+type Report struct {
+	Year    int
+	Method  accounting.Method
+	Rows    []Row
+	Summary Summary
+	// Warnings are the ledger warnings up to the end of the year, which
+	// can affect its disposals, each prefixed with the time of its entry.
+	Warnings []string
+}
+
+// Generate reports the disposals of the ledger in the calendar year, in
+// Thai time. Disposals are matched to lots acquired in any year before.
+func Generate(l *accounting.Ledger, opts Options) (*Report, error) {
+	if opts.Year < 1970 || opts.Year > 9999 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidYear, opts.Year)
+	}
+	if opts.Method == "" {
+		opts.Method = DefaultMethod
+	}
+	ledger, err := l.Report(opts.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Date(opts.Year, time.January, 1, 0, 0, 0, 0, Bangkok)
+	end := start.AddDate(1, 0, 0)
+	r := &Report{Year: opts.Year, Method: opts.Method, Rows: []Row{}}
+	assets := make(map[string]*AssetSummary)
+	for _, d := range ledger.Disposals {
+		if d.Time.Before(start) || !d.Time.Before(end) {
+			continue
+		}
+		row := rowOf(d)
+		r.Rows = append(r.Rows, row)
+
+		s := &r.Summary
+		s.Disposals++
+		s.Proceeds += row.Proceeds
+		s.Cost += row.Cost
+		s.Fees += row.Fee
+		if row.Gain >= 0 {
+			s.Gains += row.Gain
+		} else {
+			s.Losses += row.Gain
+		}
+		a, ok := assets[row.Asset]
+		if !ok {
+			a = &AssetSummary{Asset: row.Asset}
+			assets[row.Asset] = a
+		}
+		a.Disposals++
+		a.Proceeds += row.Proceeds
+		a.Cost += row.Cost
+		a.Fees += row.Fee
+		a.Gain += row.Gain
+	}
+	r.Summary.Net = r.Summary.Gains + r.Summary.Losses
+	for _, a := range assets {
+		r.Summary.Assets = append(r.Summary.Assets, *a)
+	}
+	sort.Slice(r.Summary.Assets, func(i, j int) bool { return r.Summary.Assets[i].Asset < r.Summary.Assets[j].Asset })
+	for _, w := range ledger.Warnings {
+		if w.Time.Before(end) {
+			r.Warnings = append(r.Warnings, w.Time.In(Bangkok).Format(timeLayout)+" "+w.Message)
+		}
+	}
+	return r, nil
+}
+
+func rowOf(d accounting.Disposal) Row {
+	row := Row{
+		Time:     d.Time.In(Bangkok),
+		Asset:    strings.ToUpper(d.Asset),
+		Pair:     strings.ToUpper(d.Source.Pair),
+		Kind:     KindSale,
+		Amount:   d.Amount,
+		Cost:     d.Cost,
+		Proceeds: d.Proceeds + d.Fee,
+		Fee:      d.Fee,
+		Gain:     d.Realized,
+	}
+	if d.Source.Fee {
+		row.Kind = KindFee
+	}
+	for _, m := range d.Matches {
+		row.Lots = append(row.Lots, m.LotID)
+		if row.Acquired.IsZero() || m.Acquired.Before(row.Acquired) {
+			row.Acquired = m.Acquired.In(Bangkok)
+		}
+	}
+	return row
+}
+
+// KlineRate returns an accounting.Config.Rate pricing an asset in THB at
+// the open of the <asset>_thb kline of interval holding the time, e.g. to
+// value crypto-to-crypto trades at execution time. The klines must have
+// been synced into the store; an empty interval is DefaultRateInterval.
+func KlineRate(store *klinestore.Store, interval string) func(asset string, at time.Time) (float64, bool) {
+	if interval == "" {
+		interval = DefaultRateInterval
+	}
+	d, err := klinestore.IntervalDuration(interval)
+	return func(asset string, at time.Time) (float64, bool) {
+		if err != nil {
+			return 0, false
+		}
+		klines, err := store.Range(strings.ToLower(asset)+"_thb", interval, at.Add(-d+time.Millisecond), at.Add(time.Millisecond))
+		if err != nil || len(klines) == 0 {
+			return 0, false
+		}
+		return klineOpen(klines[len(klines)-1])
+	}
+}
+
+func klineOpen(k api.Kline) (float64, bool) {
+	open, err := api.ParseFloat(k.Open)
+	if err != nil || open <= 0 {
+		return 0, false
+	}
+	return open, true
+}
@@ -0,0 +1,126 @@
+package tax
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayout formats times in the CSV and HTML output.
+const timeLayout = "2006-01-02 15:04:05"
+
+// csvHeader are the columns of WriteCSV. Amounts are in THB.
+var csvHeader = []string{"date", "asset", "pair", "type", "amount", "acquired", "cost_thb", "proceeds_thb", "fee_thb", "gain_thb", "lots"}
+
+// WriteCSV writes one row per disposal.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, row := range r.Rows {
+		lots := make([]string, len(row.Lots))
+		for i, id := range row.Lots {
+			lots[i] = strconv.Itoa(id)
+		}
+		cw.Write([]string{
+			row.Time.Format(timeLayout),
+			row.Asset,
+			row.Pair,
+			string(row.Kind),
+			strconv.FormatFloat(row.Amount, 'f', -1, 64),
+			formatTime(row.Acquired),
+			formatTHB(row.Cost),
+			formatTHB(row.Proceeds),
+			formatTHB(row.Fee),
+			formatTHB(row.Gain),
+			strings.Join(lots, ";"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteHTML writes a standalone page with the summary, the totals per
+// asset and every disposal.
+func (r *Report) WriteHTML(w io.Writer) error {
+	if err := htmlTemplate.Execute(w, r); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
+
+func formatTHB(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(timeLayout)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"thb":  formatTHB,
+	"time": formatTime,
+	"amount": func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Capital gains {{.Year}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+td.num { text-align: right; }
+.loss { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Capital gains {{.Year}}</h1>
+<p>Calendar year {{.Year}} in Thai time. Amounts in THB, valued at execution time. Cost basis method: {{.Method}}.</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Disposals</th><td class="num">{{.Summary.Disposals}}</td></tr>
+<tr><th>Proceeds</th><td class="num">{{thb .Summary.Proceeds}}</td></tr>
+<tr><th>Acquisition cost</th><td class="num">{{thb .Summary.Cost}}</td></tr>
+<tr><th>Fees</th><td class="num">{{thb .Summary.Fees}}</td></tr>
+<tr><th>Gains</th><td class="num">{{thb .Summary.Gains}}</td></tr>
+<tr><th>Losses</th><td class="num loss">{{thb .Summary.Losses}}</td></tr>
+<tr><th>Net gain</th><td class="num{{if lt .Summary.Net 0.0}} loss{{end}}">{{thb .Summary.Net}}</td></tr>
+</table>
+
+<h2>By asset</h2>
+<table>
+<tr><th>Asset</th><th>Disposals</th><th>Proceeds</th><th>Cost</th><th>Fees</th><th>Gain</th></tr>
+{{- range .Summary.Assets}}
+<tr><td>{{.Asset}}</td><td class="num">{{.Disposals}}</td><td class="num">{{thb .Proceeds}}</td><td class="num">{{thb .Cost}}</td><td class="num">{{thb .Fees}}</td><td class="num{{if lt .Gain 0.0}} loss{{end}}">{{thb .Gain}}</td></tr>
+{{- end}}
+</table>
+
+<h2>Disposals</h2>
+<table>
+<tr><th>Date</th><th>Asset</th><th>Pair</th><th>Type</th><th>Amount</th><th>Acquired</th><th>Cost</th><th>Proceeds</th><th>Fee</th><th>Gain</th></tr>
+{{- range .Rows}}
+<tr><td>{{time .Time}}</td><td>{{.Asset}}</td><td>{{.Pair}}</td><td>{{.Kind}}</td><td class="num">{{amount .Amount}}</td><td>{{time .Acquired}}</td><td class="num">{{thb .Cost}}</td><td class="num">{{thb .Proceeds}}</td><td class="num">{{thb .Fee}}</td><td class="num{{if lt .Gain 0.0}} loss{{end}}">{{thb .Gain}}</td></tr>
+{{- end}}
+</table>
+{{- if .Warnings}}
+
+<h2>Warnings</h2>
+<ul>
+{{- range .Warnings}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,518 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// DefaultResubscribeDelay is how long Run waits before subscribing again
+// to a price feed that closed.
+const DefaultResubscribeDelay = time.Second
+
+// ConditionalType is an order type emulated by the client: the order is
+// held locally and submitted once its trigger price is reached.
+type ConditionalType string
+
+const (
+	// ConditionalStopMarket sends a market order when the price moves
+	// against the position through the trigger.
+	ConditionalStopMarket ConditionalType = "stop_market"
+	// ConditionalStopLimit sends a limit order at LimitPrice when the price
+	// moves against the position through the trigger.
+	ConditionalStopLimit ConditionalType = "stop_limit"
+	// ConditionalTakeProfit sends a market order when the price moves in
+	// favour of the position through the trigger.
+	ConditionalTakeProfit ConditionalType = "take_profit"
+	// ConditionalTakeProfitLimit sends a limit order at LimitPrice when the
+	// price moves in favour of the position through the trigger.
+	ConditionalTakeProfitLimit ConditionalType = "take_profit_limit"
+)
+
+func (t ConditionalType) isStop() bool {
+	return t == ConditionalStopMarket || t == ConditionalStopLimit
+}
+
+func (t ConditionalType) isLimit() bool {
+	return t == ConditionalStopLimit || t == ConditionalTakeProfitLimit
+}
+
+func (t ConditionalType) valid() bool {
+	switch t {
+	case ConditionalStopMarket, ConditionalStopLimit, ConditionalTakeProfit, ConditionalTakeProfitLimit:
+		return true
+	}
+	return false
+}
+
+// ConditionalStatus is the status of a conditional order.
+type ConditionalStatus string
+
+const (
+	ConditionalPending   ConditionalStatus = "pending"
+	ConditionalTriggered ConditionalStatus = "triggered"
+	ConditionalSubmitted ConditionalStatus = "submitted"
+	ConditionalFailed    ConditionalStatus = "failed"
+	ConditionalCancelled ConditionalStatus = "cancelled"
+)
+
+var (
+	ErrInvalidConditionalOrder = errors.New("error: invalid conditional order")
+	ErrDuplicateOrderId        = errors.New("error: duplicate order id")
+	ErrNotPending              = errors.New("error: order is not pending")
+)
+
+// ConditionalOrder is a stop-loss or take-profit order held by the client.
+type ConditionalOrder struct {
+	// Id is generated when empty and doubles as the client order id of the
+	// submitted order.
+	Id           string          `json:"id"`
+	Type         ConditionalType `json:"type"`
+	Pair         string          `json:"pair"`
+	Side         api.SideType    `json:"side"`
+	Amount       string          `json:"amount"`
+	TriggerPrice string          `json:"trigger_price"`
+	// LimitPrice is the price of the order sent by limit types.
+	LimitPrice string `json:"limit_price,omitempty"`
+	// TriggerSource is the quote price compared with TriggerPrice. Defaults
+	// to the bid for sells and the ask for buys, i.e. the price the order
+	// would execute against.
+	TriggerSource PriceSource `json:"trigger_source,omitempty"`
+	// MaxSlippage guards market types: when set, they are sent as a limit
+	// order priced MaxSlippage (a fraction, 0.01 = 1%) worse than the
+	// trigger price instead of as a market order.
+	MaxSlippage float64 `json:"max_slippage,omitempty"`
+	// PricePrecision is the number of decimals of the slippage-guarded
+	// price. Defaults to the decimals of TriggerPrice.
+	PricePrecision int `json:"price_precision,omitempty"`
+
+	Status      ConditionalStatus `json:"status"`
+	OrderId     int               `json:"order_id,omitempty"`
+	Err         string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	TriggeredAt time.Time         `json:"triggered_at,omitempty"`
+	// TriggeredPrice is the quote price that fired the order.
+	TriggeredPrice float64 `json:"triggered_price,omitempty"`
+}
+
+func (o *ConditionalOrder) validate() error {
+	if !o.Type.valid() {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidConditionalOrder, o.Type)
+	}
+	if o.Side != api.SideTypeBuy && o.Side != api.SideTypeSell {
+		return fmt.Errorf("%w: unknown side %q", ErrInvalidConditionalOrder, o.Side)
+	}
+	if o.Pair == "" {
+		return fmt.Errorf("%w: missing pair", ErrInvalidConditionalOrder)
+	}
+	if parsePrice(o.Amount) <= 0 {
+		return fmt.Errorf("%w: invalid amount %q", ErrInvalidConditionalOrder, o.Amount)
+	}
+	if parsePrice(o.TriggerPrice) <= 0 {
+		return fmt.Errorf("%w: invalid trigger price %q", ErrInvalidConditionalOrder, o.TriggerPrice)
+	}
+	if o.Type.isLimit() && parsePrice(o.LimitPrice) <= 0 {
+		return fmt.Errorf("%w: invalid limit price %q", ErrInvalidConditionalOrder, o.LimitPrice)
+	}
+	if o.MaxSlippage < 0 || o.MaxSlippage >= 1 {
+		return fmt.Errorf("%w: max slippage %v out of range", ErrInvalidConditionalOrder, o.MaxSlippage)
+	}
+	return nil
+}
+
+func (o *ConditionalOrder) source() PriceSource {
+	if o.TriggerSource != "" {
+		return o.TriggerSource
+	}
+	if o.Side == api.SideTypeSell {
+		return PriceSourceBid
+	}
+	return PriceSourceAsk
+}
+
+// triggered reports whether price reaches the trigger. Stops fire when the
+// price moves through the trigger against the order's position (down for
+// sells, up for buys), take-profits when it moves in favour of it.
+func (o *ConditionalOrder) triggered(price float64) bool {
+	if price <= 0 {
+		return false
+	}
+	return crossed(o.Side, o.Type.isStop(), price, parsePrice(o.TriggerPrice))
+}
+
+// crossed reports whether price is through trigger. A stop sell fires at or
+// below the trigger, a stop buy at or above it; take-profits the reverse.
+func crossed(side api.SideType, stop bool, price float64, trigger float64) bool {
+	below := side == api.SideTypeSell
+	if !stop {
+		below = !below
+	}
+	if below {
+		return price <= trigger
+	}
+	return price >= trigger
+}
+
+// orderParams returns the type and price of the order to submit.
+func (o *ConditionalOrder) orderParams() (api.OrderType, string) {
+	if o.Type.isLimit() {
+		return api.OrderTypeLimit, o.LimitPrice
+	}
+	if o.MaxSlippage > 0 {
+		prec := o.PricePrecision
+		if prec == 0 {
+			prec = api.DecimalPlaces(o.TriggerPrice)
+		}
+		return api.OrderTypeLimit, slippagePrice(o.Side, parsePrice(o.TriggerPrice), o.MaxSlippage, prec)
+	}
+	return api.OrderTypeMarket, "0"
+}
+
+// slippagePrice returns the worst acceptable price for an order on side
+// referenced to price, formatted with prec decimals.
+func slippagePrice(side api.SideType, price float64, slippage float64, prec int) string {
+	if side == api.SideTypeSell {
+		price *= 1 - slippage
+	} else {
+		price *= 1 + slippage
+	}
+	return strconv.FormatFloat(price, 'f', prec, 64)
+}
+
+type ConditionalEngineOptions struct {
+	// Store persists conditional orders across restarts. Optional.
+	Store Store[ConditionalOrder]
+	// EventBuffer sizes the event channel. Defaults to DefaultEventBuffer.
+	EventBuffer int
+}
+
+// ConditionalEngine holds stop-loss and take-profit orders, watches a price
+// feed and submits each order through the create order service once its
+// trigger fires.
+type ConditionalEngine struct {
+	c     *api.Client
+	feed  PriceFeed
+	store Store[ConditionalOrder]
+
+	mu     sync.Mutex
+	orders map[string]*ConditionalOrder
+	wake   chan struct{}
+	events chan ConditionalOrder
+
+	submitting sync.WaitGroup
+}
+
+// NewConditionalEngine creates an engine and loads the orders saved in the
+// store. Orders that were triggered but not confirmed as submitted when the
+// previous process stopped are marked failed, since they may or may not
+// have reached the exchange.
+func NewConditionalEngine(c *api.Client, feed PriceFeed, opts ConditionalEngineOptions) (*ConditionalEngine, error) {
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = DefaultEventBuffer
+	}
+	e := &ConditionalEngine{
+		c:      c,
+		feed:   feed,
+		store:  opts.Store,
+		orders: make(map[string]*ConditionalOrder),
+		wake:   make(chan struct{}, 1),
+		events: make(chan ConditionalOrder, opts.EventBuffer),
+	}
+
+	if e.store == nil {
+		return e, nil
+	}
+	saved, err := e.store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conditional orders: %w", err)
+	}
+	for i := range saved {
+		o := saved[i]
+		if o.Status == ConditionalTriggered {
+			o.Status = ConditionalFailed
+			o.Err = "interrupted while submitting, check the exchange for the order"
+		}
+		e.orders[o.Id] = &o
+	}
+	return e, nil
+}
+
+// Events returns the channel receiving every order that was triggered,
+// submitted or failed.
+func (e *ConditionalEngine) Events() <-chan ConditionalOrder {
+	return e.events
+}
+
+// Add validates and starts holding a conditional order.
+func (e *ConditionalEngine) Add(o ConditionalOrder) (ConditionalOrder, error) {
+	if o.Id == "" {
+		o.Id = api.NewClientOrderId()
+	}
+	if err := o.validate(); err != nil {
+		return ConditionalOrder{}, err
+	}
+	o.Status = ConditionalPending
+	o.CreatedAt = time.Now()
+	o.OrderId, o.Err = 0, ""
+
+	e.mu.Lock()
+	if _, ok := e.orders[o.Id]; ok {
+		e.mu.Unlock()
+		return ConditionalOrder{}, fmt.Errorf("%w: %s", ErrDuplicateOrderId, o.Id)
+	}
+	e.orders[o.Id] = &o
+	err := e.saveLocked()
+	e.mu.Unlock()
+
+	e.notify()
+	return o, err
+}
+
+// Cancel stops holding a pending order.
+func (e *ConditionalEngine) Cancel(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownOrder, id)
+	}
+	if o.Status != ConditionalPending {
+		return fmt.Errorf("%w: %s is %s", ErrNotPending, id, o.Status)
+	}
+	o.Status = ConditionalCancelled
+	return e.saveLocked()
+}
+
+// Order returns a conditional order by id.
+func (e *ConditionalEngine) Order(id string) (ConditionalOrder, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[id]
+	if !ok {
+		return ConditionalOrder{}, false
+	}
+	return *o, true
+}
+
+// Orders returns every conditional order, oldest first.
+func (e *ConditionalEngine) Orders() []ConditionalOrder {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	orders := make([]ConditionalOrder, 0, len(e.orders))
+	for _, o := range e.orders {
+		orders = append(orders, *o)
+	}
+	slices.SortFunc(orders, func(a, b ConditionalOrder) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+	return orders
+}
+
+// Run subscribes to the price feed for every pair with pending orders and
+// evaluates triggers on each quote until ctx is done. A pair whose feed
+// closes is subscribed to again after DefaultResubscribeDelay. Run waits
+// for the submissions it started before returning.
+func (e *ConditionalEngine) Run(ctx context.Context) error {
+	quotes := make(chan Quote)
+	closed := make(chan *feedSubscription)
+	subs := make(map[string]*feedSubscription)
+	retryAt := make(map[string]time.Time)
+	defer func() {
+		for _, sub := range subs {
+			sub.cancel()
+		}
+		e.Wait()
+	}()
+
+	for {
+		pairs := e.pendingPairs()
+		for pair, sub := range subs {
+			if !pairs[pair] {
+				sub.cancel()
+				delete(subs, pair)
+			}
+		}
+		now := time.Now()
+		for pair := range pairs {
+			if _, ok := subs[pair]; ok || now.Before(retryAt[pair]) {
+				continue
+			}
+			subCtx, cancel := context.WithCancel(ctx)
+			ch, err := e.feed.Subscribe(subCtx, pair)
+			if err != nil {
+				cancel()
+				return fmt.Errorf("failed to subscribe to %s: %w", pair, err)
+			}
+			sub := &feedSubscription{pair: pair, cancel: cancel}
+			subs[pair] = sub
+			go forwardQuotes(subCtx, sub, ch, quotes, closed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-e.wake:
+		case q := <-quotes:
+			e.OnQuote(ctx, q)
+		case sub := <-closed:
+			// A subscription replaced in the meantime is already gone.
+			if subs[sub.pair] != sub {
+				continue
+			}
+			sub.cancel()
+			delete(subs, sub.pair)
+			retryAt[sub.pair] = time.Now().Add(DefaultResubscribeDelay)
+			time.AfterFunc(DefaultResubscribeDelay, e.notify)
+			e.c.Logger.Warn("Orbix price feed closed, resubscribing", "pair", sub.pair)
+		}
+	}
+}
+
+// feedSubscription is a price feed subscription of Run.
+type feedSubscription struct {
+	pair   string
+	cancel context.CancelFunc
+}
+
+// forwardQuotes copies quotes from in to out and reports sub on closed
+// when in closes before ctx is done.
+func forwardQuotes(ctx context.Context, sub *feedSubscription, in <-chan Quote, out chan<- Quote, closed chan<- *feedSubscription) {
+	for q := range in {
+		select {
+		case out <- q:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	select {
+	case closed <- sub:
+	case <-ctx.Done():
+	}
+}
+
+// OnQuote evaluates the pending orders of q.Pair and submits the triggered
+// ones, each in its own goroutine, so it returns without waiting for the
+// exchange. Run calls it for every quote; call it directly to drive the
+// engine from another source, and Wait for the submissions to finish.
+func (e *ConditionalEngine) OnQuote(ctx context.Context, q Quote) {
+	e.mu.Lock()
+	var fired []*ConditionalOrder
+	for _, o := range e.orders {
+		if o.Status != ConditionalPending || !strings.EqualFold(o.Pair, q.Pair) {
+			continue
+		}
+		price := q.Price(o.source())
+		if !o.triggered(price) {
+			continue
+		}
+		o.Status = ConditionalTriggered
+		o.TriggeredAt = time.Now()
+		o.TriggeredPrice = price
+		fired = append(fired, o)
+	}
+	if len(fired) > 0 {
+		if err := e.saveLocked(); err != nil {
+			e.c.Logger.Error("Orbix conditional orders not saved", "error", err)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, o := range fired {
+		e.submitting.Add(1)
+		go func() {
+			defer e.submitting.Done()
+			e.submit(ctx, o)
+		}()
+	}
+	if len(fired) > 0 {
+		e.notify()
+	}
+}
+
+// Wait waits for the submissions started by OnQuote.
+func (e *ConditionalEngine) Wait() {
+	e.submitting.Wait()
+}
+
+func (e *ConditionalEngine) submit(ctx context.Context, o *ConditionalOrder) {
+	e.mu.Lock()
+	snapshot := *o
+	e.mu.Unlock()
+	e.emit(snapshot)
+
+	orderType, price := snapshot.orderParams()
+	res, err := e.c.NewPlaceOrderService(snapshot.Id, snapshot.Pair, snapshot.Side, orderType, price, snapshot.Amount).
+		Do(ctx)
+
+	e.mu.Lock()
+	if err != nil {
+		o.Status = ConditionalFailed
+		o.Err = err.Error()
+	} else {
+		o.Status = ConditionalSubmitted
+		o.OrderId = res.Order.ID
+	}
+	if err := e.saveLocked(); err != nil {
+		e.c.Logger.Error("Orbix conditional orders not saved", "error", err)
+	}
+	snapshot = *o
+	e.mu.Unlock()
+	e.emit(snapshot)
+}
+
+func (e *ConditionalEngine) emit(o ConditionalOrder) {
+	select {
+	case e.events <- o:
+	default:
+		e.c.Logger.Warn("Orbix conditional order event dropped", "id", o.Id, "status", o.Status)
+	}
+}
+
+// notify wakes Run to refresh its subscriptions.
+func (e *ConditionalEngine) notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *ConditionalEngine) pendingPairs() map[string]bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pairs := make(map[string]bool)
+	for _, o := range e.orders {
+		if o.Status == ConditionalPending {
+			pairs[strings.ToLower(o.Pair)] = true
+		}
+	}
+	return pairs
+}
+
+// saveLocked persists every order. The caller holds e.mu.
+func (e *ConditionalEngine) saveLocked() error {
+	if e.store == nil {
+		return nil
+	}
+	orders := make([]ConditionalOrder, 0, len(e.orders))
+	for _, o := range e.orders {
+		orders = append(orders, *o)
+	}
+	return e.store.Save(orders)
+}
@@ -0,0 +1,355 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// OCOStatus is the status of a one-cancels-other order.
+type OCOStatus string
+
+const (
+	OCOActive           OCOStatus = "active"
+	OCOTakeProfitFilled OCOStatus = "take_profit_filled"
+	OCOStopTriggered    OCOStatus = "stop_triggered"
+	OCOCancelled        OCOStatus = "cancelled"
+	OCOFailed           OCOStatus = "failed"
+)
+
+// Done reports whether the OCO no longer manages any leg.
+func (s OCOStatus) Done() bool {
+	return s != OCOActive
+}
+
+var ErrOCODone = errors.New("error: OCO is no longer active")
+
+// OCOOrder links a limit take-profit resting on the book with a stop leg
+// emulated by the client. Both legs trade Amount on Side, e.g. sell to exit
+// a long position.
+type OCOOrder struct {
+	Pair   string
+	Side   api.SideType
+	Amount string
+	// TakeProfitPrice is the limit price of the take-profit leg.
+	TakeProfitPrice string
+	// StopPrice is the trigger of the stop leg.
+	StopPrice string
+	// StopLimitPrice makes the stop leg a stop-limit order. When empty it is
+	// a stop-market order, guarded by MaxSlippage if set.
+	StopLimitPrice string
+	MaxSlippage    float64
+	// TriggerSource defaults as for ConditionalOrder.
+	TriggerSource PriceSource
+}
+
+// stopLeg returns the stop leg as a conditional order for amount.
+func (o OCOOrder) stopLeg(amount string) ConditionalOrder {
+	leg := ConditionalOrder{
+		Type:          ConditionalStopMarket,
+		Pair:          o.Pair,
+		Side:          o.Side,
+		Amount:        amount,
+		TriggerPrice:  o.StopPrice,
+		LimitPrice:    o.StopLimitPrice,
+		TriggerSource: o.TriggerSource,
+		MaxSlippage:   o.MaxSlippage,
+	}
+	if o.StopLimitPrice != "" {
+		leg.Type = ConditionalStopLimit
+	}
+	return leg
+}
+
+// OCOState is a snapshot of an OCO.
+type OCOState struct {
+	Status            OCOStatus
+	TakeProfitOrderId int
+	// TakeProfitFilled is the executed amount of the take-profit leg.
+	TakeProfitFilled string
+	// StopAmount is the current size of the stop leg: the unfilled amount
+	// of the take-profit leg.
+	StopAmount  string
+	StopOrderId int
+	// Err is the last error, e.g. a failed cancel that delayed the stop.
+	Err error
+}
+
+type OCOOptions struct {
+	// PollInterval is how often the take-profit leg is checked for fills.
+	// Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// EventBuffer sizes the update channel. Defaults to DefaultEventBuffer.
+	EventBuffer int
+}
+
+// OCO is a live one-cancels-other order. When the take-profit leg fills,
+// even partially, the stop leg is resized to what is left, and cancelled
+// once nothing is left. When the stop triggers, the take-profit leg is
+// cancelled first and the stop order is only sent for what the take-profit
+// leg had not filled by then, so the legs never execute more than Amount
+// together.
+type OCO struct {
+	c    *api.Client
+	feed PriceFeed
+	spec OCOOrder
+	opts OCOOptions
+
+	// legs serializes the calls that read or change the legs on the
+	// exchange, which are made without holding mu.
+	legs    sync.Mutex
+	mu      sync.Mutex
+	state   OCOState
+	updates chan OCOState
+}
+
+// PlaceOCO validates spec, places the take-profit leg and returns the OCO.
+// Call Run to manage it.
+func PlaceOCO(ctx context.Context, c *api.Client, feed PriceFeed, spec OCOOrder, opts OCOOptions) (*OCO, error) {
+	if parsePrice(spec.TakeProfitPrice) <= 0 {
+		return nil, fmt.Errorf("%w: invalid take profit price %q", ErrInvalidConditionalOrder, spec.TakeProfitPrice)
+	}
+	stop := spec.stopLeg(spec.Amount)
+	if err := stop.validate(); err != nil {
+		return nil, err
+	}
+	if crossed(spec.Side, false, parsePrice(spec.StopPrice), parsePrice(spec.TakeProfitPrice)) {
+		return nil, fmt.Errorf("%w: stop price %s is beyond take profit price %s", ErrInvalidConditionalOrder, spec.StopPrice, spec.TakeProfitPrice)
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = DefaultEventBuffer
+	}
+
+	res, err := c.NewPlaceOrderService(api.NewClientOrderId(), spec.Pair, spec.Side, api.OrderTypeLimit, spec.TakeProfitPrice, spec.Amount).
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to place take profit leg: %w", err)
+	}
+
+	return &OCO{
+		c:    c,
+		feed: feed,
+		spec: spec,
+		opts: opts,
+		state: OCOState{
+			Status:            OCOActive,
+			TakeProfitOrderId: res.Order.ID,
+			TakeProfitFilled:  "0",
+			StopAmount:        spec.Amount,
+		},
+		updates: make(chan OCOState, opts.EventBuffer),
+	}, nil
+}
+
+// State returns the current state.
+func (o *OCO) State() OCOState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.state
+}
+
+// Updates returns the channel receiving every state change.
+func (o *OCO) Updates() <-chan OCOState {
+	return o.updates
+}
+
+// Run watches the take-profit leg and the price feed until the OCO is done
+// or ctx is done.
+func (o *OCO) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	quotes, err := o.feed.Subscribe(ctx, o.spec.Pair)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", o.spec.Pair, err)
+	}
+	ticker := time.NewTicker(o.opts.PollInterval)
+	defer ticker.Stop()
+
+	for !o.State().Status.Done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := o.Poll(ctx); err != nil {
+				o.c.Logger.Warn("Orbix OCO poll failed", "orderId", o.State().TakeProfitOrderId, "error", err)
+			}
+		case q, ok := <-quotes:
+			if !ok {
+				return ctx.Err()
+			}
+			o.OnQuote(ctx, q)
+		}
+	}
+	return nil
+}
+
+// Poll checks the take-profit leg for fills and resizes or cancels the stop
+// leg accordingly. An update is emitted only when the state changes.
+func (o *OCO) Poll(ctx context.Context) error {
+	o.legs.Lock()
+	defer o.legs.Unlock()
+	state := o.State()
+	if state.Status.Done() {
+		return nil
+	}
+
+	tp, err := o.c.NewGetOrderByIdService(strconv.Itoa(state.TakeProfitOrderId), o.spec.Pair).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get take profit order: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.applyTakeProfitLocked(tp); err != nil {
+		return err
+	}
+	if o.state.Status == OCOActive && tp.Status != string(api.OrderStatusOpen) {
+		// Cancelled outside the OCO, the other leg goes with it.
+		o.state.Status = OCOCancelled
+	}
+	if o.state.Status != state.Status || o.state.TakeProfitFilled != state.TakeProfitFilled || o.state.StopAmount != state.StopAmount {
+		o.emitLocked()
+	}
+	return nil
+}
+
+// applyTakeProfitLocked records the fills of the take-profit leg. The
+// caller holds o.mu.
+func (o *OCO) applyTakeProfitLocked(tp *api.Order) error {
+	if strings.TrimSpace(tp.RemainingAmount) == "" {
+		return errors.New("error: take profit order has no remaining amount")
+	}
+	filled, err := api.SubDecimal(tp.Amount, tp.RemainingAmount)
+	if err != nil {
+		return fmt.Errorf("invalid take profit amounts: %w", err)
+	}
+	o.state.TakeProfitFilled = filled
+	o.state.StopAmount = tp.RemainingAmount
+	if cmp, _ := api.CmpDecimal(tp.RemainingAmount, "0"); cmp <= 0 {
+		o.state.Status = OCOTakeProfitFilled
+	}
+	return nil
+}
+
+// OnQuote fires the stop leg if q reaches its trigger. Run calls it for
+// every quote of the pair.
+func (o *OCO) OnQuote(ctx context.Context, q Quote) {
+	state := o.State()
+	if state.Status.Done() {
+		return
+	}
+	stop := o.spec.stopLeg(state.StopAmount)
+	if !stop.triggered(q.Price(stop.source())) {
+		return
+	}
+	if err := o.fireStop(ctx); err != nil {
+		o.c.Logger.Warn("Orbix OCO stop not fired", "orderId", state.TakeProfitOrderId, "error", err)
+	}
+}
+
+// fireStop cancels the take-profit leg, re-reads what it left unfilled and
+// sends the stop order for only that amount. If the cancel cannot be
+// confirmed the stop is not sent and the OCO stays active, so the next
+// trigger retries.
+func (o *OCO) fireStop(ctx context.Context) error {
+	o.legs.Lock()
+	defer o.legs.Unlock()
+	state := o.State()
+	if state.Status.Done() {
+		return nil
+	}
+
+	orderId := strconv.Itoa(state.TakeProfitOrderId)
+	cancelErr := o.c.NewCancelOrderService(orderId, o.spec.Pair).Do(ctx)
+	tp, err := o.c.NewGetOrderByIdService(orderId, o.spec.Pair).Do(ctx)
+
+	o.mu.Lock()
+	amount, err := o.stopAmountLocked(tp, err, cancelErr)
+	o.mu.Unlock()
+	if err != nil || amount == "" {
+		return err
+	}
+
+	stop := o.spec.stopLeg(amount)
+	orderType, price := stop.orderParams()
+	res, err := o.c.NewPlaceOrderService(api.NewClientOrderId(), o.spec.Pair, o.spec.Side, orderType, price, amount).
+		Do(ctx)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err != nil {
+		o.state.Status = OCOFailed
+		return o.failLocked(fmt.Errorf("take profit cancelled but stop order failed: %w", err))
+	}
+	o.state.Status = OCOStopTriggered
+	o.state.StopOrderId = res.Order.ID
+	o.state.Err = nil
+	o.emitLocked()
+	return nil
+}
+
+// stopAmountLocked records the take-profit leg as re-read after the cancel
+// and returns the amount to stop, empty when it filled. The caller holds
+// o.mu.
+func (o *OCO) stopAmountLocked(tp *api.Order, readErr error, cancelErr error) (string, error) {
+	if readErr != nil {
+		return "", o.failLocked(fmt.Errorf("failed to re-read take profit order: %w", readErr))
+	}
+	if err := o.applyTakeProfitLocked(tp); err != nil {
+		return "", o.failLocked(err)
+	}
+	if o.state.Status == OCOTakeProfitFilled {
+		// The take profit filled before the cancel: nothing left to stop.
+		o.emitLocked()
+		return "", nil
+	}
+	if tp.Status == string(api.OrderStatusOpen) {
+		return "", o.failLocked(fmt.Errorf("take profit order still open after cancel: %w", cancelErr))
+	}
+	return o.state.StopAmount, nil
+}
+
+// failLocked records err and emits the state. The caller holds o.mu.
+func (o *OCO) failLocked(err error) error {
+	o.state.Err = err
+	o.emitLocked()
+	return err
+}
+
+// Cancel cancels the take-profit leg and disarms the stop leg.
+func (o *OCO) Cancel(ctx context.Context) error {
+	o.legs.Lock()
+	defer o.legs.Unlock()
+	state := o.State()
+	if state.Status.Done() {
+		return ErrOCODone
+	}
+
+	orderId := strconv.Itoa(state.TakeProfitOrderId)
+	if err := o.c.NewCancelOrderService(orderId, o.spec.Pair).Do(ctx); err != nil {
+		return fmt.Errorf("failed to cancel take profit order %s: %w", orderId, err)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.state.Status = OCOCancelled
+	o.emitLocked()
+	return nil
+}
+
+func (o *OCO) emitLocked() {
+	select {
+	case o.updates <- o.state:
+	default:
+		o.c.Logger.Warn("Orbix OCO update dropped", "orderId", o.state.TakeProfitOrderId, "status", o.state.Status)
+	}
+}
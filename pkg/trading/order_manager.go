@@ -0,0 +1,534 @@
+// Package trading builds order tracking and client-side order types on top
+// of the Orbix API client.
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// OrderState is the lifecycle state of a managed order.
+type OrderState string
+
+const (
+	OrderStatePending         OrderState = "pending"
+	OrderStateOpen            OrderState = "open"
+	OrderStatePartiallyFilled OrderState = "partially_filled"
+	OrderStateFilled          OrderState = "filled"
+	OrderStateCancelled       OrderState = "cancelled"
+	OrderStateRejected        OrderState = "rejected"
+)
+
+// Terminal reports whether the order can no longer change.
+func (s OrderState) Terminal() bool {
+	return s == OrderStateFilled || s == OrderStateCancelled || s == OrderStateRejected
+}
+
+// Default Constants
+const (
+	DefaultPollInterval = 2 * time.Second
+	DefaultEventBuffer  = 256
+	pollListLimit       = 100
+)
+
+var (
+	ErrUnknownOrder = errors.New("error: unknown order")
+	ErrOrderPending = errors.New("error: order has no exchange id yet")
+)
+
+// OrderRequest describes an order to place through the OrderManager.
+type OrderRequest struct {
+	Pair   string
+	Side   api.SideType
+	Type   api.OrderType
+	Price  string
+	Amount string
+	// Strategy tags the order for queries, e.g. "grid-usdt".
+	Strategy string
+	// ClientOrderId is generated when empty.
+	ClientOrderId string
+}
+
+// ManagedOrder is a snapshot of an order tracked by the OrderManager.
+type ManagedOrder struct {
+	ClientOrderId string
+	OrderId       int
+	Pair          string
+	Side          api.SideType
+	Type          api.OrderType
+	Price         string
+	Amount        string
+	Strategy      string
+	State         OrderState
+	// Filled is the cumulative executed amount.
+	Filled       string
+	AveragePrice string
+	// Err is the reason of a rejection, or of a placement whose outcome is
+	// still unknown while the order is pending.
+	Err       error
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FillEvent is emitted whenever the executed amount of an order grows.
+type FillEvent struct {
+	Order ManagedOrder
+	// Amount is the quantity filled since the previous event.
+	Amount string
+	Time   time.Time
+}
+
+// StateChangeEvent is emitted on every state transition.
+type StateChangeEvent struct {
+	Order ManagedOrder
+	From  OrderState
+	To    OrderState
+	Time  time.Time
+}
+
+// OrderFilter selects managed orders. Zero fields match everything.
+type OrderFilter struct {
+	Pair     string
+	Strategy string
+	States   []OrderState
+}
+
+func (f OrderFilter) match(o *ManagedOrder) bool {
+	if f.Pair != "" && !strings.EqualFold(f.Pair, o.Pair) {
+		return false
+	}
+	if f.Strategy != "" && f.Strategy != o.Strategy {
+		return false
+	}
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, s := range f.States {
+		if s == o.State {
+			return true
+		}
+	}
+	return false
+}
+
+type OrderManagerOptions struct {
+	// PollInterval is used by Run. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// EventBuffer sizes the event channels. Events are dropped, and logged,
+	// when a channel is full, so consume them promptly.
+	EventBuffer int
+}
+
+// OrderManager places orders and tracks them through their lifecycle,
+// either by polling the exchange (Run, Poll) or from order updates pushed
+// by the caller, e.g. from the user data stream (Apply).
+type OrderManager struct {
+	c    *api.Client
+	opts OrderManagerOptions
+
+	mu        sync.RWMutex
+	orders    map[string]*ManagedOrder
+	byOrderId map[int]string
+
+	fills          chan FillEvent
+	changes        chan StateChangeEvent
+	droppedFills   atomic.Uint64
+	droppedChanges atomic.Uint64
+}
+
+func NewOrderManager(c *api.Client, opts OrderManagerOptions) *OrderManager {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = DefaultEventBuffer
+	}
+	return &OrderManager{
+		c:         c,
+		opts:      opts,
+		orders:    make(map[string]*ManagedOrder),
+		byOrderId: make(map[int]string),
+		fills:     make(chan FillEvent, opts.EventBuffer),
+		changes:   make(chan StateChangeEvent, opts.EventBuffer),
+	}
+}
+
+// Fills returns the channel of fill events. Events are never waited on
+// while the order book lock is held, so a fill is dropped when the channel
+// is full; the order's Filled still includes it. DroppedFills counts them.
+func (m *OrderManager) Fills() <-chan FillEvent {
+	return m.fills
+}
+
+// StateChanges returns the channel of state change events. Like fills,
+// changes are dropped when the channel is full; DroppedStateChanges counts
+// them.
+func (m *OrderManager) StateChanges() <-chan StateChangeEvent {
+	return m.changes
+}
+
+// DroppedFills returns the number of fill events dropped so far.
+func (m *OrderManager) DroppedFills() uint64 {
+	return m.droppedFills.Load()
+}
+
+// DroppedStateChanges returns the number of state change events dropped so
+// far.
+func (m *OrderManager) DroppedStateChanges() uint64 {
+	return m.droppedChanges.Load()
+}
+
+// Place places an order at most once per client order id and starts
+// tracking it. Placing a client order id again returns the tracked order,
+// unless its placement outcome is still unknown, in which case placement
+// is retried.
+func (m *OrderManager) Place(ctx context.Context, req OrderRequest) (ManagedOrder, error) {
+	if req.ClientOrderId == "" {
+		req.ClientOrderId = api.NewClientOrderId()
+	}
+
+	m.mu.Lock()
+	o, ok := m.orders[req.ClientOrderId]
+	if ok && o.State != OrderStatePending {
+		snapshot := *o
+		m.mu.Unlock()
+		return snapshot, nil
+	}
+	if !ok {
+		now := time.Now()
+		o = &ManagedOrder{
+			ClientOrderId: req.ClientOrderId,
+			Pair:          req.Pair,
+			Side:          req.Side,
+			Type:          req.Type,
+			Price:         req.Price,
+			Amount:        req.Amount,
+			Strategy:      req.Strategy,
+			State:         OrderStatePending,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		m.orders[req.ClientOrderId] = o
+	}
+	m.mu.Unlock()
+
+	res, err := m.c.NewPlaceOrderService(req.ClientOrderId, req.Pair, req.Side, req.Type, req.Price, req.Amount).
+		Do(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err == nil:
+		o.Err = nil
+		m.byOrderId[res.Order.ID] = o.ClientOrderId
+		m.update(o, *res.Order)
+	case errors.Is(err, api.ErrOrderNotPlaced):
+		o.Err = err
+		m.transition(o, OrderStateRejected)
+	default:
+		o.Err = err
+	}
+	return *o, err
+}
+
+// Cancel cancels a tracked order and refreshes its state. The order may
+// end up filled rather than cancelled if it filled before the cancel.
+func (m *OrderManager) Cancel(ctx context.Context, clientOrderId string) (ManagedOrder, error) {
+	o, ok := m.Order(clientOrderId)
+	if !ok {
+		return ManagedOrder{}, fmt.Errorf("%w: %s", ErrUnknownOrder, clientOrderId)
+	}
+	if o.OrderId == 0 {
+		return o, fmt.Errorf("%w: %s", ErrOrderPending, clientOrderId)
+	}
+	if o.State.Terminal() {
+		return o, nil
+	}
+
+	orderId := strconv.Itoa(o.OrderId)
+	if err := m.c.NewCancelOrderService(orderId, o.Pair).Do(ctx); err != nil {
+		return o, fmt.Errorf("failed to cancel order %s: %w", orderId, err)
+	}
+	latest, err := m.c.NewGetOrderByIdService(orderId, o.Pair).Do(ctx)
+	if err != nil {
+		return o, fmt.Errorf("failed to refresh order %s: %w", orderId, err)
+	}
+	m.Apply(*latest)
+
+	o, _ = m.Order(clientOrderId)
+	return o, nil
+}
+
+// Track starts tracking an order that was placed elsewhere.
+func (m *OrderManager) Track(order api.Order, pair string, strategy string) ManagedOrder {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if clientOrderId, ok := m.byOrderId[order.ID]; ok {
+		o := m.orders[clientOrderId]
+		m.update(o, order)
+		return *o
+	}
+
+	now := time.Now()
+	o := &ManagedOrder{
+		ClientOrderId: api.NewClientOrderId(),
+		Pair:          pair,
+		Strategy:      strategy,
+		State:         OrderStatePending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	m.orders[o.ClientOrderId] = o
+	m.byOrderId[order.ID] = o.ClientOrderId
+	m.update(o, order)
+	return *o
+}
+
+// Apply updates a tracked order from an exchange order snapshot, e.g. one
+// received from the user data stream. Unknown orders are ignored.
+func (m *OrderManager) Apply(order api.Order) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clientOrderId, ok := m.byOrderId[order.ID]
+	if !ok {
+		return
+	}
+	m.update(m.orders[clientOrderId], order)
+}
+
+// Run polls the exchange every PollInterval until ctx is done.
+func (m *OrderManager) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Poll(ctx); err != nil && ctx.Err() == nil {
+			m.c.Logger.Warn("Orbix order poll failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll refreshes every live order once: open orders are read per pair and
+// orders that left the open list are fetched individually.
+func (m *OrderManager) Poll(ctx context.Context) error {
+	live := make(map[string][]int)
+	for _, o := range m.Orders(OrderFilter{}) {
+		if o.OrderId != 0 && !o.State.Terminal() {
+			live[o.Pair] = append(live[o.Pair], o.OrderId)
+		}
+	}
+
+	var errs []error
+	for pair, orderIds := range live {
+		open, err := m.c.NewListCurrentOrdersService(pair, pollListLimit, 0).
+			Status(api.OrderStatusOpen).
+			Do(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list open orders for %s: %w", pair, err))
+			continue
+		}
+
+		stillOpen := make(map[int]bool)
+		if open != nil {
+			for _, order := range *open {
+				stillOpen[order.ID] = true
+				m.Apply(order)
+			}
+		}
+
+		for _, orderId := range orderIds {
+			if stillOpen[orderId] {
+				continue
+			}
+			order, err := m.c.NewGetOrderByIdService(strconv.Itoa(orderId), pair).Do(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get order %d: %w", orderId, err))
+				continue
+			}
+			m.Apply(*order)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Order returns a tracked order by client order id.
+func (m *OrderManager) Order(clientOrderId string) (ManagedOrder, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.orders[clientOrderId]
+	if !ok {
+		return ManagedOrder{}, false
+	}
+	return *o, true
+}
+
+// OrderById returns a tracked order by exchange order id.
+func (m *OrderManager) OrderById(orderId int) (ManagedOrder, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clientOrderId, ok := m.byOrderId[orderId]
+	if !ok {
+		return ManagedOrder{}, false
+	}
+	return *m.orders[clientOrderId], true
+}
+
+// Orders returns the tracked orders matching f, oldest first.
+func (m *OrderManager) Orders(f OrderFilter) []ManagedOrder {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var orders []ManagedOrder
+	for _, o := range m.orders {
+		if f.match(o) {
+			orders = append(orders, *o)
+		}
+	}
+	sortOrders(orders)
+	return orders
+}
+
+// OpenOrders returns the live orders for pair placed by strategy. Either
+// may be empty to match everything.
+func (m *OrderManager) OpenOrders(pair string, strategy string) []ManagedOrder {
+	return m.Orders(OrderFilter{
+		Pair:     pair,
+		Strategy: strategy,
+		States:   []OrderState{OrderStateOpen, OrderStatePartiallyFilled},
+	})
+}
+
+// update merges an exchange snapshot into o and emits events. The caller
+// holds m.mu.
+func (m *OrderManager) update(o *ManagedOrder, order api.Order) {
+	o.OrderId = order.ID
+	o.Type = order.Type
+	o.Side = order.Side
+	o.Price = order.Price
+	o.Amount = order.Amount
+	o.AveragePrice = order.AveragePrice
+
+	filled, err := filledOf(order)
+	if err != nil {
+		// The fills are unknown: the status alone still moves an order
+		// that is open or rejected, whether a closed order filled waits
+		// for a readable snapshot.
+		m.c.Logger.Warn("Orbix order has invalid amounts", "orderId", order.ID, "error", err)
+		switch state := stateOf(order, o.Filled); state {
+		case OrderStateOpen, OrderStatePartiallyFilled, OrderStateRejected:
+			m.transition(o, state)
+		}
+		return
+	}
+	if delta, err := api.SubDecimal(filled, o.Filled); err == nil {
+		if cmp, _ := api.CmpDecimal(delta, "0"); cmp > 0 {
+			o.Filled = filled
+			o.UpdatedAt = time.Now()
+			m.emitFill(FillEvent{Order: *o, Amount: delta, Time: o.UpdatedAt})
+		}
+	}
+	o.Filled = filled
+
+	m.transition(o, stateOf(order, filled))
+}
+
+func sortOrders(orders []ManagedOrder) {
+	slices.SortFunc(orders, func(a, b ManagedOrder) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ClientOrderId, b.ClientOrderId)
+	})
+}
+
+// transition moves o to state and emits a state change. Terminal states
+// are final. The caller holds m.mu.
+func (m *OrderManager) transition(o *ManagedOrder, state OrderState) {
+	if o.State == state || o.State.Terminal() {
+		return
+	}
+	from := o.State
+	o.State = state
+	o.UpdatedAt = time.Now()
+	m.emitChange(StateChangeEvent{Order: *o, From: from, To: state, Time: o.UpdatedAt})
+}
+
+func (m *OrderManager) emitFill(e FillEvent) {
+	select {
+	case m.fills <- e:
+	default:
+		m.droppedFills.Add(1)
+		m.c.Logger.Warn("Orbix fill event dropped", "clientOrderId", e.Order.ClientOrderId)
+	}
+}
+
+func (m *OrderManager) emitChange(e StateChangeEvent) {
+	select {
+	case m.changes <- e:
+	default:
+		m.droppedChanges.Add(1)
+		m.c.Logger.Warn("Orbix state change event dropped", "clientOrderId", e.Order.ClientOrderId)
+	}
+}
+
+// filledOf returns the executed amount of order. A missing amount or
+// remaining amount is an error, not zero, which would book the whole
+// order as filled.
+func filledOf(order api.Order) (string, error) {
+	if strings.TrimSpace(order.Amount) == "" || strings.TrimSpace(order.RemainingAmount) == "" {
+		return "", fmt.Errorf("order %d has no amount or remaining amount", order.ID)
+	}
+	return api.SubDecimal(order.Amount, order.RemainingAmount)
+}
+
+// stateOf derives the lifecycle state from an exchange order and its
+// executed amount.
+func stateOf(order api.Order, filled string) OrderState {
+	hasFills := false
+	if cmp, err := api.CmpDecimal(filled, "0"); err == nil {
+		hasFills = cmp > 0
+	}
+	fullyFilled := false
+	if cmp, err := api.CmpDecimal(order.RemainingAmount, "0"); err == nil {
+		fullyFilled = cmp <= 0
+	}
+
+	switch strings.ToLower(order.Status) {
+	case "open", "pending", "processing", "partially_filled":
+		if hasFills {
+			return OrderStatePartiallyFilled
+		}
+		return OrderStateOpen
+	case "rejected":
+		return OrderStateRejected
+	case "cancelled", "canceled":
+		if fullyFilled {
+			return OrderStateFilled
+		}
+		return OrderStateCancelled
+	default:
+		// "close" and other final statuses
+		if fullyFilled {
+			return OrderStateFilled
+		}
+		return OrderStateCancelled
+	}
+}
@@ -0,0 +1,203 @@
+package trading
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// PriceSource selects which price of a quote is watched.
+type PriceSource string
+
+const (
+	PriceSourceBid  PriceSource = "bid"
+	PriceSourceAsk  PriceSource = "ask"
+	PriceSourceMid  PriceSource = "mid"
+	PriceSourceLast PriceSource = "last"
+)
+
+// Quote is a price snapshot of one pair. Zero prices are unknown.
+type Quote struct {
+	Pair string
+	Bid  float64
+	Ask  float64
+	Last float64
+	Time time.Time
+}
+
+// Price returns the price selected by source. Mid and last fall back to
+// each other, and to the available side, when unknown.
+func (q Quote) Price(source PriceSource) float64 {
+	mid := q.Bid
+	switch {
+	case q.Bid > 0 && q.Ask > 0:
+		mid = (q.Bid + q.Ask) / 2
+	case q.Ask > 0:
+		mid = q.Ask
+	}
+
+	switch source {
+	case PriceSourceBid:
+		return q.Bid
+	case PriceSourceAsk:
+		return q.Ask
+	case PriceSourceLast:
+		if q.Last > 0 {
+			return q.Last
+		}
+		return mid
+	default:
+		return mid
+	}
+}
+
+// PriceFeed delivers quotes for a pair. The channel only holds the latest
+// quote, so a slow reader skips stale ones, and it is closed once ctx is
+// done.
+type PriceFeed interface {
+	Subscribe(ctx context.Context, pair string) (<-chan Quote, error)
+}
+
+// sendLatest replaces any unread quote in ch with q. ch must have a
+// buffer of one and a single sender.
+func sendLatest(ch chan Quote, q Quote) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- q
+}
+
+// TickerFeed is a PriceFeed polling the order book tickers.
+type TickerFeed struct {
+	c         *api.Client
+	interval  time.Duration
+	lastPrice bool
+}
+
+func NewTickerFeed(c *api.Client, interval time.Duration) *TickerFeed {
+	return &TickerFeed{c: c, interval: interval}
+}
+
+// WithLastPrice also polls the 24 hour ticker so quotes carry the last
+// traded price.
+func (f *TickerFeed) WithLastPrice() *TickerFeed {
+	f.lastPrice = true
+	return f
+}
+
+func (f *TickerFeed) Subscribe(ctx context.Context, pair string) (<-chan Quote, error) {
+	ch := make(chan Quote, 1)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+
+		for {
+			q, err := f.quote(ctx, pair)
+			if err == nil {
+				sendLatest(ch, q)
+			} else if ctx.Err() == nil {
+				f.c.Logger.Warn("Orbix ticker poll failed", "pair", pair, "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (f *TickerFeed) quote(ctx context.Context, pair string) (Quote, error) {
+	tickers, err := f.c.NewOrderbookTickerService().Do(ctx)
+	if err != nil {
+		return Quote{}, err
+	}
+	t, ok := tickers[strings.ToLower(pair)]
+	if !ok {
+		return Quote{}, fmt.Errorf("no ticker for pair %s", pair)
+	}
+	bid, err := api.ParseFloat(t.Bid.Price)
+	if err != nil {
+		return Quote{}, fmt.Errorf("invalid %s bid: %w", pair, err)
+	}
+	ask, err := api.ParseFloat(t.Ask.Price)
+	if err != nil {
+		return Quote{}, fmt.Errorf("invalid %s ask: %w", pair, err)
+	}
+	q := Quote{Pair: pair, Bid: bid, Ask: ask, Time: time.Now()}
+
+	if f.lastPrice {
+		stats, err := f.c.NewList24HrPriceChangeStatsService().Symbol(pair).Do(ctx)
+		if err != nil {
+			return Quote{}, err
+		}
+		if len(stats) > 0 {
+			if q.Last, err = api.ParseFloat(stats[0].LastPrice); err != nil {
+				return Quote{}, fmt.Errorf("invalid %s last price: %w", pair, err)
+			}
+		}
+	}
+	return q, nil
+}
+
+// parsePrice parses a price or amount of an order spec, returning zero when
+// it is missing or invalid so validation rejects it.
+func parsePrice(s string) float64 {
+	p, err := api.ParseFloat(s)
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
+// StreamFeed is a PriceFeed fed by the caller, e.g. from a websocket
+// stream or a replay, through Publish.
+type StreamFeed struct {
+	mu   sync.Mutex
+	subs map[string][]chan Quote
+}
+
+func NewStreamFeed() *StreamFeed {
+	return &StreamFeed{subs: make(map[string][]chan Quote)}
+}
+
+func (f *StreamFeed) Subscribe(ctx context.Context, pair string) (<-chan Quote, error) {
+	key := strings.ToLower(pair)
+	ch := make(chan Quote, 1)
+
+	f.mu.Lock()
+	f.subs[key] = append(f.subs[key], ch)
+	f.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		subs := f.subs[key]
+		for i, sub := range subs {
+			if sub == ch {
+				f.subs[key] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// Publish delivers q to the subscribers of q.Pair.
+func (f *StreamFeed) Publish(q Quote) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ch := range f.subs[strings.ToLower(q.Pair)] {
+		sendLatest(ch, q)
+	}
+}
@@ -0,0 +1,69 @@
+package trading
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Store persists a list of records, e.g. pending conditional orders, so
+// they survive restarts.
+type Store[T any] interface {
+	Load() ([]T, error)
+	Save(records []T) error
+}
+
+// FileStore is a Store backed by a JSON file. Saves replace the file
+// atomically.
+type FileStore[T any] struct {
+	Path string
+}
+
+func NewFileStore[T any](path string) *FileStore[T] {
+	return &FileStore[T]{Path: path}
+}
+
+// Load returns the saved records, or none if the file does not exist yet.
+func (s *FileStore[T]) Load() ([]T, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Path, err)
+	}
+
+	var records []T
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", s.Path, err)
+	}
+	return records, nil
+}
+
+func (s *FileStore[T]) Save(records []T) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("err marshalling JSON: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", s.Path, err)
+	}
+	return nil
+}
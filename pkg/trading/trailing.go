@@ -0,0 +1,301 @@
+package trading
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+)
+
+// TrailingStopOrder describes a stop whose trigger follows the price. A
+// sell trails below the highest price seen and a buy above the lowest.
+type TrailingStopOrder struct {
+	Pair   string
+	Side   api.SideType
+	Amount string
+	// Offset is the absolute distance between the best price seen and the
+	// trigger. Exactly one of Offset and OffsetPercent must be set.
+	Offset float64
+	// OffsetPercent is the distance as a fraction of the best price seen,
+	// 0.02 = 2%.
+	OffsetPercent float64
+	// Source is the followed price. Defaults to the bid for sells and the
+	// ask for buys; PriceSourceLast needs a feed with last prices, see
+	// TickerFeed.WithLastPrice.
+	Source PriceSource
+	// OrderType is the type of the order sent when the stop is breached.
+	// Defaults to market.
+	OrderType api.OrderType
+	// LimitOffset prices a limit order this far beyond the trigger: below
+	// it for sells, above it for buys.
+	LimitOffset float64
+	// PricePrecision is the number of decimals of the limit price. When
+	// zero the limit price is rounded to the tick size of the pair, loaded
+	// from the exchange info.
+	PricePrecision int
+}
+
+func (o *TrailingStopOrder) validate() error {
+	if o.Pair == "" {
+		return fmt.Errorf("%w: missing pair", ErrInvalidConditionalOrder)
+	}
+	if o.Side != api.SideTypeBuy && o.Side != api.SideTypeSell {
+		return fmt.Errorf("%w: unknown side %q", ErrInvalidConditionalOrder, o.Side)
+	}
+	if parsePrice(o.Amount) <= 0 {
+		return fmt.Errorf("%w: invalid amount %q", ErrInvalidConditionalOrder, o.Amount)
+	}
+	if (o.Offset > 0) == (o.OffsetPercent > 0) || o.Offset < 0 || o.OffsetPercent < 0 || o.OffsetPercent >= 1 {
+		return fmt.Errorf("%w: set exactly one of a positive offset or an offset percent below 1", ErrInvalidConditionalOrder)
+	}
+	if o.OrderType != api.OrderTypeMarket && o.OrderType != api.OrderTypeLimit {
+		return fmt.Errorf("%w: unknown order type %q", ErrInvalidConditionalOrder, o.OrderType)
+	}
+	if o.LimitOffset < 0 {
+		return fmt.Errorf("%w: negative limit offset", ErrInvalidConditionalOrder)
+	}
+	return nil
+}
+
+func (o *TrailingStopOrder) source() PriceSource {
+	if o.Source != "" {
+		return o.Source
+	}
+	if o.Side == api.SideTypeSell {
+		return PriceSourceBid
+	}
+	return PriceSourceAsk
+}
+
+// trigger returns the trigger for the best price seen.
+func (o *TrailingStopOrder) trigger(extreme float64) float64 {
+	offset := o.Offset
+	if o.OffsetPercent > 0 {
+		offset = extreme * o.OffsetPercent
+	}
+	if o.Side == api.SideTypeSell {
+		return extreme - offset
+	}
+	return extreme + offset
+}
+
+// TrailState is an observable snapshot of a trailing stop.
+type TrailState struct {
+	// Extreme is the best price seen: the highest for sells, the lowest
+	// for buys. Zero until the first quote.
+	Extreme float64
+	// Trigger is the current stop price. It only ever moves in the
+	// direction of the trade.
+	Trigger   float64
+	LastPrice float64
+	Triggered bool
+	OrderId   int
+	Err       error
+	UpdatedAt time.Time
+}
+
+// TrailingStop runs a TrailingStopOrder against a price feed and sends the
+// order through the create order service once the stop is breached.
+type TrailingStop struct {
+	c     *api.Client
+	feed  PriceFeed
+	order TrailingStopOrder
+
+	mu      sync.Mutex
+	state   TrailState
+	updates chan TrailState
+	// tick is the tick size of the pair once loaded.
+	tick string
+}
+
+func NewTrailingStop(c *api.Client, feed PriceFeed, order TrailingStopOrder) (*TrailingStop, error) {
+	if order.OrderType == "" {
+		order.OrderType = api.OrderTypeMarket
+	}
+	if err := order.validate(); err != nil {
+		return nil, err
+	}
+	return &TrailingStop{
+		c:       c,
+		feed:    feed,
+		order:   order,
+		updates: make(chan TrailState, DefaultEventBuffer),
+	}, nil
+}
+
+// State returns the current trail state.
+func (t *TrailingStop) State() TrailState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Updates returns the channel receiving the trail state whenever the
+// trigger moves or the stop fires. A slow reader misses intermediate
+// states but always receives the latest.
+func (t *TrailingStop) Updates() <-chan TrailState {
+	return t.updates
+}
+
+// Run follows the price feed until the stop has fired or ctx is done, and
+// returns the error of the stop order if it could not be placed. Cancel
+// ctx to disarm the stop.
+func (t *TrailingStop) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Load the tick size up front, so a stop is not armed that could not
+	// price its order.
+	if t.order.OrderType == api.OrderTypeLimit && t.order.PricePrecision == 0 {
+		if _, err := t.tickSize(ctx); err != nil {
+			return err
+		}
+	}
+	quotes, err := t.feed.Subscribe(ctx, t.order.Pair)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", t.order.Pair, err)
+	}
+	for q := range quotes {
+		t.OnQuote(ctx, q)
+		if state := t.State(); state.Triggered {
+			return state.Err
+		}
+	}
+	return ctx.Err()
+}
+
+// OnQuote ratchets the trigger with q and fires the stop if q breaches it.
+func (t *TrailingStop) OnQuote(ctx context.Context, q Quote) {
+	price := q.Price(t.order.source())
+	if price <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	if t.state.Triggered {
+		t.mu.Unlock()
+		return
+	}
+	t.state.LastPrice = price
+	t.state.UpdatedAt = time.Now()
+
+	if t.state.Extreme == 0 || t.improves(price) {
+		t.state.Extreme = price
+		t.state.Trigger = t.order.trigger(price)
+		t.emitLocked()
+	}
+
+	if !crossed(t.order.Side, true, price, t.state.Trigger) {
+		t.mu.Unlock()
+		return
+	}
+	t.state.Triggered = true
+	trigger := t.state.Trigger
+	t.mu.Unlock()
+
+	orderId, err := t.submit(ctx, trigger)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state.OrderId = orderId
+	t.state.Err = err
+	t.state.UpdatedAt = time.Now()
+	t.emitLocked()
+}
+
+// improves reports whether price is better than the best price seen for
+// the trade direction. The caller holds t.mu.
+func (t *TrailingStop) improves(price float64) bool {
+	if t.order.Side == api.SideTypeSell {
+		return price > t.state.Extreme
+	}
+	return price < t.state.Extreme
+}
+
+func (t *TrailingStop) submit(ctx context.Context, trigger float64) (int, error) {
+	price := "0"
+	if t.order.OrderType == api.OrderTypeLimit {
+		limit := trigger + t.order.LimitOffset
+		if t.order.Side == api.SideTypeSell {
+			limit = trigger - t.order.LimitOffset
+		}
+		var err error
+		if price, err = t.limitPrice(ctx, limit); err != nil {
+			return 0, fmt.Errorf("trailing stop breached but order not priced: %w", err)
+		}
+	}
+
+	res, err := t.c.NewPlaceOrderService(api.NewClientOrderId(), t.order.Pair, t.order.Side, t.order.OrderType, price, t.order.Amount).
+		Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("trailing stop breached but order failed: %w", err)
+	}
+	return res.Order.ID, nil
+}
+
+// limitPrice formats limit with PricePrecision decimals, or rounded to the
+// tick size of the pair when no precision is set.
+func (t *TrailingStop) limitPrice(ctx context.Context, limit float64) (string, error) {
+	if t.order.PricePrecision > 0 {
+		return strconv.FormatFloat(limit, 'f', t.order.PricePrecision, 64), nil
+	}
+	tick, err := t.tickSize(ctx)
+	if err != nil {
+		return "", err
+	}
+	step, err := api.ParseFloat(tick)
+	if err != nil || step <= 0 {
+		return "", fmt.Errorf("error: invalid %s tick size %q", t.order.Pair, tick)
+	}
+	prec := api.DecimalPlaces(strings.TrimRight(tick, "0"))
+	return strconv.FormatFloat(math.Round(limit/step)*step, 'f', prec, 64), nil
+}
+
+// tickSize returns the tick size of the pair, loading it once.
+func (t *TrailingStop) tickSize(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	tick := t.tick
+	t.mu.Unlock()
+	if tick != "" {
+		return tick, nil
+	}
+
+	info, err := t.c.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load exchange info: %w", err)
+	}
+	symbol, ok := info.Symbol(t.order.Pair)
+	if !ok || symbol.TradingRules().TickSize == "" {
+		return "", fmt.Errorf("error: no tick size for %s, set PricePrecision", t.order.Pair)
+	}
+	tick = symbol.TradingRules().TickSize
+
+	t.mu.Lock()
+	t.tick = tick
+	t.mu.Unlock()
+	return tick, nil
+}
+
+// emitLocked queues the state. When the channel is full the oldest queued
+// state makes room, so the last state received is always the latest. The
+// caller holds t.mu, which makes it the only sender.
+func (t *TrailingStop) emitLocked() {
+	select {
+	case t.updates <- t.state:
+		return
+	default:
+	}
+	select {
+	case <-t.updates:
+	default:
+	}
+	select {
+	case t.updates <- t.state:
+	default:
+	}
+}
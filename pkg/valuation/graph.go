@@ -0,0 +1,184 @@
+package valuation
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/trading"
+)
+
+// Price is the price of one unit of Asset in Quote.
+type Price struct {
+	Asset string
+	Quote string
+	Price float64
+	// Pairs are the pairs the price was triangulated through, in order.
+	// They are empty when Asset is Quote.
+	Pairs []string
+	// Time is when the oldest quote on the way was observed.
+	Time time.Time
+}
+
+// Age returns how stale the price is at now.
+func (p Price) Age(now time.Time) time.Duration {
+	if p.Time.IsZero() {
+		return 0
+	}
+	return now.Sub(p.Time)
+}
+
+type GraphOptions struct {
+	// Via are the intermediate assets preferred when triangulating, in
+	// order. Other assets are tried after them.
+	Via []string
+	// MaxHops is the most pairs a price goes through. Defaults to
+	// DefaultMaxHops.
+	MaxHops int
+	// MaxAge, when set, leaves out quotes older than this.
+	MaxAge time.Duration
+}
+
+// Graph prices assets in one another from the mid prices of pairs,
+// triangulating through intermediate assets where no direct pair exists.
+// It is not safe for concurrent use.
+type Graph struct {
+	opts   GraphOptions
+	quotes map[string]trading.Quote
+	// pairs are the pairs of each asset.
+	pairs map[string][]string
+}
+
+func NewGraph(opts GraphOptions) *Graph {
+	if opts.MaxHops <= 0 {
+		opts.MaxHops = DefaultMaxHops
+	}
+	via := make([]string, len(opts.Via))
+	for i, asset := range opts.Via {
+		via[i] = strings.ToLower(asset)
+	}
+	opts.Via = via
+	return &Graph{
+		opts:   opts,
+		quotes: make(map[string]trading.Quote),
+		pairs:  make(map[string][]string),
+	}
+}
+
+// Set records the latest quote of a pair, e.g. "btc_thb".
+func (g *Graph) Set(q trading.Quote) {
+	q.Pair = strings.ToLower(q.Pair)
+	base, quote, ok := strings.Cut(q.Pair, "_")
+	if !ok {
+		return
+	}
+	if _, known := g.quotes[q.Pair]; !known {
+		g.pairs[base] = append(g.pairs[base], q.Pair)
+		g.pairs[quote] = append(g.pairs[quote], q.Pair)
+	}
+	g.quotes[q.Pair] = q
+}
+
+// SetTickers records the order book tickers as observed at at. Tickers
+// with an unparseable price are left out and reported in the error.
+func (g *Graph) SetTickers(tickers map[string]api.OrderbookTicker, at time.Time) error {
+	var errs []error
+	for pair, t := range tickers {
+		bid, err1 := api.ParseFloat(t.Bid.Price)
+		ask, err2 := api.ParseFloat(t.Ask.Price)
+		if err := errors.Join(err1, err2); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s ticker: %w", pair, err))
+			continue
+		}
+		g.Set(trading.Quote{Pair: pair, Bid: bid, Ask: ask, Time: at})
+	}
+	return errors.Join(errs...)
+}
+
+// Quote returns the latest quote of pair.
+func (g *Graph) Quote(pair string) (trading.Quote, bool) {
+	q, ok := g.quotes[strings.ToLower(pair)]
+	return q, ok
+}
+
+// Price returns the price of asset in quote at now, through the fewest
+// pairs. Among paths as short, those through the preferred intermediate
+// assets win.
+func (g *Graph) Price(asset string, quote string, now time.Time) (Price, bool) {
+	asset, quote = strings.ToLower(asset), strings.ToLower(quote)
+	if asset == quote {
+		return Price{Asset: asset, Quote: quote, Price: 1}, true
+	}
+
+	type step struct {
+		asset string
+		price Price
+	}
+	frontier := []step{{asset, Price{Asset: asset, Quote: asset, Price: 1}}}
+	seen := map[string]bool{asset: true}
+	for hop := 0; hop < g.opts.MaxHops && len(frontier) > 0; hop++ {
+		var next []step
+		for _, s := range frontier {
+			for _, pair := range g.neighbours(s.asset) {
+				q := g.quotes[pair]
+				mid := q.Price(trading.PriceSourceMid)
+				if mid <= 0 || (g.opts.MaxAge > 0 && now.Sub(q.Time) > g.opts.MaxAge) {
+					continue
+				}
+				base, other, _ := strings.Cut(pair, "_")
+				rate := mid
+				if other == s.asset {
+					other, rate = base, 1/mid
+				}
+				if seen[other] {
+					continue
+				}
+				seen[other] = true
+
+				p := Price{
+					Asset: asset,
+					Quote: other,
+					Price: s.price.Price * rate,
+					Pairs: append(slices.Clone(s.price.Pairs), pair),
+					Time:  s.price.Time,
+				}
+				if p.Time.IsZero() || q.Time.Before(p.Time) {
+					p.Time = q.Time
+				}
+				if other == quote {
+					return p, true
+				}
+				next = append(next, step{other, p})
+			}
+		}
+		frontier = next
+	}
+	return Price{}, false
+}
+
+// neighbours returns the pairs of asset, those leading to the preferred
+// intermediate assets first, then by name.
+func (g *Graph) neighbours(asset string) []string {
+	pairs := slices.Clone(g.pairs[asset])
+	rank := func(pair string) int {
+		base, quote, _ := strings.Cut(pair, "_")
+		other := base
+		if base == asset {
+			other = quote
+		}
+		if i := slices.Index(g.opts.Via, other); i >= 0 {
+			return i
+		}
+		return len(g.opts.Via)
+	}
+	slices.SortFunc(pairs, func(a, b string) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		return strings.Compare(a, b)
+	})
+	return pairs
+}
@@ -0,0 +1,318 @@
+// Package valuation values the wallets of an account in THB, and
+// optionally in USD through USDT, from order book ticker or depth mid
+// prices. Assets without a pair with the home currency are triangulated
+// through intermediate assets, and every price reports how stale it is.
+package valuation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BinLab64/Orbix-client/pkg/api"
+	"github.com/BinLab64/Orbix-client/pkg/trading"
+)
+
+// Default Constants
+const (
+	DefaultHome     = "thb"
+	DefaultUSDAsset = "usdt"
+	DefaultMaxHops  = 3
+	// DefaultDepthLimit is the depth read per pair with SourceOrderbook.
+	DefaultDepthLimit = 5
+)
+
+// DefaultVia are the intermediate assets preferred when triangulating.
+var DefaultVia = []string{"usdt", "btc"}
+
+var ErrNoPrices = errors.New("error: no prices")
+
+// Source selects where prices come from.
+type Source string
+
+const (
+	// SourceTicker reads the best bid and ask of every pair in one request.
+	SourceTicker Source = "ticker"
+	// SourceOrderbook reads the depth of the pairs of the held assets and
+	// the intermediate assets, one request per pair.
+	SourceOrderbook Source = "orderbook"
+)
+
+type Options struct {
+	// Home is the currency wallets are valued in. Defaults to DefaultHome.
+	Home string
+	// USD also values wallets in USD, at the home price of USDAsset.
+	USD bool
+	// USDAsset defaults to DefaultUSDAsset.
+	USDAsset string
+	// Source defaults to SourceTicker.
+	Source Source
+	// Via defaults to DefaultVia.
+	Via []string
+	// MaxHops defaults to DefaultMaxHops.
+	MaxHops int
+	// MaxAge, when set, leaves assets unpriced rather than valued at quotes
+	// older than this.
+	MaxAge time.Duration
+}
+
+// Holding is one wallet valued in the home currency.
+type Holding struct {
+	Asset   string
+	Balance float64
+	// Price, Value and Weight are zero when the asset is unpriced.
+	Price    float64
+	Value    float64
+	USDValue float64
+	// Weight is the share of the total value.
+	Weight float64
+	// Pairs are the pairs the price was triangulated through.
+	Pairs []string
+	// PriceTime is when the oldest quote behind the price was observed and
+	// Staleness how long before the valuation that was.
+	PriceTime time.Time
+	Staleness time.Duration
+	Priced    bool
+}
+
+type Valuation struct {
+	Home string
+	Time time.Time
+	// Total is the value of the priced holdings.
+	Total float64
+	// TotalUSD and USDRate, the home price of one USD, are zero unless
+	// valued in USD and the USD asset is priced.
+	TotalUSD float64
+	USDRate  float64
+	// Holdings are by value, largest first.
+	Holdings []Holding
+	// Unpriced are the held assets no price was found for.
+	Unpriced []string
+}
+
+// Valuer values wallets. Quotes are kept between valuations: a pair that
+// fails to refresh keeps its last quote and shows up as stale. It is safe
+// for concurrent use.
+type Valuer struct {
+	c    *api.Client
+	opts Options
+
+	mu    sync.Mutex
+	graph *Graph
+	pairs []string
+}
+
+func New(c *api.Client, opts Options) *Valuer {
+	if opts.Home == "" {
+		opts.Home = DefaultHome
+	}
+	opts.Home = strings.ToLower(opts.Home)
+	if opts.USDAsset == "" {
+		opts.USDAsset = DefaultUSDAsset
+	}
+	opts.USDAsset = strings.ToLower(opts.USDAsset)
+	if opts.Source == "" {
+		opts.Source = SourceTicker
+	}
+	if opts.Via == nil {
+		opts.Via = DefaultVia
+	}
+	return &Valuer{
+		c:     c,
+		opts:  opts,
+		graph: NewGraph(GraphOptions{Via: opts.Via, MaxHops: opts.MaxHops, MaxAge: opts.MaxAge}),
+	}
+}
+
+// Update records a quote, e.g. from a trading.PriceFeed, to value with
+// between refreshes.
+func (v *Valuer) Update(q trading.Quote) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.graph.Set(q)
+}
+
+// Value values the wallets of the account.
+func (v *Valuer) Value(ctx context.Context) (*Valuation, error) {
+	user, err := v.c.NewListBalanceAddressService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balances: %w", err)
+	}
+	balances := make(map[string]float64, len(user.Wallets))
+	for symbol, wallet := range user.Wallets {
+		balance, err := api.ParseFloat(wallet.AvailableBalance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s balance: %w", symbol, err)
+		}
+		balances[strings.ToLower(string(symbol))] += balance
+	}
+	return v.ValueBalances(ctx, balances)
+}
+
+// ValueBalances refreshes the prices and values balances by asset. When
+// the refresh fails the last quotes are used, and ErrNoPrices is returned
+// if there are none.
+func (v *Valuer) ValueBalances(ctx context.Context, balances map[string]float64) (*Valuation, error) {
+	assets := make([]string, 0, len(balances))
+	for asset := range balances {
+		assets = append(assets, strings.ToLower(asset))
+	}
+	refreshErr := v.refresh(ctx, assets)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if refreshErr != nil {
+		if len(v.graph.quotes) == 0 {
+			return nil, fmt.Errorf("%w: %w", ErrNoPrices, refreshErr)
+		}
+		v.c.Logger.Warn("Orbix valuation refresh failed, using last prices", "error", refreshErr)
+	}
+	return v.valueLocked(balances, time.Now()), nil
+}
+
+// valueLocked values balances from the current quotes. The caller holds
+// v.mu.
+func (v *Valuer) valueLocked(balances map[string]float64, now time.Time) *Valuation {
+	val := &Valuation{Home: v.opts.Home, Time: now, Holdings: []Holding{}}
+	if v.opts.USD {
+		if p, ok := v.graph.Price(v.opts.USDAsset, v.opts.Home, now); ok {
+			val.USDRate = p.Price
+		}
+	}
+
+	for asset, balance := range balances {
+		asset = strings.ToLower(asset)
+		if balance == 0 {
+			continue
+		}
+		h := Holding{Asset: asset, Balance: balance}
+		if p, ok := v.graph.Price(asset, v.opts.Home, now); ok {
+			h.Priced = true
+			h.Price = p.Price
+			h.Value = balance * p.Price
+			h.Pairs = p.Pairs
+			h.PriceTime = p.Time
+			h.Staleness = p.Age(now)
+			if val.USDRate > 0 {
+				h.USDValue = h.Value / val.USDRate
+			}
+			val.Total += h.Value
+		} else {
+			val.Unpriced = append(val.Unpriced, asset)
+		}
+		val.Holdings = append(val.Holdings, h)
+	}
+	if val.USDRate > 0 {
+		val.TotalUSD = val.Total / val.USDRate
+	}
+	for i := range val.Holdings {
+		if h := &val.Holdings[i]; val.Total > 0 {
+			h.Weight = h.Value / val.Total
+		}
+	}
+	sort.Slice(val.Holdings, func(i, j int) bool {
+		a, b := val.Holdings[i], val.Holdings[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		return a.Asset < b.Asset
+	})
+	sort.Strings(val.Unpriced)
+	return val
+}
+
+// refresh reads the quotes pricing assets.
+func (v *Valuer) refresh(ctx context.Context, assets []string) error {
+	if v.opts.Source == SourceTicker {
+		tickers, err := v.c.NewOrderbookTickerService().Do(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read tickers: %w", err)
+		}
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return v.graph.SetTickers(tickers, time.Now())
+	}
+
+	pairs, err := v.depthPairs(ctx, assets)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, pair := range pairs {
+		depth, err := v.c.NewOrderbookDepthService(pair).Limit(DefaultDepthLimit).Do(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read %s depth: %w", pair, err))
+			continue
+		}
+		q, err := depthQuote(pair, depth)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v.Update(q)
+	}
+	return errors.Join(errs...)
+}
+
+// depthQuote returns the quote at the top of depth.
+func depthQuote(pair string, depth *api.OrderbookDepth) (trading.Quote, error) {
+	q := trading.Quote{Pair: pair, Time: time.Now()}
+	var err error
+	if len(depth.Bids) > 0 {
+		if q.Bid, err = api.ParseFloat(depth.Bids[0][0]); err != nil {
+			return q, fmt.Errorf("invalid %s bid: %w", pair, err)
+		}
+	}
+	if len(depth.Asks) > 0 {
+		if q.Ask, err = api.ParseFloat(depth.Asks[0][0]); err != nil {
+			return q, fmt.Errorf("invalid %s ask: %w", pair, err)
+		}
+	}
+	return q, nil
+}
+
+// depthPairs returns the listed pairs pricing assets, directly or through
+// the intermediate, home and USD assets. The listed pairs are loaded once.
+func (v *Valuer) depthPairs(ctx context.Context, assets []string) ([]string, error) {
+	v.mu.Lock()
+	listed := v.pairs
+	v.mu.Unlock()
+	if listed == nil {
+		info, err := v.c.NewExchangeInfoService().Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load exchange info: %w", err)
+		}
+		for _, s := range info.Symbols {
+			listed = append(listed, strings.ToLower(s.Symbol))
+		}
+		v.mu.Lock()
+		v.pairs = listed
+		v.mu.Unlock()
+	}
+
+	held := make(map[string]bool, len(assets))
+	for _, asset := range assets {
+		held[asset] = true
+	}
+	routes := map[string]bool{v.opts.Home: true}
+	if v.opts.USD {
+		routes[v.opts.USDAsset] = true
+	}
+	for _, asset := range v.opts.Via {
+		routes[strings.ToLower(asset)] = true
+	}
+
+	// A pair is read if it prices a held asset or links two route assets.
+	var pairs []string
+	for _, pair := range listed {
+		base, quote, ok := strings.Cut(pair, "_")
+		if ok && (held[base] || held[quote] || (routes[base] && routes[quote])) {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}